@@ -0,0 +1,207 @@
+package anddrive
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultBaseURL = "https://portal.anddrive.cn/api/v0/thirdpart"
+	DefaultSysCode = "30007"
+	DefaultFrom    = "OTHER"
+)
+
+// ReqBody 第三方接口的请求信封，Data 为 base64 编码的业务参数
+type ReqBody struct {
+	Data      string `json:"data"`
+	Sign      string `json:"sign"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type MonitorStartParam struct {
+	CameraType string `json:"cameraType"`
+	StreamMode int    `json:"streamMode"`
+}
+
+// Location 实时定位，坐标为 WGS84
+type Location struct {
+	Longitude float64 `json:"longitude"`
+	Latitude  float64 `json:"latitude"`
+	GpsTime   int64   `json:"gpsTime"`
+	RunStatus string  `json:"runStatus"`
+}
+
+// Error 接口返回的错误，StatusCode 为 http 状态码，Code/Message 来自响应体
+type Error struct {
+	StatusCode int
+	Code       int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("anddrive: status %d, code %d, message %s", e.StatusCode, e.Code, e.Message)
+}
+
+type Client struct {
+	BaseURL      string
+	SysCode      string
+	From         string
+	SignatureKey string
+	HTTPClient   *http.Client
+	// Now 生成时间戳，测试时可以替换
+	Now func() time.Time
+}
+
+func NewClient(signatureKey string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		BaseURL:      DefaultBaseURL,
+		SysCode:      DefaultSysCode,
+		From:         DefaultFrom,
+		SignatureKey: signatureKey,
+		HTTPClient:   httpClient,
+		Now:          time.Now,
+	}
+}
+
+func SHA1(s string) string {
+	h := sha1.New()
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Sign 签名为 sha1(base64(data) + timestamp + signatureKey)
+func Sign(data []byte, timestamp int64, signatureKey string) string {
+	str := base64.StdEncoding.EncodeToString(data) + strconv.FormatInt(timestamp, 10) + signatureKey
+	return SHA1(str)
+}
+
+// NewReqBody 对业务参数编码并签名
+func NewReqBody(param interface{}, timestamp int64, signatureKey string) (ReqBody, error) {
+	paramJson, err := json.Marshal(param)
+	if err != nil {
+		return ReqBody{}, err
+	}
+	return ReqBody{
+		Data:      base64.StdEncoding.EncodeToString(paramJson),
+		Sign:      Sign(paramJson, timestamp, signatureKey),
+		Timestamp: timestamp,
+	}, nil
+}
+
+func (c *Client) timestamp() int64 {
+	now := time.Now
+	if c.Now != nil {
+		now = c.Now
+	}
+	return now().UnixNano() / 1e6
+}
+
+func (c *Client) terminalURL(terminalID, action string) string {
+	return c.BaseURL + "/terminals/" + url.PathEscape(terminalID) + "/" + action
+}
+
+func (c *Client) setHeaders(req *http.Request, timestamp int64) {
+	req.Header.Set("sysCode", c.SysCode)
+	req.Header.Set("from", c.From)
+	req.Header.Set("msgId", strconv.FormatInt(timestamp, 10))
+}
+
+// MonitorStart 开流，开流后才能获取实时定位
+func (c *Client) MonitorStart(ctx context.Context, terminalID string, param MonitorStartParam) error {
+	return c.post(ctx, c.terminalURL(terminalID, "monitor-start"), param)
+}
+
+// MonitorContinue 续期，需要在会话过期前周期调用
+func (c *Client) MonitorContinue(ctx context.Context, terminalID string) error {
+	return c.post(ctx, c.terminalURL(terminalID, "monitor-continue"), map[string]interface{}{})
+}
+
+// Realtime 获取终端实时定位
+func (c *Client) Realtime(ctx context.Context, terminalID string) (*Location, error) {
+	timestamp := c.timestamp()
+	u := fmt.Sprintf("%s?timestamp=%d&sign=%s", c.terminalURL(terminalID, "realtime"), timestamp,
+		Sign(nil, timestamp, c.SignatureKey))
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.setHeaders(req, timestamp)
+	location := &Location{}
+	if err := c.do(req, location); err != nil {
+		return nil, err
+	}
+	return location, nil
+}
+
+func (c *Client) post(ctx context.Context, u string, param interface{}) error {
+	timestamp := c.timestamp()
+	reqBody, err := NewReqBody(param, timestamp, c.SignatureKey)
+	if err != nil {
+		return err
+	}
+	reqBodyJson, _ := json.Marshal(reqBody)
+	req, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewBuffer(reqBodyJson))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json;charset=UTF-8")
+	c.setHeaders(req, timestamp)
+	return c.do(req, nil)
+}
+
+// status 错误响应体，不同接口使用 message 或 msg
+type status struct {
+	Code    *int   `json:"code"`
+	Message string `json:"message"`
+	Msg     string `json:"msg"`
+}
+
+// do 发送请求，非 2xx 或响应体中 code 非 0/200 时返回 *Error，out 不为空时解码响应体
+func (c *Client) do(req *http.Request, out interface{}) error {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	st := status{}
+	_ = json.Unmarshal(body, &st)
+	message := st.Message
+	if message == "" {
+		message = st.Msg
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &Error{StatusCode: resp.StatusCode, Message: message}
+		if st.Code != nil {
+			apiErr.Code = *st.Code
+		}
+		if apiErr.Message == "" {
+			apiErr.Message = string(body)
+		}
+		return apiErr
+	}
+	if st.Code != nil && *st.Code != 0 && *st.Code != http.StatusOK {
+		return &Error{StatusCode: resp.StatusCode, Code: *st.Code, Message: message}
+	}
+	if out == nil || len(body) == 0 {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
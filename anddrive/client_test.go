@@ -0,0 +1,140 @@
+package anddrive
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const (
+	testKey       = "test-signature-key"
+	testTimestamp = int64(1630999224000)
+)
+
+func TestSign(t *testing.T) {
+	cases := []struct {
+		data string
+		want string
+	}{
+		{`{"cameraType":"FRONT","streamMode":0}`, "8b575c169362ecac7f17dadf0920eb28e87ce5ab"},
+		{`{}`, "85ef23357fa3848c37197b62d885431ee47d9404"},
+		{``, "b168371bb8a9a1a5a10865b749b6611061a675ef"},
+	}
+	for _, c := range cases {
+		if got := Sign([]byte(c.data), testTimestamp, testKey); got != c.want {
+			t.Errorf("Sign(%q) = %s, want %s", c.data, got, c.want)
+		}
+	}
+}
+
+func TestNewReqBody(t *testing.T) {
+	reqBody, err := NewReqBody(MonitorStartParam{CameraType: "FRONT"}, testTimestamp, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ReqBody{
+		Data:      "eyJjYW1lcmFUeXBlIjoiRlJPTlQiLCJzdHJlYW1Nb2RlIjowfQ==",
+		Sign:      "8b575c169362ecac7f17dadf0920eb28e87ce5ab",
+		Timestamp: testTimestamp,
+	}
+	if reqBody != want {
+		t.Errorf("NewReqBody = %+v, want %+v", reqBody, want)
+	}
+}
+
+func newTestClient(handler http.HandlerFunc) (*Client, func()) {
+	srv := httptest.NewServer(handler)
+	client := NewClient(testKey, srv.Client())
+	client.BaseURL = srv.URL
+	client.Now = func() time.Time { return time.Unix(0, testTimestamp*1e6) }
+	return client, srv.Close
+}
+
+func checkHeaders(t *testing.T, r *http.Request) {
+	for k, want := range map[string]string{"sysCode": DefaultSysCode, "from": DefaultFrom, "msgId": "1630999224000"} {
+		if got := r.Header.Get(k); got != want {
+			t.Errorf("header %s = %q, want %q", k, got, want)
+		}
+	}
+}
+
+func TestMonitorStart(t *testing.T) {
+	client, closeFn := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/terminals/860404040006697/monitor-start" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		checkHeaders(t, r)
+		reqBody := ReqBody{}
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := base64.StdEncoding.DecodeString(reqBody.Data)
+		if string(data) != `{"cameraType":"FRONT","streamMode":0}` {
+			t.Errorf("data = %s", data)
+		}
+		if reqBody.Sign != "8b575c169362ecac7f17dadf0920eb28e87ce5ab" || reqBody.Timestamp != testTimestamp {
+			t.Errorf("reqBody = %+v", reqBody)
+		}
+		_, _ = w.Write([]byte(`{"code":0,"message":"success"}`))
+	})
+	defer closeFn()
+
+	if err := client.MonitorStart(context.Background(), "860404040006697", MonitorStartParam{CameraType: "FRONT"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRealtime(t *testing.T) {
+	client, closeFn := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		checkHeaders(t, r)
+		q := r.URL.Query()
+		if q.Get("timestamp") != "1630999224000" || q.Get("sign") != "b168371bb8a9a1a5a10865b749b6611061a675ef" {
+			t.Errorf("query = %s", r.URL.RawQuery)
+		}
+		_, _ = w.Write([]byte(`{"longitude":123.414406,"latitude":41.806038,"gpsTime":1630999224000,"runStatus":"STARTED","terminalImage":null}`))
+	})
+	defer closeFn()
+
+	location, err := client.Realtime(context.Background(), "860404040006697")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Location{Longitude: 123.414406, Latitude: 41.806038, GpsTime: 1630999224000, RunStatus: "STARTED"}
+	if *location != want {
+		t.Errorf("Realtime = %+v, want %+v", *location, want)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	cases := []struct {
+		status int
+		body   string
+		want   Error
+	}{
+		{http.StatusUnauthorized, `{"code":40101,"message":"sign error"}`, Error{StatusCode: 401, Code: 40101, Message: "sign error"}},
+		{http.StatusOK, `{"code":50001,"msg":"session expired"}`, Error{StatusCode: 200, Code: 50001, Message: "session expired"}},
+		{http.StatusBadGateway, `bad gateway`, Error{StatusCode: 502, Message: "bad gateway"}},
+	}
+	for _, c := range cases {
+		client, closeFn := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(c.status)
+			_, _ = w.Write([]byte(c.body))
+		})
+		err := client.MonitorContinue(context.Background(), "860404040006697")
+		closeFn()
+
+		apiErr := &Error{}
+		if !errors.As(err, &apiErr) {
+			t.Errorf("MonitorContinue error = %v, want *Error", err)
+			continue
+		}
+		if *apiErr != c.want {
+			t.Errorf("MonitorContinue error = %+v, want %+v", *apiErr, c.want)
+		}
+	}
+}
@@ -17,6 +17,8 @@ import (
 	"sync"
 	"time"
 
+	"go-web-study/downloader"
+
 	"github.com/elastic/go-elasticsearch/v7"
 	"github.com/elastic/go-elasticsearch/v7/esapi"
 	"github.com/spf13/viper"
@@ -42,8 +44,10 @@ type CoreConfig struct {
 }
 
 type Config struct {
-	ES   ESConfig   `json:"es" mapstructure:"es"`
-	Core CoreConfig `json:"core" mapstructure:"core"`
+	ES       ESConfig                  `json:"es" mapstructure:"es"`
+	Core     CoreConfig                `json:"core" mapstructure:"core"`
+	Throttle downloader.ThrottleConfig `json:"throttle" mapstructure:"throttle"`
+	HTTP     downloader.ClientConfig   `json:"http" mapstructure:"http"`
 }
 
 type HitsResult struct {
@@ -71,21 +75,13 @@ type AtomicInt struct {
 	lock  sync.Mutex
 }
 
-func DownloadFile(url, filename string) {
-	r, err := http.Get(url)
-	if err != nil {
-		panic(err)
-	}
-	defer r.Body.Close()
+var fetcher = downloader.NewFetcher(nil)
 
-	f, err := os.Create(filename)
-	if err != nil {
+// DownloadFile url 支持 go-getter 风格的源地址，例如 file:///mirror/xxx 或 s3::http://minio:9000/bucket/xxx
+func DownloadFile(url, filename string) {
+	if err := fetcher.FetchFile(context.Background(), url, filename); err != nil {
 		panic(err)
 	}
-	defer f.Close()
-
-	_, _ = io.Copy(f, r.Body)
-
 }
 
 func (a *AtomicInt) Increment() {
@@ -368,6 +364,12 @@ func main() {
 		log.Printf("读取配置信息为：%v", string(prettyJSON))
 	}
 
+	httpClient, err := downloader.NewClient(config.HTTP, downloader.NewThrottle(config.Throttle))
+	if err != nil {
+		log.Fatalf("初始化下载客户端失败 %v", err.Error())
+	}
+	fetcher = downloader.NewFetcher(httpClient)
+
 	downloadParentPath := "download" + time.Now().Format("20060102")
 	InitDir(downloadParentPath)
 
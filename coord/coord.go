@@ -0,0 +1,105 @@
+package coord
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/suifengtec/gocoord"
+)
+
+// Datum 坐标系
+type Datum string
+
+const (
+	// WGS84 GPS 原始坐标
+	WGS84 Datum = "WGS84"
+	// GCJ02 国测局坐标，高德、腾讯地图使用
+	GCJ02 Datum = "GCJ02"
+	// BD09 百度地图坐标
+	BD09 Datum = "BD09"
+)
+
+var Datums = []Datum{WGS84, GCJ02, BD09}
+
+// ParseDatum 不区分大小写，支持 wgs84/gcj02/bd09 及 gcj-02、bd-09 写法
+func ParseDatum(s string) (Datum, error) {
+	switch strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(s), "-", "")) {
+	case "WGS84", "":
+		return WGS84, nil
+	case "GCJ02", "AMAP", "GAODE":
+		return GCJ02, nil
+	case "BD09", "BAIDU":
+		return BD09, nil
+	}
+	return "", fmt.Errorf("unknown datum %q", s)
+}
+
+// Point 带坐标系的经纬度
+type Point struct {
+	Lon   float64 `json:"lon"`
+	Lat   float64 `json:"lat"`
+	Datum Datum   `json:"datum"`
+}
+
+// To 转换到目标坐标系，坐标系相同时原样返回，不支持的坐标系返回错误
+func (p Point) To(to Datum) (Point, error) {
+	if p.Datum == "" {
+		p.Datum = WGS84
+	}
+	if p.Datum == to {
+		return p, nil
+	}
+	pos := gocoord.Position{Lon: p.Lon, Lat: p.Lat}
+	switch p.Datum + ">" + to {
+	case WGS84 + ">" + GCJ02:
+		pos = gocoord.WGS84ToGCJ02(pos)
+	case WGS84 + ">" + BD09:
+		pos = gocoord.WGS84ToBD09(pos)
+	case GCJ02 + ">" + WGS84:
+		pos = gocoord.GCJ02ToWGS84(pos)
+	case GCJ02 + ">" + BD09:
+		pos = gocoord.GCJ02ToBD09(pos)
+	case BD09 + ">" + WGS84:
+		pos = gocoord.BD09ToWGS84(pos)
+	case BD09 + ">" + GCJ02:
+		pos = gocoord.BD09ToGCJ02(pos)
+	default:
+		return p, fmt.Errorf("unsupported conversion %s -> %s", p.Datum, to)
+	}
+	return Point{Lon: pos.Lon, Lat: pos.Lat, Datum: to}, nil
+}
+
+// convert 坐标系固定的转换，不会出错
+func convert(lon, lat float64, from, to Datum) (float64, float64) {
+	p, _ := Point{Lon: lon, Lat: lat, Datum: from}.To(to)
+	return p.Lon, p.Lat
+}
+
+func WGS84ToGCJ02(lon, lat float64) (float64, float64) {
+	return convert(lon, lat, WGS84, GCJ02)
+}
+
+func WGS84ToBD09(lon, lat float64) (float64, float64) {
+	return convert(lon, lat, WGS84, BD09)
+}
+
+func GCJ02ToWGS84(lon, lat float64) (float64, float64) {
+	return convert(lon, lat, GCJ02, WGS84)
+}
+
+func GCJ02ToBD09(lon, lat float64) (float64, float64) {
+	return convert(lon, lat, GCJ02, BD09)
+}
+
+func BD09ToWGS84(lon, lat float64) (float64, float64) {
+	return convert(lon, lat, BD09, WGS84)
+}
+
+func BD09ToGCJ02(lon, lat float64) (float64, float64) {
+	return convert(lon, lat, BD09, GCJ02)
+}
+
+// InChina 国内坐标才需要做偏移
+func InChina(lon, lat float64) bool {
+	return gocoord.IsInChina(gocoord.Position{Lon: lon, Lat: lat})
+}
@@ -0,0 +1,92 @@
+package coord
+
+import (
+	"math"
+	"testing"
+)
+
+// 天安门
+var tiananmen = Point{Lon: 116.397428, Lat: 39.90923, Datum: WGS84}
+
+func near(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+func TestTo(t *testing.T) {
+	cases := []struct {
+		to       Datum
+		lon, lat float64
+	}{
+		{WGS84, 116.397428, 39.90923},
+		{GCJ02, 116.403672, 39.910634},
+		{BD09, 116.410044, 39.916973},
+	}
+	for _, c := range cases {
+		p, err := tiananmen.To(c.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Datum != c.to || !near(p.Lon, c.lon, 1e-6) || !near(p.Lat, c.lat, 1e-6) {
+			t.Errorf("To(%s) = %+v, want %f,%f", c.to, p, c.lon, c.lat)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	// 逆转换是迭代近似，误差在 1e-5 度(约 1 米)以内
+	for _, from := range Datums {
+		for _, to := range Datums {
+			start, err := tiananmen.To(from)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := start.To(to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			back, err := p.To(from)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !near(back.Lon, start.Lon, 1e-5) || !near(back.Lat, start.Lat, 1e-5) {
+				t.Errorf("%s -> %s -> %s = %+v, want %+v", from, to, from, back, start)
+			}
+		}
+	}
+}
+
+func TestOutsideChina(t *testing.T) {
+	// 国外坐标不做偏移
+	lon, lat := WGS84ToGCJ02(2.2945, 48.8584)
+	if lon != 2.2945 || lat != 48.8584 {
+		t.Errorf("WGS84ToGCJ02 outside China = %f,%f", lon, lat)
+	}
+	if InChina(2.2945, 48.8584) || !InChina(tiananmen.Lon, tiananmen.Lat) {
+		t.Error("InChina is wrong")
+	}
+}
+
+func TestUnknownDatum(t *testing.T) {
+	if _, err := tiananmen.To("UTM"); err == nil {
+		t.Error("To(UTM) should fail")
+	}
+	if _, err := (Point{Lon: 1, Lat: 1, Datum: "UTM"}).To(WGS84); err == nil {
+		t.Error("UTM To(WGS84) should fail")
+	}
+	// 空坐标系按 WGS84 处理
+	if p, err := (Point{Lon: 1, Lat: 1}).To(WGS84); err != nil || p.Datum != WGS84 {
+		t.Errorf("empty datum To(WGS84) = %+v, %v", p, err)
+	}
+}
+
+func TestParseDatum(t *testing.T) {
+	cases := map[string]Datum{"": WGS84, "wgs84": WGS84, "GCJ-02": GCJ02, "gaode": GCJ02, "bd09": BD09, "Baidu": BD09}
+	for s, want := range cases {
+		if got, err := ParseDatum(s); err != nil || got != want {
+			t.Errorf("ParseDatum(%q) = %s, %v, want %s", s, got, err, want)
+		}
+	}
+	if _, err := ParseDatum("utm"); err == nil {
+		t.Error("ParseDatum(utm) should fail")
+	}
+}
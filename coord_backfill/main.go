@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"go-web-study/coord"
+	"go-web-study/gpslog"
+	"go-web-study/storage"
+
+	"gorm.io/gorm"
+)
+
+var dbConfig = storage.RegisterFlags(flag.CommandLine)
+
+var (
+	batch  = flag.Int("batch", 1000, "rows scanned per batch")
+	dryRun = flag.Bool("dry-run", false, "only count rows that need backfill")
+)
+
+// pair 库中的 WGS84 坐标，相同坐标只换算一次
+type pair struct {
+	Longitude float64
+	Latitude  float64
+}
+
+type row struct {
+	ID        uint64
+	Longitude float64
+	Latitude  float64
+}
+
+const (
+	missing = "(longitude_gcj IS NULL OR latitude_gcj IS NULL OR longitude_bd IS NULL OR latitude_bd IS NULL)"
+	// valid 旧表中无法解析的坐标在迁移为数值列后变成 0，这些记录保持为空，不能当作 0,0 换算
+	valid   = "(longitude BETWEEN -180 AND 180 AND latitude BETWEEN -90 AND 90 AND NOT (longitude = 0 AND latitude = 0))"
+	noDatum = "(datum IS NULL OR datum = '')"
+)
+
+func main() {
+	flag.Parse()
+	start := time.Now()
+	db := storage.MustOpen(*dbConfig)
+	// 补充主键、数值坐标列和 longitude_gcj/latitude_gcj/datum 等新列
+	if err := gpslog.Migrate(db); err != nil {
+		log.Fatalf("更新表结构失败 %v", err)
+	}
+
+	var total, invalid int64
+	db.Model(&gpslog.GPS{}).Where(missing).Where(valid).Count(&total)
+	db.Model(&gpslog.GPS{}).Where(missing).Not(valid).Count(&invalid)
+	log.Printf("需要补充坐标的记录数为%d，跳过坐标无效的记录%d条", total, invalid)
+	if *dryRun || total == 0 {
+		return
+	}
+
+	updated, err := Backfill(db, *batch, func(updated int64) {
+		log.Printf("已更新%d/%d条记录", updated, total)
+	})
+	if err != nil {
+		log.Fatalf("更新坐标失败 %v", err)
+	}
+	log.Printf("已更新%d条记录", updated)
+	log.Printf("总共耗时[%s]", time.Since(start))
+}
+
+// Backfill 按 id 顺序分批换算缺少 GCJ02/BD09 坐标的记录，并为没有 datum 的记录补充 WGS84，
+// 坐标无效的记录保持为空。游标只向前移动，每条记录最多处理一次，每批完成后回调 progress，返回更新的条数
+func Backfill(db *gorm.DB, batch int, progress func(updated int64)) (int64, error) {
+	if batch <= 0 {
+		batch = 1000
+	}
+	updated := int64(0)
+	cursor := uint64(0)
+	for {
+		var rows []row
+		err := db.Model(&gpslog.GPS{}).Select("id", "longitude", "latitude").
+			Where("id > ?", cursor).Where("(" + missing + " OR " + noDatum + ")").
+			Order("id").Limit(batch).Scan(&rows).Error
+		if err != nil {
+			return updated, fmt.Errorf("查询坐标失败 %v", err)
+		}
+		if len(rows) == 0 {
+			return updated, nil
+		}
+		cursor = rows[len(rows)-1].ID
+
+		// 相同坐标只换算一次
+		ids := make([]uint64, 0, len(rows))
+		groups := make(map[pair][]uint64)
+		var pairs []pair
+		for _, r := range rows {
+			ids = append(ids, r.ID)
+			p := pair{Longitude: r.Longitude, Latitude: r.Latitude}
+			if _, ok := groups[p]; !ok {
+				pairs = append(pairs, p)
+			}
+			groups[p] = append(groups[p], r.ID)
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			for _, p := range pairs {
+				g := gpslog.GPS{Longitude: p.Longitude, Latitude: p.Latitude}
+				g.FillCoordinates()
+				res := tx.Model(&gpslog.GPS{}).
+					Where("id IN ?", groups[p]).
+					Where(missing).Where(valid).
+					Updates(map[string]interface{}{
+						"longitude_gcj": g.LongitudeGCJ,
+						"latitude_gcj":  g.LatitudeGCJ,
+						"longitude_bd":  g.LongitudeBD,
+						"latitude_bd":   g.LatitudeBD,
+					})
+				if res.Error != nil {
+					return res.Error
+				}
+				updated += res.RowsAffected
+			}
+			return tx.Model(&gpslog.GPS{}).Where("id IN ?", ids).Where(noDatum).Update("datum", coord.WGS84).Error
+		})
+		if err != nil {
+			return updated, err
+		}
+		if progress != nil {
+			progress(updated)
+		}
+	}
+}
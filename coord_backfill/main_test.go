@@ -0,0 +1,112 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"go-web-study/coord"
+	"go-web-study/gpslog"
+	"go-web-study/storage"
+
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := storage.Open(storage.Config{DSN: "sqlite://" + filepath.Join(t.TempDir(), "gps.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gpslog.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestBackfill(t *testing.T) {
+	db := newTestDB(t)
+	rows := []gpslog.GPS{
+		{TerminalID: "a", Longitude: 123.4, Latitude: 41.8, GpsTime: 1},
+		{TerminalID: "a", Longitude: 123.4, Latitude: 41.8, GpsTime: 2},
+		{TerminalID: "a", Longitude: 123.5, Latitude: 41.9, GpsTime: 3},
+		// 旧表中无法解析的坐标迁移后为 0
+		{TerminalID: "a", Longitude: 0, Latitude: 0, GpsTime: 4},
+		{TerminalID: "a", Longitude: 200, Latitude: 10, GpsTime: 5},
+	}
+	if err := db.Create(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	batches := 0
+	updated, err := Backfill(db, 2, func(int64) { batches++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 3 || batches != 3 {
+		t.Errorf("Backfill updated %d rows in %d batches, want 3 in 3", updated, batches)
+	}
+
+	var res []gpslog.GPS
+	if err := db.Order("gps_time").Find(&res).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range res {
+		if g.Datum != coord.WGS84 {
+			t.Errorf("gps_time %d datum = %q, want WGS84", g.GpsTime, g.Datum)
+		}
+		if g.GpsTime > 3 {
+			if g.LongitudeGCJ != nil || g.LongitudeBD != nil {
+				t.Errorf("invalid coordinate %f,%f was backfilled", g.Longitude, g.Latitude)
+			}
+			continue
+		}
+		lon, lat := coord.WGS84ToGCJ02(g.Longitude, g.Latitude)
+		if g.LongitudeGCJ == nil || g.LatitudeGCJ == nil || *g.LongitudeGCJ != lon || *g.LatitudeGCJ != lat {
+			t.Errorf("gps_time %d gcj = %v,%v, want %f,%f", g.GpsTime, g.LongitudeGCJ, g.LatitudeGCJ, lon, lat)
+		}
+		if g.LongitudeBD == nil || g.LatitudeBD == nil {
+			t.Errorf("gps_time %d has no bd09 coordinate", g.GpsTime)
+		}
+	}
+
+	// 再次执行时没有需要更新的记录
+	if updated, err := Backfill(db, 1, nil); err != nil || updated != 0 {
+		t.Errorf("second Backfill = %d, %v, want 0", updated, err)
+	}
+}
+
+func TestBackfillStillMissing(t *testing.T) {
+	db := newTestDB(t)
+	rows := []gpslog.GPS{
+		{TerminalID: "a", Longitude: 123.4, Latitude: 41.8, GpsTime: 1},
+		{TerminalID: "a", Longitude: 123.5, Latitude: 41.9, GpsTime: 2},
+		{TerminalID: "a", Longitude: 123.6, Latitude: 42.0, GpsTime: 3, Datum: coord.GCJ02},
+	}
+	if err := db.Create(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 模拟换算后仍然缺少坐标的记录，游标前移后不会反复处理
+	err := db.Exec(`CREATE TRIGGER keep_missing AFTER UPDATE ON tb_gps_log WHEN NEW.gps_time = 1 AND NEW.longitude_gcj IS NOT NULL
+BEGIN UPDATE tb_gps_log SET longitude_gcj = NULL WHERE id = NEW.id; END`).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batches := 0
+	if _, err := Backfill(db, 1, func(int64) { batches++ }); err != nil {
+		t.Fatal(err)
+	}
+	if batches != 3 {
+		t.Errorf("Backfill ran %d batches, want 3", batches)
+	}
+	var res []gpslog.GPS
+	if err := db.Order("gps_time").Find(&res).Error; err != nil {
+		t.Fatal(err)
+	}
+	if res[0].LongitudeGCJ != nil || res[1].LongitudeGCJ == nil || res[2].LongitudeGCJ == nil {
+		t.Errorf("gcj longitudes = %v, %v, %v, want only the first missing", res[0].LongitudeGCJ, res[1].LongitudeGCJ, res[2].LongitudeGCJ)
+	}
+	// 只补充本批记录的 datum，已有的 datum 不变
+	if res[0].Datum != coord.WGS84 || res[2].Datum != coord.GCJ02 {
+		t.Errorf("datums = %q, %q, want WGS84, GCJ02", res[0].Datum, res[2].Datum)
+	}
+}
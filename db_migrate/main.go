@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"go-web-study/device"
+	"go-web-study/geofence"
+	"go-web-study/gpslog"
+	"go-web-study/storage"
+)
+
+var (
+	legacyTerminal = flag.String("gps-legacy-terminal", "", "set terminal_id of legacy tb_gps_log rows that have none")
+	dedupe         = flag.Bool("gps-dedupe", false, "delete tb_gps_log rows with the same terminal, time and coordinates, keeping the first one")
+	deviceDedupe   = flag.Bool("device-dedupe", false, "delete test_device rows with the same gb_device_id, keeping the latest one")
+	dryRun         = flag.Bool("dry-run", false, "only report duplicate tb_gps_log and test_device rows")
+)
+
+// 初始化或升级 tb_gps_log、tb_geofence_event 和 test_device 表结构
+func main() {
+	config := storage.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	db, err := storage.Open(*config)
+	if err != nil {
+		log.Fatalf("连接数据库失败 %v", err)
+	}
+	// 先补齐清理需要的列，唯一索引在清理之后创建
+	if err := gpslog.MigrateLegacy(db); err != nil {
+		log.Fatalf("tb_gps_log 迁移失败 %v", err)
+	}
+	if err := device.MigrateLegacy(db); err != nil {
+		log.Fatalf("test_device 迁移失败 %v", err)
+	}
+
+	groups, rows, err := gpslog.Duplicates(db)
+	if err != nil {
+		log.Fatalf("统计重复定位失败 %v", err)
+	}
+	log.Printf("tb_gps_log 同一终端同一时间的定位有%d组，多出%d条", groups, rows)
+	groups, rows, err = device.Duplicates(db)
+	if err != nil {
+		log.Fatalf("统计重复设备失败 %v", err)
+	}
+	log.Printf("test_device 国标编码重复的设备有%d组，多出%d条", groups, rows)
+	if *dryRun {
+		return
+	}
+	if *legacyTerminal != "" {
+		n, err := gpslog.SetLegacyTerminal(db, *legacyTerminal)
+		if err != nil {
+			log.Fatalf("补充终端失败 %v", err)
+		}
+		log.Printf("%d条旧记录的终端设置为%s", n, *legacyTerminal)
+	}
+	if *dedupe {
+		n, err := gpslog.RemoveDuplicates(db)
+		if err != nil {
+			log.Fatalf("删除重复定位失败 %v", err)
+		}
+		log.Printf("删除完全相同的重复定位%d条", n)
+	}
+	if err := gpslog.Migrate(db); err != nil {
+		log.Fatalf("tb_gps_log 迁移失败 %v", err)
+	}
+
+	if err := geofence.Migrate(db); err != nil {
+		log.Fatalf("tb_geofence_event 迁移失败 %v", err)
+	}
+	if *deviceDedupe {
+		n, err := device.RemoveDuplicates(db)
+		if err != nil {
+			log.Fatalf("删除重复设备失败 %v", err)
+		}
+		log.Printf("删除国标编码重复的设备%d条", n)
+	}
+	if err := device.Migrate(db); err != nil {
+		log.Fatalf("test_device 迁移失败 %v", err)
+	}
+	log.Println("数据库迁移完成")
+}
@@ -0,0 +1,192 @@
+package device
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// Catalog GB28181 目录查询结果的导出文件
+type Catalog struct {
+	CommandType string
+	Item        []DeviceInfo
+}
+
+// Text 兼容导出文件中数字和字符串两种写法的字段，如 Port、Longitude
+type Text string
+
+func (t *Text) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		*t = Text(s)
+		return nil
+	}
+	if string(b) == "null" {
+		*t = ""
+		return nil
+	}
+	*t = Text(b)
+	return nil
+}
+
+// DeviceInfo 目录中的一项，字段与 GB28181 目录查询应答的 Item 对应。
+// IsCatalog 为 1 的是行政区划、业务分组、虚拟组织等目录节点，不是设备
+type DeviceInfo struct {
+	ID              uint64 `json:"-" xml:"-" gorm:"primaryKey;autoIncrement;column:id"`
+	IsCatalog       uint8  `json:"IsCatalog" xml:"-" gorm:"-"`
+	Name            string `json:"Name" xml:"Name" gorm:"type:varchar(255);column:name"`
+	GbDeviceId      string `json:"SubDeviceID" xml:"DeviceID" gorm:"type:varchar(32);not null;column:gb_device_id;uniqueIndex:uk_gb_device_id"`
+	ParentID        string `json:"ParentID" xml:"ParentID" gorm:"type:varchar(255);column:parent_id"`
+	CivilCode       string `json:"CivilCode" xml:"CivilCode" gorm:"type:varchar(32);column:civil_code"`
+	BusinessGroupID string `json:"BusinessGroupID" xml:"BusinessGroupID" gorm:"type:varchar(32);column:business_group_id"`
+	Manufacturer    string `json:"Manufacturer" xml:"Manufacturer" gorm:"type:varchar(64);column:manufacturer"`
+	Model           string `json:"Model" xml:"Model" gorm:"type:varchar(64);column:model"`
+	Owner           string `json:"Owner" xml:"Owner" gorm:"type:varchar(64);column:owner"`
+	Address         string `json:"Address" xml:"Address" gorm:"type:varchar(255);column:address"`
+	Parental        uint8  `json:"Parental" xml:"Parental" gorm:"column:parental"`
+	IPAddress       string `json:"IPAddress" xml:"IPAddress" gorm:"type:varchar(64);column:ip_address"`
+	Port            Text   `json:"Port" xml:"Port" gorm:"type:varchar(8);column:port"`
+	// Status ON/OFF
+	Status    string `json:"Status" xml:"Status" gorm:"type:varchar(8);column:status"`
+	Latitude  Text   `json:"Latitude" xml:"Latitude" gorm:"type:varchar(32);column:latitude"`
+	Longitude Text   `json:"Longitude" xml:"Longitude" gorm:"type:varchar(32);column:longitude"`
+	// Path 所在目录的名称路径，如 /沈阳市/和平区/交警支队
+	Path string `json:"-" xml:"-" gorm:"type:varchar(512);column:path"`
+	// Active 最近一次同步的目录中是否还有该设备，从目录中消失的设备不删除，只标记为 false
+	Active    bool       `json:"-" xml:"-" gorm:"not null;default:true;column:active"`
+	RemovedAt *time.Time `json:"-" xml:"-" gorm:"column:removed_at"`
+	CreatedAt time.Time  `json:"-" xml:"-" gorm:"column:created_at"`
+	UpdatedAt time.Time  `json:"-" xml:"-" gorm:"column:updated_at"`
+}
+
+func (DeviceInfo) TableName() string {
+	return "test_device"
+}
+
+// TypeCode 国标编码第 11-13 位的类型码，行政区划编码返回空串
+func TypeCode(gbID string) string {
+	if len(gbID) != 20 {
+		return ""
+	}
+	return gbID[10:13]
+}
+
+// IsCatalogID 根据编码判断是否目录节点：2-8 位的行政区划，或类型码为 200 中心、215 业务分组、216 虚拟组织
+func IsCatalogID(gbID string) bool {
+	if len(gbID) <= 8 {
+		return true
+	}
+	switch TypeCode(gbID) {
+	case "200", "215", "216":
+		return true
+	}
+	return false
+}
+
+// LoadCatalog 读取 json 导出文件或原始 xml 目录应答，xml 文件中可以包含多个分包的 Response
+func LoadCatalog(fileName string) (*Catalog, error) {
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && trimmed[0] == '<' {
+		return ParseXMLCatalog(bytes.NewReader(content))
+	}
+	catalog := &Catalog{}
+	if err := json.Unmarshal(content, catalog); err != nil {
+		return nil, err
+	}
+	return catalog, nil
+}
+
+type xmlResponse struct {
+	CmdType    string       `xml:"CmdType"`
+	SumNum     int          `xml:"SumNum"`
+	DeviceList []DeviceInfo `xml:"DeviceList>Item"`
+}
+
+// ParseXMLCatalog 解析 <Response><CmdType>Catalog</CmdType>...</Response>，支持 GB2312 编码。
+// 分包的应答可以直接拼接在一个文件中，xml 中没有 IsCatalog，按编码推断
+func ParseXMLCatalog(r io.Reader) (*Catalog, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	catalog := &Catalog{CommandType: "Catalog"}
+	sumNum := 0
+	// 每个分包有自己的 xml 声明，需要分别按各自的编码解析
+	declaration := []byte("<?xml")
+	for i, doc := range bytes.Split(content, declaration) {
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		if i > 0 {
+			doc = append(append([]byte{}, declaration...), doc...)
+		}
+		n, err := parseXMLResponses(doc, catalog)
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			sumNum = n
+		}
+	}
+	if sumNum > 0 && len(catalog.Item) != sumNum {
+		return catalog, fmt.Errorf("catalog has %d items, SumNum is %d", len(catalog.Item), sumNum)
+	}
+	return catalog, nil
+}
+
+// parseXMLResponses 解析一个 xml 文档中的 Response，返回 SumNum
+func parseXMLResponses(doc []byte, catalog *Catalog) (int, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(doc))
+	decoder.CharsetReader = charset.NewReaderLabel
+	sumNum := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return sumNum, nil
+		}
+		if err != nil {
+			return sumNum, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "Response" {
+			continue
+		}
+		res := xmlResponse{}
+		if err := decoder.DecodeElement(&res, &start); err != nil {
+			return sumNum, err
+		}
+		if res.CmdType != "Catalog" {
+			continue
+		}
+		sumNum = res.SumNum
+		for _, item := range res.DeviceList {
+			if IsCatalogID(item.GbDeviceId) {
+				item.IsCatalog = 1
+			}
+			catalog.Item = append(catalog.Item, item)
+		}
+	}
+}
+
+// Devices 去掉目录节点，只保留设备
+func (c *Catalog) Devices() []DeviceInfo {
+	res := make([]DeviceInfo, 0, len(c.Item))
+	for _, x := range c.Item {
+		if x.IsCatalog == 0 {
+			res = append(res, x)
+		}
+	}
+	return res
+}
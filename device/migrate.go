@@ -0,0 +1,175 @@
+package device
+
+import (
+	"fmt"
+	"time"
+
+	"go-web-study/storage"
+
+	"gorm.io/gorm"
+)
+
+// deviceV2 第 2 版发布时的表结构，迁移使用固定的结构，模型以后的改动不会影响已发布的版本
+type deviceV2 struct {
+	ID         uint64    `gorm:"primaryKey;autoIncrement;column:id"`
+	Name       string    `gorm:"type:varchar(255);column:name"`
+	GbDeviceId string    `gorm:"type:varchar(32);column:gb_device_id;index:idx_gb_device_id"`
+	Latitude   string    `gorm:"type:varchar(32);column:latitude"`
+	Longitude  string    `gorm:"type:varchar(32);column:longitude"`
+	CreatedAt  time.Time `gorm:"column:created_at"`
+	UpdatedAt  time.Time `gorm:"column:updated_at"`
+}
+
+func (deviceV2) TableName() string {
+	return "test_device"
+}
+
+// deviceV3 第 3 版的表结构，国标编码唯一并增加停用标记
+type deviceV3 struct {
+	ID         uint64     `gorm:"primaryKey;autoIncrement;column:id"`
+	Name       string     `gorm:"type:varchar(255);column:name"`
+	GbDeviceId string     `gorm:"type:varchar(32);not null;column:gb_device_id;uniqueIndex:uk_gb_device_id"`
+	Latitude   string     `gorm:"type:varchar(32);column:latitude"`
+	Longitude  string     `gorm:"type:varchar(32);column:longitude"`
+	Active     bool       `gorm:"not null;default:true;column:active"`
+	RemovedAt  *time.Time `gorm:"column:removed_at"`
+	CreatedAt  time.Time  `gorm:"column:created_at"`
+	UpdatedAt  time.Time  `gorm:"column:updated_at"`
+}
+
+func (deviceV3) TableName() string {
+	return "test_device"
+}
+
+// changeLogV3 第 3 版的变更记录表
+type changeLogV3 struct {
+	ID         uint64    `gorm:"primaryKey;autoIncrement;column:id"`
+	SyncID     string    `gorm:"type:varchar(32);not null;column:sync_id;index:idx_sync_id"`
+	GbDeviceId string    `gorm:"type:varchar(32);not null;column:gb_device_id;index:idx_change_gb_device_id"`
+	Action     string    `gorm:"type:varchar(16);not null;column:action"`
+	Changes    string    `gorm:"type:text;column:changes"`
+	CreatedAt  time.Time `gorm:"column:created_at"`
+}
+
+func (changeLogV3) TableName() string {
+	return "tb_device_change_log"
+}
+
+// deviceV4 第 4 版的表结构，保存目录项的全部字段和所在目录路径
+type deviceV4 struct {
+	ID              uint64     `gorm:"primaryKey;autoIncrement;column:id"`
+	Name            string     `gorm:"type:varchar(255);column:name"`
+	GbDeviceId      string     `gorm:"type:varchar(32);not null;column:gb_device_id;uniqueIndex:uk_gb_device_id"`
+	ParentID        string     `gorm:"type:varchar(255);column:parent_id"`
+	CivilCode       string     `gorm:"type:varchar(32);column:civil_code"`
+	BusinessGroupID string     `gorm:"type:varchar(32);column:business_group_id"`
+	Manufacturer    string     `gorm:"type:varchar(64);column:manufacturer"`
+	Model           string     `gorm:"type:varchar(64);column:model"`
+	Owner           string     `gorm:"type:varchar(64);column:owner"`
+	Address         string     `gorm:"type:varchar(255);column:address"`
+	Parental        uint8      `gorm:"column:parental"`
+	IPAddress       string     `gorm:"type:varchar(64);column:ip_address"`
+	Port            string     `gorm:"type:varchar(8);column:port"`
+	Status          string     `gorm:"type:varchar(8);column:status"`
+	Latitude        string     `gorm:"type:varchar(32);column:latitude"`
+	Longitude       string     `gorm:"type:varchar(32);column:longitude"`
+	Path            string     `gorm:"type:varchar(512);column:path"`
+	Active          bool       `gorm:"not null;default:true;column:active"`
+	RemovedAt       *time.Time `gorm:"column:removed_at"`
+	CreatedAt       time.Time  `gorm:"column:created_at"`
+	UpdatedAt       time.Time  `gorm:"column:updated_at"`
+}
+
+func (deviceV4) TableName() string {
+	return "test_device"
+}
+
+// nodeV4 第 4 版的目录树表
+type nodeV4 struct {
+	ID         uint64 `gorm:"primaryKey;autoIncrement;column:id"`
+	GbDeviceId string `gorm:"type:varchar(32);not null;column:gb_device_id;uniqueIndex:uk_catalog_gb_device_id"`
+	Name       string `gorm:"type:varchar(255);column:name"`
+	ParentID   string `gorm:"type:varchar(32);column:parent_id;index:idx_catalog_parent_id"`
+	CivilCode  string `gorm:"type:varchar(32);column:civil_code"`
+	TypeCode   string `gorm:"type:varchar(8);column:type_code"`
+	Path       string `gorm:"type:varchar(512);column:path"`
+	Level      int    `gorm:"column:level"`
+	Devices    int    `gorm:"column:devices"`
+}
+
+func (nodeV4) TableName() string {
+	return "tb_device_catalog"
+}
+
+// migrations 只能追加，不能修改已发布的版本
+var migrations = []storage.Migration{
+	{Version: 1, Name: "add primary key to legacy test_device", Up: func(tx *gorm.DB) error {
+		return storage.AddLegacyPrimaryKey(tx, &DeviceInfo{}, "test_device")
+	}},
+	{Version: 2, Name: "test_device columns and gb_device_id index", Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&deviceV2{})
+	}},
+	{Version: 3, Name: "unique gb_device_id, active flag and change log", Up: uniqueGbDeviceId},
+	{Version: 4, Name: "full catalog item columns and catalog tree", Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&deviceV4{}, &nodeV4{})
+	}},
+}
+
+// uniqueGbDeviceId 之前每次导入都会整批插入，同一设备有多条记录。
+// 迁移不删除任何数据，有重复时返回错误，由运维通过 db_migrate 查看并清理后重新执行
+func uniqueGbDeviceId(tx *gorm.DB) error {
+	m := tx.Migrator()
+	if !m.HasIndex(&deviceV3{}, "uk_gb_device_id") {
+		groups, rows, err := Duplicates(tx)
+		if err != nil {
+			return err
+		}
+		if groups > 0 {
+			return fmt.Errorf("test_device has %d duplicated gb_device_id groups (%d extra rows), "+
+				"check with db_migrate -dry-run and keep the latest row of each with -device-dedupe", groups, rows)
+		}
+	}
+	if err := tx.AutoMigrate(&deviceV3{}, &changeLogV3{}); err != nil {
+		return err
+	}
+	if m.HasIndex(&deviceV3{}, "idx_gb_device_id") {
+		return m.DropIndex(&deviceV3{}, "idx_gb_device_id")
+	}
+	return nil
+}
+
+// Migrate 执行 test_device 尚未执行的迁移，记录在 device_schema_migrations 表中
+func Migrate(db *gorm.DB) error {
+	return storage.Migrate(db, "device_schema_migrations", migrations)
+}
+
+// MigrateLegacy 只执行唯一索引之前的迁移，补齐 RemoveDuplicates 需要的 id 列，db_migrate 在清理重复设备之前调用
+func MigrateLegacy(db *gorm.DB) error {
+	return storage.MigrateTo(db, "device_schema_migrations", migrations, 2)
+}
+
+// Duplicates 返回国标编码重复的分组数，以及比唯一索引多出的记录数，表不存在时都为 0
+func Duplicates(db *gorm.DB) (groups int64, rows int64, err error) {
+	if !db.Migrator().HasTable("test_device") {
+		return 0, 0, nil
+	}
+	// groups 和 rows 在 mysql 8 中是保留字
+	var res struct {
+		DupGroups int64
+		DupRows   int64
+	}
+	err = db.Raw("SELECT COUNT(*) AS dup_groups, COALESCE(SUM(n - 1), 0) AS dup_rows FROM " +
+		"(SELECT COUNT(*) AS n FROM test_device GROUP BY gb_device_id HAVING COUNT(*) > 1) t").Scan(&res).Error
+	return res.DupGroups, res.DupRows, err
+}
+
+// RemoveDuplicates 删除国标编码重复的设备，只保留最后写入的一条，返回删除的条数
+func RemoveDuplicates(db *gorm.DB) (int64, error) {
+	if !db.Migrator().HasTable("test_device") {
+		return 0, nil
+	}
+	// mysql 不允许在子查询中直接引用被删除的表，需要多包一层派生表
+	res := db.Exec("DELETE FROM test_device WHERE id NOT IN " +
+		"(SELECT id FROM (SELECT MAX(id) AS id FROM test_device GROUP BY gb_device_id) t)")
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,112 @@
+package device
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"go-web-study/coord"
+	"go-web-study/track"
+)
+
+const (
+	ReconcileOK       = "ok"
+	ReconcileMissing  = "missing"
+	ReconcileMismatch = "mismatch"
+	ReconcileExtra    = "extra"
+
+	MatchByID   = "id"
+	MatchByName = "name"
+)
+
+// CustomerRow 客户台账中的一行，Row 为表格中的行号
+type CustomerRow struct {
+	Row       int
+	GbID      string
+	Name      string
+	Longitude string
+	Latitude  string
+}
+
+// Match 客户台账一行的核对结果，Distance 为坐标偏差(米)，任一方没有坐标时为 -1
+type Match struct {
+	Row      CustomerRow
+	Device   *DeviceInfo
+	By       string
+	Status   string
+	Distance float64
+}
+
+// ReconcileConfig Tolerance 为允许的坐标偏差(米)，Datum/PlatformDatum 分别为客户台账和平台的坐标系
+type ReconcileConfig struct {
+	Tolerance     float64
+	Datum         coord.Datum
+	PlatformDatum coord.Datum
+}
+
+func parsePoint(lon, lat string, datum coord.Datum) (coord.Point, bool) {
+	x, err1 := strconv.ParseFloat(strings.TrimSpace(lon), 64)
+	y, err2 := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+	if err1 != nil || err2 != nil || (x == 0 && y == 0) {
+		return coord.Point{}, false
+	}
+	return coord.Point{Lon: x, Lat: y, Datum: datum}, true
+}
+
+// Reconcile 先按国标编码匹配，编码匹配不上时按名称匹配（只匹配平台上名称唯一的设备）。
+// 返回每行的核对结果和平台上有、台账中没有的设备
+func Reconcile(rows []CustomerRow, devices []DeviceInfo, config ReconcileConfig) ([]Match, []DeviceInfo) {
+	byID := make(map[string]*DeviceInfo, len(devices))
+	byName := make(map[string][]*DeviceInfo, len(devices))
+	for i := range devices {
+		d := &devices[i]
+		byID[d.GbDeviceId] = d
+		name := strings.TrimSpace(d.Name)
+		byName[name] = append(byName[name], d)
+	}
+	matched := make(map[string]bool, len(rows))
+	matches := make([]Match, len(rows))
+	// 先完成全部编码匹配，避免按名称匹配占用后面行按编码能匹配上的设备
+	for i, row := range rows {
+		matches[i] = Match{Row: row, Status: ReconcileMissing, Distance: -1}
+		if d, ok := byID[strings.TrimSpace(row.GbID)]; ok && row.GbID != "" && !matched[d.GbDeviceId] {
+			matches[i].Device, matches[i].By = d, MatchByID
+			matched[d.GbDeviceId] = true
+		}
+	}
+	for i, row := range rows {
+		if matches[i].Device != nil || row.Name == "" {
+			continue
+		}
+		if candidates := byName[strings.TrimSpace(row.Name)]; len(candidates) == 1 && !matched[candidates[0].GbDeviceId] {
+			matches[i].Device, matches[i].By = candidates[0], MatchByName
+			matched[candidates[0].GbDeviceId] = true
+		}
+	}
+	for i := range matches {
+		m := &matches[i]
+		if m.Device == nil {
+			continue
+		}
+		m.Status = ReconcileOK
+		p1, ok1 := parsePoint(m.Row.Longitude, m.Row.Latitude, config.Datum)
+		p2, ok2 := parsePoint(string(m.Device.Longitude), string(m.Device.Latitude), config.PlatformDatum)
+		if ok1 && ok2 {
+			m.Distance = track.Haversine(p1, p2)
+			if m.Distance > config.Tolerance {
+				m.Status = ReconcileMismatch
+			}
+		}
+	}
+
+	var extra []DeviceInfo
+	for _, d := range devices {
+		if !matched[d.GbDeviceId] {
+			extra = append(extra, d)
+		}
+	}
+	sort.Slice(extra, func(i, j int) bool {
+		return extra[i].GbDeviceId < extra[j].GbDeviceId
+	})
+	return matches, extra
+}
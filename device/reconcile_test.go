@@ -0,0 +1,95 @@
+package device
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"go-web-study/coord"
+)
+
+func TestReconcile(t *testing.T) {
+	devices := []DeviceInfo{
+		{GbDeviceId: "c", Name: "北门", Longitude: "123.414406", Latitude: "41.806038"},
+		{GbDeviceId: "a", Name: "南门", Longitude: "123.414406", Latitude: "41.806038"},
+		{GbDeviceId: "b", Name: "大厅", Longitude: "123.414406", Latitude: "41.806038"},
+		{GbDeviceId: "d", Name: "仓库"},
+		{GbDeviceId: "e", Name: "仓库"},
+		{GbDeviceId: "f", Name: "停车场", Longitude: "0", Latitude: "0"},
+		{GbDeviceId: "g", Name: "机房"},
+	}
+	rows := []CustomerRow{
+		// 编码和坐标都一致
+		{Row: 2, GbID: " a ", Name: "南门", Longitude: "123.414406", Latitude: "41.806038"},
+		// 编码匹配不上时按名称匹配，坐标偏差约 111 米
+		{Row: 3, GbID: "x", Name: "大厅", Longitude: "123.414406", Latitude: "41.807038"},
+		// 名称在平台上重复，不按名称匹配
+		{Row: 4, Name: "仓库"},
+		// 名称匹配的设备被后面按编码匹配的行占用
+		{Row: 5, Name: "北门", Longitude: "123.414406", Latitude: "41.806038"},
+		{Row: 6, GbID: "c", Name: "北门(改名)"},
+		// 平台坐标为 0,0 时视为没有坐标
+		{Row: 7, GbID: "f", Longitude: "123.414406", Latitude: "41.806038"},
+		{Row: 8, GbID: "z", Name: "不存在"},
+	}
+	want := []struct {
+		id       string
+		by       string
+		status   string
+		distance float64
+	}{
+		{"a", MatchByID, ReconcileOK, 0},
+		{"b", MatchByName, ReconcileMismatch, 111},
+		{"", "", ReconcileMissing, -1},
+		{"", "", ReconcileMissing, -1},
+		{"c", MatchByID, ReconcileOK, -1},
+		{"f", MatchByID, ReconcileOK, -1},
+		{"", "", ReconcileMissing, -1},
+	}
+
+	matches, extra := Reconcile(rows, devices, ReconcileConfig{Tolerance: 50, Datum: coord.WGS84, PlatformDatum: coord.WGS84})
+	if len(matches) != len(rows) {
+		t.Fatalf("%d matches, want %d", len(matches), len(rows))
+	}
+	for i, w := range want {
+		m := matches[i]
+		id := ""
+		if m.Device != nil {
+			id = m.Device.GbDeviceId
+		}
+		if id != w.id || m.By != w.by || m.Status != w.status || m.Row.Row != rows[i].Row || math.Abs(m.Distance-w.distance) > 1 {
+			t.Errorf("row %d = %s %s %s %.1f, want %s %s %s %.0f", rows[i].Row, id, m.By, m.Status, m.Distance, w.id, w.by, w.status, w.distance)
+		}
+	}
+	var extraIDs []string
+	for _, d := range extra {
+		extraIDs = append(extraIDs, d.GbDeviceId)
+	}
+	if got, want := fmt.Sprint(extraIDs), "[d e g]"; got != want {
+		t.Errorf("extra = %s, want %s", got, want)
+	}
+}
+
+func TestReconcileDatum(t *testing.T) {
+	gcj, err := coord.Point{Lon: 123.414406, Lat: 41.806038, Datum: coord.WGS84}.To(coord.GCJ02)
+	if err != nil {
+		t.Fatal(err)
+	}
+	devices := []DeviceInfo{{GbDeviceId: "a", Longitude: Text(fmt.Sprint(gcj.Lon)), Latitude: Text(fmt.Sprint(gcj.Lat))}}
+	rows := []CustomerRow{{Row: 2, GbID: "a", Longitude: "123.414406", Latitude: "41.806038"}}
+
+	// 平台使用 GCJ02 时换算后与台账的 WGS84 坐标一致，按同一坐标系比较则相差数百米
+	tests := []struct {
+		platform coord.Datum
+		status   string
+	}{
+		{coord.GCJ02, ReconcileOK},
+		{coord.WGS84, ReconcileMismatch},
+	}
+	for _, tt := range tests {
+		matches, _ := Reconcile(rows, devices, ReconcileConfig{Tolerance: 10, Datum: coord.WGS84, PlatformDatum: tt.platform})
+		if m := matches[0]; m.Status != tt.status {
+			t.Errorf("platform %s: status = %s, distance %.1f, want %s", tt.platform, m.Status, m.Distance, tt.status)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package device
+
+import (
+	"context"
+
+	"go-web-study/storage"
+
+	"gorm.io/gorm"
+)
+
+// Repository 设备表的读写
+type Repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) DB() *gorm.DB {
+	return r.db
+}
+
+func (r *Repository) All(ctx context.Context) ([]DeviceInfo, error) {
+	var devices []DeviceInfo
+	err := r.db.WithContext(ctx).Order("gb_device_id").Find(&devices).Error
+	return devices, err
+}
+
+// Active 当前目录中的设备
+func (r *Repository) Active(ctx context.Context) ([]DeviceInfo, error) {
+	var devices []DeviceInfo
+	err := r.db.WithContext(ctx).Where("active = ?", true).Order("gb_device_id").Find(&devices).Error
+	return devices, err
+}
+
+// FindByGbDeviceId 没有找到时返回 nil
+func (r *Repository) FindByGbDeviceId(ctx context.Context, gbDeviceId string) (*DeviceInfo, error) {
+	var devices []DeviceInfo
+	err := r.db.WithContext(ctx).Where("gb_device_id = ?", gbDeviceId).Limit(1).Find(&devices).Error
+	if err != nil || len(devices) == 0 {
+		return nil, err
+	}
+	return &devices[0], nil
+}
+
+func (r *Repository) CreateBatch(ctx context.Context, devices []DeviceInfo, batchSize int) error {
+	if len(devices) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).CreateInBatches(devices, storage.BatchSize(r.db, &DeviceInfo{}, batchSize)).Error
+}
@@ -0,0 +1,244 @@
+package device
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"go-web-study/storage"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	ActionAdded       = "added"
+	ActionUpdated     = "updated"
+	ActionRemoved     = "removed"
+	ActionReactivated = "reactivated"
+)
+
+// ChangeLog 每次同步对单个设备的变更记录
+type ChangeLog struct {
+	ID         uint64    `gorm:"primaryKey;autoIncrement;column:id"`
+	SyncID     string    `gorm:"type:varchar(32);not null;column:sync_id;index:idx_sync_id"`
+	GbDeviceId string    `gorm:"type:varchar(32);not null;column:gb_device_id;index:idx_change_gb_device_id"`
+	Action     string    `gorm:"type:varchar(16);not null;column:action"`
+	Changes    string    `gorm:"type:text;column:changes"`
+	CreatedAt  time.Time `gorm:"column:created_at"`
+}
+
+func (ChangeLog) TableName() string {
+	return "tb_device_change_log"
+}
+
+// FieldChange 单个字段的变化
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Change 目录与库中记录的差异，Old 为空表示新增
+type Change struct {
+	Action string
+	Old    *DeviceInfo
+	New    DeviceInfo
+	Fields []FieldChange
+}
+
+// Plan 一次同步要执行的变更
+type Plan struct {
+	Added     []Change
+	Updated   []Change
+	Removed   []DeviceInfo
+	Unchanged int
+}
+
+func (p Plan) Empty() bool {
+	return len(p.Added) == 0 && len(p.Updated) == 0 && len(p.Removed) == 0
+}
+
+// compareFields 比较目录中维护的字段，数据库自己的 ID、Active、时间等字段不参与比较
+func compareFields(old, new DeviceInfo) []FieldChange {
+	var res []FieldChange
+	add := func(field, o, n string) {
+		if o != n {
+			res = append(res, FieldChange{Field: field, Old: o, New: n})
+		}
+	}
+	oldColumns, newColumns := old.columns(), new.columns()
+	for _, column := range syncColumns {
+		add(column, fmt.Sprint(oldColumns[column]), fmt.Sprint(newColumns[column]))
+	}
+	return res
+}
+
+// syncColumns 以目录为准同步的列，顺序即差异输出的顺序
+var syncColumns = []string{"name", "parent_id", "civil_code", "business_group_id", "manufacturer", "model", "owner",
+	"address", "parental", "ip_address", "port", "status", "latitude", "longitude", "path"}
+
+func (d DeviceInfo) columns() map[string]interface{} {
+	return map[string]interface{}{
+		"name":              d.Name,
+		"parent_id":         d.ParentID,
+		"civil_code":        d.CivilCode,
+		"business_group_id": d.BusinessGroupID,
+		"manufacturer":      d.Manufacturer,
+		"model":             d.Model,
+		"owner":             d.Owner,
+		"address":           d.Address,
+		"parental":          d.Parental,
+		"ip_address":        d.IPAddress,
+		"port":              string(d.Port),
+		"status":            d.Status,
+		"latitude":          string(d.Latitude),
+		"longitude":         string(d.Longitude),
+		"path":              d.Path,
+	}
+}
+
+// Diff 以 GbDeviceId 为键比较库中记录和新的目录，目录中重复的设备以最后一条为准。
+// 已停用的设备重新出现在目录中时标记为 reactivated
+func Diff(existing, incoming []DeviceInfo) Plan {
+	plan := Plan{}
+	current := make(map[string]*DeviceInfo, len(existing))
+	for i := range existing {
+		current[existing[i].GbDeviceId] = &existing[i]
+	}
+	latest := make(map[string]DeviceInfo, len(incoming))
+	var ids []string
+	for _, d := range incoming {
+		if _, ok := latest[d.GbDeviceId]; !ok {
+			ids = append(ids, d.GbDeviceId)
+		}
+		latest[d.GbDeviceId] = d
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		d := latest[id]
+		old, ok := current[id]
+		if !ok {
+			plan.Added = append(plan.Added, Change{Action: ActionAdded, New: d})
+			continue
+		}
+		fields := compareFields(*old, d)
+		switch {
+		case !old.Active:
+			plan.Updated = append(plan.Updated, Change{Action: ActionReactivated, Old: old, New: d, Fields: fields})
+		case len(fields) > 0:
+			plan.Updated = append(plan.Updated, Change{Action: ActionUpdated, Old: old, New: d, Fields: fields})
+		default:
+			plan.Unchanged++
+		}
+	}
+	for _, d := range existing {
+		if _, ok := latest[d.GbDeviceId]; !ok && d.Active {
+			plan.Removed = append(plan.Removed, d)
+		}
+	}
+	return plan
+}
+
+// WritePlan 输出同步前的差异
+func WritePlan(w io.Writer, plan Plan) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACTION\tGB_DEVICE_ID\tNAME\tCHANGES")
+	for _, c := range plan.Added {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t\n", c.Action, c.New.GbDeviceId, c.New.Name)
+	}
+	for _, c := range plan.Updated {
+		changes := ""
+		for i, f := range c.Fields {
+			if i > 0 {
+				changes += "; "
+			}
+			changes += fmt.Sprintf("%s: %q -> %q", f.Field, f.Old, f.New)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", c.Action, c.New.GbDeviceId, c.New.Name, changes)
+	}
+	for _, d := range plan.Removed {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t\n", ActionRemoved, d.GbDeviceId, d.Name)
+	}
+	fmt.Fprintf(tw, "\nadded %d, updated %d, removed %d, unchanged %d\n",
+		len(plan.Added), len(plan.Updated), len(plan.Removed), plan.Unchanged)
+	return tw.Flush()
+}
+
+// Apply 在一个事务中重新比较库中记录和目录并执行同步，写入变更记录，返回本次同步的 syncID 和实际执行的变更。
+// 比较前锁住设备表中的记录，同时执行的同步会等待前一个提交，不会重复插入
+func (r *Repository) Apply(ctx context.Context, incoming []DeviceInfo, batchSize int) (string, Plan, error) {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	// 设备表的列最多，按设备表限制后变更记录和停用的 id 列表也不会超过占位符上限
+	batchSize = storage.BatchSize(r.db, &DeviceInfo{}, batchSize)
+	now := time.Now()
+	syncID := now.Format("20060102150405.000000")
+	var plan Plan
+	var logs []ChangeLog
+	newLog := func(gbDeviceId, action string, changes interface{}) {
+		content := ""
+		if fields, ok := changes.([]FieldChange); changes != nil && (!ok || len(fields) > 0) {
+			b, _ := json.Marshal(changes)
+			content = string(b)
+		}
+		logs = append(logs, ChangeLog{SyncID: syncID, GbDeviceId: gbDeviceId, Action: action, Changes: content})
+	}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing []DeviceInfo
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Order("gb_device_id").Find(&existing).Error; err != nil {
+			return err
+		}
+		plan = Diff(existing, incoming)
+
+		added := make([]DeviceInfo, 0, len(plan.Added))
+		for _, c := range plan.Added {
+			d := c.New
+			d.ID, d.Active, d.RemovedAt = 0, true, nil
+			added = append(added, d)
+			newLog(d.GbDeviceId, c.Action, d)
+		}
+		if len(added) > 0 {
+			if err := tx.CreateInBatches(added, batchSize).Error; err != nil {
+				return err
+			}
+		}
+		for _, c := range plan.Updated {
+			updates := c.New.columns()
+			updates["active"] = true
+			updates["removed_at"] = nil
+			if err := tx.Model(&DeviceInfo{}).Where("id = ?", c.Old.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+			newLog(c.New.GbDeviceId, c.Action, c.Fields)
+		}
+		ids := make([]uint64, 0, len(plan.Removed))
+		for _, d := range plan.Removed {
+			ids = append(ids, d.ID)
+			newLog(d.GbDeviceId, ActionRemoved, nil)
+		}
+		for start := 0; start < len(ids); start += batchSize {
+			end := start + batchSize
+			if end > len(ids) {
+				end = len(ids)
+			}
+			err := tx.Model(&DeviceInfo{}).Where("id IN ?", ids[start:end]).
+				Updates(map[string]interface{}{"active": false, "removed_at": now}).Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(logs, batchSize).Error
+	})
+	return syncID, plan, err
+}
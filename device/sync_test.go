@@ -0,0 +1,305 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"go-web-study/storage"
+
+	"gorm.io/gorm"
+)
+
+func newTestRepository(t *testing.T) *Repository {
+	t.Helper()
+	db, err := storage.Open(storage.Config{DSN: "sqlite://" + filepath.Join(t.TempDir(), "device.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return NewRepository(db)
+}
+
+func ids(devices []DeviceInfo) []string {
+	var res []string
+	for _, d := range devices {
+		res = append(res, d.GbDeviceId)
+	}
+	return res
+}
+
+func changeIDs(changes []Change) []string {
+	var res []string
+	for _, c := range changes {
+		res = append(res, c.Action+":"+c.New.GbDeviceId)
+	}
+	return res
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDiff(t *testing.T) {
+	existing := []DeviceInfo{
+		{ID: 1, GbDeviceId: "a", Name: "A", Active: true},
+		{ID: 2, GbDeviceId: "b", Name: "B", Active: true},
+		{ID: 3, GbDeviceId: "c", Name: "C", Active: true},
+		{ID: 4, GbDeviceId: "d", Name: "D", Active: false},
+		{ID: 5, GbDeviceId: "e", Name: "E", Active: false},
+	}
+	incoming := []DeviceInfo{
+		{GbDeviceId: "a", Name: "A"},
+		{GbDeviceId: "b", Name: "B1"},
+		// 目录中重复的设备以最后一条为准
+		{GbDeviceId: "b", Name: "B2"},
+		{GbDeviceId: "d", Name: "D"},
+		{GbDeviceId: "f", Name: "F"},
+	}
+	plan := Diff(existing, incoming)
+
+	if got, want := changeIDs(plan.Added), []string{"added:f"}; !equal(got, want) {
+		t.Errorf("Added = %v, want %v", got, want)
+	}
+	if got, want := changeIDs(plan.Updated), []string{"updated:b", "reactivated:d"}; !equal(got, want) {
+		t.Errorf("Updated = %v, want %v", got, want)
+	}
+	// 已停用的 e 不会再次停用
+	if got, want := ids(plan.Removed), []string{"c"}; !equal(got, want) {
+		t.Errorf("Removed = %v, want %v", got, want)
+	}
+	if plan.Unchanged != 1 {
+		t.Errorf("Unchanged = %d, want 1", plan.Unchanged)
+	}
+	fields := plan.Updated[0].Fields
+	if len(fields) != 1 || fields[0] != (FieldChange{Field: "name", Old: "B", New: "B2"}) {
+		t.Errorf("Fields = %+v, want name B -> B2", fields)
+	}
+	if plan.Empty() || !Diff(existing[:1], incoming[:1]).Empty() {
+		t.Error("Empty() wrong")
+	}
+}
+
+func TestApply(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	syncs := []struct {
+		incoming []DeviceInfo
+		added    int
+		updated  int
+		removed  int
+		active   []string
+	}{
+		{
+			incoming: []DeviceInfo{{GbDeviceId: "a", Name: "A"}, {GbDeviceId: "b", Name: "B"}, {GbDeviceId: "c", Name: "C"}},
+			added:    3,
+			active:   []string{"a", "b", "c"},
+		},
+		{
+			incoming: []DeviceInfo{{GbDeviceId: "a", Name: "A"}, {GbDeviceId: "b", Name: "B1"}},
+			updated:  1,
+			removed:  1,
+			active:   []string{"a", "b"},
+		},
+		{
+			incoming: []DeviceInfo{{GbDeviceId: "a", Name: "A"}, {GbDeviceId: "b", Name: "B1"}, {GbDeviceId: "c", Name: "C"}},
+			updated:  1,
+			active:   []string{"a", "b", "c"},
+		},
+		// 重复同步没有变更
+		{
+			incoming: []DeviceInfo{{GbDeviceId: "a", Name: "A"}, {GbDeviceId: "b", Name: "B1"}, {GbDeviceId: "c", Name: "C"}},
+			active:   []string{"a", "b", "c"},
+		},
+	}
+	for i, s := range syncs {
+		// batchSize 为 1 时每条记录单独插入
+		_, plan, err := repo.Apply(ctx, s.incoming, 1)
+		if err != nil {
+			t.Fatalf("sync %d: %v", i, err)
+		}
+		if len(plan.Added) != s.added || len(plan.Updated) != s.updated || len(plan.Removed) != s.removed {
+			t.Errorf("sync %d: added %d, updated %d, removed %d, want %d, %d, %d", i,
+				len(plan.Added), len(plan.Updated), len(plan.Removed), s.added, s.updated, s.removed)
+		}
+		active, err := repo.Active(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(active); !equal(got, s.active) {
+			t.Errorf("sync %d: active = %v, want %v", i, got, s.active)
+		}
+	}
+
+	all, err := repo.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 {
+		t.Errorf("%d rows in test_device, want 3", len(all))
+	}
+	var actions []string
+	if err := repo.DB().Model(&ChangeLog{}).Order("id").Pluck("action", &actions).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"added", "added", "added", "updated", "removed", "reactivated"}
+	if !equal(actions, want) {
+		t.Errorf("change log = %v, want %v", actions, want)
+	}
+}
+
+func TestApplyRediffs(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	incoming := []DeviceInfo{{GbDeviceId: "a", Name: "A"}}
+
+	// 预览之后另一个同步已经插入了同一设备
+	preview, err := repo.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := repo.Apply(ctx, incoming, 100); err != nil {
+		t.Fatal(err)
+	}
+	if plan := Diff(preview, incoming); len(plan.Added) != 1 {
+		t.Fatalf("preview added %d, want 1", len(plan.Added))
+	}
+	_, plan, err := repo.Apply(ctx, incoming, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Added) != 0 || plan.Unchanged != 1 {
+		t.Errorf("second Apply added %d, unchanged %d, want 0, 1", len(plan.Added), plan.Unchanged)
+	}
+}
+
+func TestMigrateDuplicates(t *testing.T) {
+	db, err := storage.Open(storage.Config{DSN: "sqlite://" + filepath.Join(t.TempDir(), "device.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 升级前每次导入都整批插入
+	if err := db.AutoMigrate(&deviceV2{}); err != nil {
+		t.Fatal(err)
+	}
+	rows := []deviceV2{{GbDeviceId: "a", Name: "A1"}, {GbDeviceId: "a", Name: "A2"}, {GbDeviceId: "b", Name: "B"}}
+	if err := db.Create(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	count := func() int64 {
+		var n int64
+		if err := db.Model(&DeviceInfo{}).Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	if err := Migrate(db); err == nil {
+		t.Fatal("Migrate succeeded with duplicate gb_device_id")
+	}
+	if n := count(); n != 3 {
+		t.Fatalf("Migrate deleted rows, %d left, want 3", n)
+	}
+	if groups, dup, err := Duplicates(db); err != nil || groups != 1 || dup != 1 {
+		t.Errorf("Duplicates = %d, %d, %v, want 1, 1", groups, dup, err)
+	}
+	if n, err := RemoveDuplicates(db); err != nil || n != 1 {
+		t.Errorf("RemoveDuplicates = %d, %v, want 1", n, err)
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	if err := db.Model(&DeviceInfo{}).Order("gb_device_id").Pluck("name", &names).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !equal(names, []string{"A2", "B"}) {
+		t.Errorf("names = %v, want the latest row of each device", names)
+	}
+	m := db.Migrator()
+	if !m.HasIndex(&DeviceInfo{}, "uk_gb_device_id") || m.HasIndex(&DeviceInfo{}, "idx_gb_device_id") {
+		t.Error("uk_gb_device_id should replace idx_gb_device_id")
+	}
+	if !m.HasTable(&ChangeLog{}) || !m.HasTable(&Node{}) {
+		t.Error("change log or catalog table missing")
+	}
+}
+
+func TestApplyBatchSize(t *testing.T) {
+	repo := newTestRepository(t)
+	// 每行 21 列，5000 行一批会超过占位符上限
+	size := storage.BatchSize(repo.DB(), &DeviceInfo{}, 5000)
+	if size >= 5000 || size*21 > 32766 {
+		t.Errorf("BatchSize = %d, want at most %d", size, 32766/21)
+	}
+	incoming := make([]DeviceInfo, 0, 5000)
+	for i := 0; i < 5000; i++ {
+		incoming = append(incoming, DeviceInfo{GbDeviceId: fmt.Sprintf("%020d", i)})
+	}
+	_, plan, err := repo.Apply(context.Background(), incoming, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Added) != len(incoming) {
+		t.Errorf("added %d, want %d", len(plan.Added), len(incoming))
+	}
+}
+
+func TestMigrateLegacyDedupe(t *testing.T) {
+	db, err := storage.Open(storage.Config{DSN: "sqlite://" + filepath.Join(t.TempDir(), "device.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 迁移系统之前的表没有记录任何版本
+	if err := db.Exec("CREATE TABLE `test_device` (`id` integer PRIMARY KEY AUTOINCREMENT, `name` varchar(255), `gb_device_id` varchar(32))").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("INSERT INTO test_device (name, gb_device_id) VALUES ('A1', 'a'), ('A2', 'a')").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// db_migrate 的顺序：补齐列，清理重复，再执行全部迁移
+	if err := MigrateLegacy(db); err != nil {
+		t.Fatal(err)
+	}
+	if db.Migrator().HasTable(&ChangeLog{}) {
+		t.Error("MigrateLegacy ran migrations after version 2")
+	}
+	if n, err := RemoveDuplicates(db); err != nil || n != 1 {
+		t.Errorf("RemoveDuplicates = %d, %v, want 1", n, err)
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	// 固定的迁移结构与当前模型一致
+	m := db.Migrator()
+	for _, model := range []interface{}{&DeviceInfo{}, &Node{}, &ChangeLog{}} {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatal(err)
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !m.HasColumn(model, field.DBName) {
+				t.Errorf("%s has no column %s after Migrate", stmt.Schema.Table, field.DBName)
+			}
+		}
+		for _, idx := range stmt.Schema.ParseIndexes() {
+			if !m.HasIndex(model, idx.Name) {
+				t.Errorf("%s has no index %s after Migrate", stmt.Schema.Table, idx.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"go-web-study/storage"
+
+	"gorm.io/gorm"
+)
+
+// Node 目录节点，保存重建后的层级关系，ParentID 为解析出的直接上级
+type Node struct {
+	ID         uint64 `gorm:"primaryKey;autoIncrement;column:id"`
+	GbDeviceId string `gorm:"type:varchar(32);not null;column:gb_device_id;uniqueIndex:uk_catalog_gb_device_id"`
+	Name       string `gorm:"type:varchar(255);column:name"`
+	ParentID   string `gorm:"type:varchar(32);column:parent_id;index:idx_catalog_parent_id"`
+	CivilCode  string `gorm:"type:varchar(32);column:civil_code"`
+	TypeCode   string `gorm:"type:varchar(8);column:type_code"`
+	Path       string `gorm:"type:varchar(512);column:path"`
+	Level      int    `gorm:"column:level"`
+	Devices    int    `gorm:"column:devices"`
+}
+
+func (Node) TableName() string {
+	return "tb_device_catalog"
+}
+
+type TreeNode struct {
+	Item     DeviceInfo
+	Parent   *TreeNode
+	Children []*TreeNode
+}
+
+// Tree 由目录项重建的目录树，设备挂在所属目录节点下
+type Tree struct {
+	Roots []*TreeNode
+	nodes map[string]*TreeNode
+}
+
+// parentCandidates 按优先级列出可能的上级：ParentID（多个上级以 / 分隔，取最后一个）、
+// 业务分组、行政区划；行政区划节点的上级为去掉最后两位的编码
+func parentCandidates(item DeviceInfo) []string {
+	var res []string
+	parents := strings.Split(item.ParentID, "/")
+	for i := len(parents) - 1; i >= 0; i-- {
+		if p := strings.TrimSpace(parents[i]); p != "" {
+			res = append(res, p)
+		}
+	}
+	if item.BusinessGroupID != "" {
+		res = append(res, item.BusinessGroupID)
+	}
+	if item.CivilCode != "" {
+		res = append(res, item.CivilCode)
+	}
+	if id := item.GbDeviceId; len(id) <= 8 {
+		for n := len(id) - 2; n >= 2; n -= 2 {
+			res = append(res, id[:n])
+		}
+	}
+	return res
+}
+
+// BuildTree 目录中找不到上级的节点作为根节点，成环的关系会被断开
+func BuildTree(items []DeviceInfo) *Tree {
+	t := &Tree{nodes: make(map[string]*TreeNode, len(items))}
+	var order []*TreeNode
+	for _, item := range items {
+		if _, ok := t.nodes[item.GbDeviceId]; ok {
+			continue
+		}
+		n := &TreeNode{Item: item}
+		t.nodes[item.GbDeviceId] = n
+		order = append(order, n)
+	}
+	for _, n := range order {
+		for _, id := range parentCandidates(n.Item) {
+			parent, ok := t.nodes[id]
+			if !ok || parent == n || parent.Item.IsCatalog == 0 || t.isDescendant(parent, n) {
+				continue
+			}
+			n.Parent = parent
+			parent.Children = append(parent.Children, n)
+			break
+		}
+		if n.Parent == nil {
+			t.Roots = append(t.Roots, n)
+		}
+	}
+	sortNodes(t.Roots)
+	for _, n := range order {
+		sortNodes(n.Children)
+	}
+	return t
+}
+
+// isDescendant n 是否在 ancestor 的子树中
+func (t *Tree) isDescendant(n, ancestor *TreeNode) bool {
+	for p := n; p != nil; p = p.Parent {
+		if p == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// sortNodes 目录在前，同类按编码排序
+func sortNodes(nodes []*TreeNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Item.IsCatalog != nodes[j].Item.IsCatalog {
+			return nodes[i].Item.IsCatalog > nodes[j].Item.IsCatalog
+		}
+		return nodes[i].Item.GbDeviceId < nodes[j].Item.GbDeviceId
+	})
+}
+
+// Path 所在目录的名称路径，不包含自身
+func (t *Tree) Path(gbID string) string {
+	n, ok := t.nodes[gbID]
+	if !ok {
+		return ""
+	}
+	var names []string
+	for p := n.Parent; p != nil; p = p.Parent {
+		names = append(names, p.Item.Name)
+	}
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return "/" + strings.Join(names, "/")
+}
+
+// Nodes 目录节点列表，Devices 为子树中的设备数
+func (t *Tree) Nodes() []Node {
+	var res []Node
+	var walk func(n *TreeNode, level int) int
+	walk = func(n *TreeNode, level int) int {
+		if n.Item.IsCatalog == 0 {
+			return 1
+		}
+		i := len(res)
+		node := Node{
+			GbDeviceId: n.Item.GbDeviceId,
+			Name:       n.Item.Name,
+			CivilCode:  n.Item.CivilCode,
+			TypeCode:   TypeCode(n.Item.GbDeviceId),
+			Path:       t.Path(n.Item.GbDeviceId),
+			Level:      level,
+		}
+		if n.Parent != nil {
+			node.ParentID = n.Parent.Item.GbDeviceId
+		}
+		res = append(res, node)
+		devices := 0
+		for _, c := range n.Children {
+			devices += walk(c, level+1)
+		}
+		res[i].Devices = devices
+		return devices
+	}
+	for _, n := range t.Roots {
+		walk(n, 0)
+	}
+	return res
+}
+
+// Write 缩进输出目录树，devices 为 false 时只输出目录节点
+func (t *Tree) Write(w io.Writer, devices bool) error {
+	var walk func(n *TreeNode, depth int) error
+	walk = func(n *TreeNode, depth int) error {
+		if n.Item.IsCatalog == 0 && !devices {
+			return nil
+		}
+		status := ""
+		if n.Item.IsCatalog == 0 {
+			status = " " + n.Item.Status
+		}
+		if _, err := fmt.Fprintf(w, "%s%s %s%s\n", strings.Repeat("  ", depth), n.Item.GbDeviceId, n.Item.Name, status); err != nil {
+			return err
+		}
+		for _, c := range n.Children {
+			if err := walk(c, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, n := range t.Roots {
+		if err := walk(n, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplaceNodes 目录节点以最新一次同步为准整体替换
+func (r *Repository) ReplaceNodes(ctx context.Context, nodes []Node, batchSize int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&Node{}).Error; err != nil {
+			return err
+		}
+		if len(nodes) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(nodes, storage.BatchSize(tx, &Node{}, batchSize)).Error
+	})
+}
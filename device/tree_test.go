@@ -0,0 +1,212 @@
+package device
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+const (
+	district = "210102"
+	group    = "21010200002150000001"
+	orgA     = "21010200002160000001"
+	orgB     = "21010200002160000002"
+	camera1  = "21010200001320000001"
+	camera2  = "21010200001320000002"
+	orphan   = "21010200001320000003"
+)
+
+func catalogItem(id, name, parentID string) DeviceInfo {
+	item := DeviceInfo{GbDeviceId: id, Name: name, ParentID: parentID}
+	if IsCatalogID(id) {
+		item.IsCatalog = 1
+	}
+	return item
+}
+
+// xmlPart 一个分包的目录应答
+func xmlPart(t *testing.T, encoding string, sumNum int, items ...DeviceInfo) []byte {
+	b := strings.Builder{}
+	b.WriteString(`<?xml version="1.0" encoding="` + encoding + `"?>` + "\n")
+	b.WriteString("<Response>\n<CmdType>Catalog</CmdType>\n<SN>1</SN>\n<DeviceID>21010200002000000001</DeviceID>\n")
+	b.WriteString("<SumNum>" + strconv.Itoa(sumNum) + "</SumNum>\n")
+	b.WriteString(`<DeviceList Num="` + strconv.Itoa(len(items)) + `">` + "\n")
+	for _, item := range items {
+		b.WriteString("<Item><DeviceID>" + item.GbDeviceId + "</DeviceID><Name>" + item.Name + "</Name><ParentID>" + item.ParentID + "</ParentID><Status>ON</Status></Item>\n")
+	}
+	b.WriteString("</DeviceList>\n</Response>\n")
+	if encoding == "UTF-8" {
+		return []byte(b.String())
+	}
+	res, err := simplifiedchinese.GBK.NewEncoder().Bytes([]byte(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestParseXMLCatalog(t *testing.T) {
+	keepalive := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Notify><CmdType>Keepalive</CmdType><SN>2</SN></Notify>
+`)
+	var content []byte
+	content = append(content, xmlPart(t, "GB2312", 3, catalogItem(district, "和平区", ""), catalogItem(group, "交警支队", district))...)
+	content = append(content, keepalive...)
+	content = append(content, xmlPart(t, "UTF-8", 3, catalogItem(camera1, "中山路口", group))...)
+
+	catalog, err := ParseXMLCatalog(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{district + " 和平区 1", group + " 交警支队 1", camera1 + " 中山路口 0"}
+	if len(catalog.Item) != len(want) {
+		t.Fatalf("%d items, want %d", len(catalog.Item), len(want))
+	}
+	for i, item := range catalog.Item {
+		got := item.GbDeviceId + " " + item.Name + " " + strconv.Itoa(int(item.IsCatalog))
+		if got != want[i] {
+			t.Errorf("item %d = %s, want %s", i, got, want[i])
+		}
+	}
+	if devices := catalog.Devices(); len(devices) != 1 || devices[0].Status != "ON" {
+		t.Errorf("Devices = %+v, want the camera", devices)
+	}
+
+	// 分包缺失时条数与 SumNum 不一致
+	content = xmlPart(t, "GB2312", 3, catalogItem(district, "和平区", ""))
+	if _, err := ParseXMLCatalog(bytes.NewReader(content)); err == nil || !strings.Contains(err.Error(), "SumNum is 3") {
+		t.Errorf("ParseXMLCatalog error = %v, want SumNum mismatch", err)
+	}
+	// 没有 xml 声明的应答也可以解析
+	content = bytes.TrimPrefix(xmlPart(t, "UTF-8", 1, catalogItem(camera1, "中山路口", group)), []byte(`<?xml version="1.0" encoding="UTF-8"?>`))
+	if catalog, err := ParseXMLCatalog(bytes.NewReader(content)); err != nil || len(catalog.Item) != 1 {
+		t.Errorf("ParseXMLCatalog without declaration = %+v, %v", catalog, err)
+	}
+	if _, err := ParseXMLCatalog(strings.NewReader(`<?xml version="1.0"?><Response><CmdType>Catalog`)); err == nil {
+		t.Error("ParseXMLCatalog of truncated xml succeeded")
+	}
+}
+
+func TestBuildTree(t *testing.T) {
+	items := []DeviceInfo{
+		catalogItem(camera1, "中山路口", group),
+		catalogItem(group, "交警支队", ""),
+		catalogItem(district, "和平区", ""),
+		// 上级不在目录中时挂到行政区划下，行政区划也没有时作为根节点
+		catalogItem(camera2, "南京街", "21010300002150000009"),
+		catalogItem(orphan, "孤立设备", "99999999992150000009"),
+		// 两个虚拟组织互为上级
+		catalogItem(orgA, "组织A", orgB),
+		catalogItem(orgB, "组织B", orgA),
+		// 重复的目录项以第一条为准
+		catalogItem(camera1, "重复", district),
+	}
+	items[0].CivilCode = district
+	items[1].CivilCode = district
+	items[3].CivilCode = district
+
+	tree := BuildTree(items)
+	buf := bytes.Buffer{}
+	if err := tree.Write(&buf, true); err != nil {
+		t.Fatal(err)
+	}
+	// 同级目录在前，按编码排序
+	want := district + ` 和平区
+  ` + group + ` 交警支队
+    ` + camera1 + ` 中山路口 
+  ` + camera2 + ` 南京街 
+` + orgB + ` 组织B
+  ` + orgA + ` 组织A
+` + orphan + ` 孤立设备 
+`
+	if buf.String() != want {
+		t.Errorf("Write =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	paths := map[string]string{
+		camera1: "/和平区/交警支队",
+		camera2: "/和平区",
+		orphan:  "/",
+		orgA:    "/组织B",
+		orgB:    "/",
+		"none":  "",
+	}
+	for id, want := range paths {
+		if got := tree.Path(id); got != want {
+			t.Errorf("Path(%s) = %q, want %q", id, got, want)
+		}
+	}
+
+	nodes := tree.Nodes()
+	got := map[string]Node{}
+	for _, n := range nodes {
+		got[n.GbDeviceId] = n
+	}
+	if len(nodes) != 4 || got[district].Devices != 2 || got[group].Devices != 1 || got[group].Level != 1 ||
+		got[group].ParentID != district || got[group].TypeCode != "215" || got[orgA].ParentID != orgB {
+		t.Errorf("Nodes = %+v", nodes)
+	}
+}
+
+func TestReplaceNodes(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	load := func() map[string]Node {
+		var nodes []Node
+		if err := repo.DB().Find(&nodes).Error; err != nil {
+			t.Fatal(err)
+		}
+		res := make(map[string]Node, len(nodes))
+		for _, n := range nodes {
+			res[n.GbDeviceId] = n
+		}
+		return res
+	}
+
+	first := BuildTree([]DeviceInfo{
+		catalogItem(district, "和平区", ""),
+		catalogItem(group, "交警支队", district),
+		catalogItem(orgA, "组织A", group),
+		catalogItem(camera1, "中山路口", orgA),
+	}).Nodes()
+	if err := repo.ReplaceNodes(ctx, first, 1); err != nil {
+		t.Fatal(err)
+	}
+	if nodes := load(); len(nodes) != 3 || nodes[orgA].Path != "/和平区/交警支队" || nodes[orgA].Devices != 1 {
+		t.Fatalf("first sync nodes = %+v", nodes)
+	}
+
+	// 再次同步时子树移动到新的分组下，旧分组被删除
+	second := BuildTree([]DeviceInfo{
+		catalogItem(district, "和平区", ""),
+		catalogItem(orgB, "组织B", district),
+		catalogItem(orgA, "组织A", orgB),
+		catalogItem(camera1, "中山路口", orgA),
+		catalogItem(camera2, "南京街", orgA),
+	}).Nodes()
+	if err := repo.ReplaceNodes(ctx, second, 100); err != nil {
+		t.Fatal(err)
+	}
+	nodes := load()
+	if _, ok := nodes[group]; ok || len(nodes) != 3 {
+		t.Errorf("second sync nodes = %+v, want the old group removed", nodes)
+	}
+	if a := nodes[orgA]; a.ParentID != orgB || a.Path != "/和平区/组织B" || a.Level != 2 || a.Devices != 2 {
+		t.Errorf("moved subtree = %+v", a)
+	}
+	if nodes[district].Devices != 2 {
+		t.Errorf("district devices = %d, want 2", nodes[district].Devices)
+	}
+
+	// 空目录清空目录表
+	if err := repo.ReplaceNodes(ctx, nil, 100); err != nil {
+		t.Fatal(err)
+	}
+	if nodes := load(); len(nodes) != 0 {
+		t.Errorf("nodes after empty sync = %+v", nodes)
+	}
+}
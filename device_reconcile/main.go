@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"go-web-study/coord"
+	"go-web-study/device"
+	"go-web-study/storage"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// 把客户的设备台账与 test_device 中当前目录的设备核对，输出标注了缺失、多出和坐标不一致的工作簿，
+// 不指定 -i 时只导出平台设备目录
+func main() {
+	dbConfig := storage.RegisterFlags(flag.CommandLine)
+	input := flag.String("i", "", "customer device spreadsheet (.xlsx), empty to only export the platform catalog")
+	output := flag.String("o", "device_reconcile.xlsx", "annotated workbook")
+	mapping := ColumnMapping{}
+	flag.StringVar(&mapping.Sheet, "sheet", "", "worksheet name, default the first sheet")
+	flag.IntVar(&mapping.HeaderRow, "header-row", 1, "row number of the header")
+	flag.StringVar(&mapping.GbID, "col-id", "国标编码", "GB28181 id column, header name or col:C for a column letter")
+	flag.StringVar(&mapping.Name, "col-name", "设备名称", "device name column, header name or col:C for a column letter")
+	flag.StringVar(&mapping.Longitude, "col-lon", "经度", "longitude column, header name or col:C for a column letter, empty to skip")
+	flag.StringVar(&mapping.Latitude, "col-lat", "纬度", "latitude column, header name or col:C for a column letter, empty to skip")
+	tolerance := flag.Float64("tolerance", 50, "allowed coordinate difference in meters")
+	datum := flag.String("datum", "wgs84", "coordinate datum of the spreadsheet")
+	platformDatum := flag.String("platform-datum", "wgs84", "coordinate datum of the platform devices")
+	flag.Parse()
+
+	if *input == "" {
+		devices := activeDevices(*dbConfig)
+		f, err := ExportCatalog(devices)
+		if err != nil {
+			log.Fatalf("导出设备目录失败 %v", err)
+		}
+		if err := f.SaveAs(*output); err != nil {
+			log.Fatalf("保存%s失败 %v", *output, err)
+		}
+		log.Printf("平台设备%d台，目录已写入%s", len(devices), *output)
+		return
+	}
+
+	config := device.ReconcileConfig{Tolerance: *tolerance}
+	var err error
+	if config.Datum, err = coord.ParseDatum(*datum); err != nil {
+		log.Fatal(err)
+	}
+	if config.PlatformDatum, err = coord.ParseDatum(*platformDatum); err != nil {
+		log.Fatal(err)
+	}
+
+	f, err := excelize.OpenFile(*input)
+	if err != nil {
+		log.Fatalf("打开%s失败 %v", *input, err)
+	}
+	if mapping.Sheet == "" {
+		mapping.Sheet = f.GetSheetList()[0]
+	}
+	rows, width, err := LoadCustomerRows(f, mapping)
+	if err != nil {
+		log.Fatalf("读取台账失败 %v", err)
+	}
+
+	devices := activeDevices(*dbConfig)
+	matches, extra := device.Reconcile(rows, devices, config)
+	if err := Annotate(f, mapping, width, matches, extra, devices); err != nil {
+		log.Fatalf("写入核对结果失败 %v", err)
+	}
+	if err := f.SaveAs(*output); err != nil {
+		log.Fatalf("保存%s失败 %v", *output, err)
+	}
+	counts := map[string]int{}
+	for _, m := range matches {
+		counts[m.Status]++
+	}
+	log.Printf("台账%d行：一致%d，坐标不一致%d，平台缺失%d；平台多出%d，结果已写入%s", len(rows),
+		counts[device.ReconcileOK], counts[device.ReconcileMismatch], counts[device.ReconcileMissing], len(extra), *output)
+}
+
+func activeDevices(config storage.Config) []device.DeviceInfo {
+	db := storage.MustOpen(config)
+	devices, err := device.NewRepository(db).Active(context.Background())
+	if err != nil {
+		log.Fatalf("查询设备失败 %v", err)
+	}
+	return devices
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"go-web-study/device"
+	"go-web-study/sheet"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ColumnMapping 客户台账的列，可以是表头名称或带 col: 前缀的列字母(如 col:C)
+type ColumnMapping struct {
+	Sheet     string
+	HeaderRow int
+	GbID      string
+	Name      string
+	Longitude string
+	Latitude  string
+}
+
+// customerRow 客户台账中参与核对的列，tag 中为默认表头，可以通过 ColumnMapping 覆盖
+type customerRow struct {
+	GbID      string `xlsx:"国标编码"`
+	Name      string `xlsx:"设备名称"`
+	Longitude string `xlsx:"经度"`
+	Latitude  string `xlsx:"纬度"`
+}
+
+// LoadCustomerRows 逐行读取客户台账，返回数据行和表头的列数
+func LoadCustomerRows(f *excelize.File, m ColumnMapping) ([]device.CustomerRow, int, error) {
+	if m.GbID == "" && m.Name == "" {
+		return nil, 0, fmt.Errorf("neither id nor name column is configured")
+	}
+	r, err := sheet.NewReader(f, m.Sheet)
+	if err != nil {
+		return nil, 0, err
+	}
+	r.HeaderRow = m.HeaderRow
+	r.Columns = map[string]string{"GbID": m.GbID, "Name": m.Name, "Longitude": m.Longitude, "Latitude": m.Latitude}
+
+	var res []device.CustomerRow
+	for first := true; r.Next(); first = false {
+		if first {
+			// 配置的列必须存在，否则所有行都会被当成平台缺失
+			for _, column := range r.Columns {
+				if _, err := sheet.ResolveColumn(r.Header(), column); column != "" && err != nil {
+					return nil, 0, err
+				}
+			}
+		}
+		row := customerRow{}
+		if err := r.Decode(&row); err != nil {
+			return nil, 0, err
+		}
+		if row.GbID == "" && row.Name == "" {
+			continue
+		}
+		res = append(res, device.CustomerRow{
+			Row:       r.Row(),
+			GbID:      row.GbID,
+			Name:      row.Name,
+			Longitude: row.Longitude,
+			Latitude:  row.Latitude,
+		})
+	}
+	if err := r.Err(); err != nil {
+		return nil, 0, err
+	}
+	return res, len(r.Header()), nil
+}
+
+var statusLabels = map[string]string{
+	device.ReconcileOK:       "一致",
+	device.ReconcileMissing:  "平台缺失",
+	device.ReconcileMismatch: "坐标不一致",
+	device.ReconcileExtra:    "平台多出",
+}
+
+var statusColors = map[string]string{
+	device.ReconcileOK:       "#C6EFCE",
+	device.ReconcileMissing:  "#FFC7CE",
+	device.ReconcileMismatch: "#FFEB9C",
+	device.ReconcileExtra:    "#BDD7EE",
+}
+
+var matchLabels = map[string]string{
+	device.MatchByID:   "国标编码",
+	device.MatchByName: "名称",
+}
+
+const (
+	summarySheet = "核对汇总"
+	extraSheet   = "平台多出设备"
+	catalogSheet = "平台设备目录"
+)
+
+var catalogHeader = []string{"国标编码", "名称", "目录", "上级编码", "行政区划", "业务分组", "厂商", "型号", "归属", "地址",
+	"IP地址", "端口", "状态", "经度", "纬度", "核对结果"}
+
+// WriteCatalog 把平台目录中的全部设备写入 sheet，按目录和编码排序，statuses 为设备的核对结果，可以为空
+func WriteCatalog(f *excelize.File, sheet string, devices []device.DeviceInfo, statuses map[string]string) error {
+	sorted := append([]device.DeviceInfo{}, devices...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Path != sorted[j].Path {
+			return sorted[i].Path < sorted[j].Path
+		}
+		return sorted[i].GbDeviceId < sorted[j].GbDeviceId
+	})
+	if err := f.SetSheetRow(sheet, "A1", &catalogHeader); err != nil {
+		return err
+	}
+	for i, d := range sorted {
+		row := []interface{}{d.GbDeviceId, d.Name, d.Path, d.ParentID, d.CivilCode, d.BusinessGroupID, d.Manufacturer, d.Model,
+			d.Owner, d.Address, d.IPAddress, string(d.Port), d.Status, string(d.Longitude), string(d.Latitude),
+			statusLabels[statuses[d.GbDeviceId]]}
+		if err := f.SetSheetRow(sheet, fmt.Sprintf("A%d", i+2), &row); err != nil {
+			return err
+		}
+	}
+	_ = f.SetColWidth(sheet, "A", "A", 24)
+	_ = f.SetColWidth(sheet, "B", "C", 40)
+	return f.AutoFilter(sheet, "A1", fmt.Sprintf("P%d", len(sorted)+1), "")
+}
+
+// ExportCatalog 只导出平台设备目录，不做核对
+func ExportCatalog(devices []device.DeviceInfo) (*excelize.File, error) {
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", catalogSheet)
+	if err := WriteCatalog(f, catalogSheet, devices, nil); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Annotate 在客户台账的表头右侧追加核对结果列并按结果着色，另外增加汇总、平台多出设备和平台设备目录三个工作表，
+// devices 为参与核对的全部平台设备
+func Annotate(f *excelize.File, m ColumnMapping, width int, matches []device.Match, extra, devices []device.DeviceInfo) error {
+	styles := map[string]int{}
+	for status, color := range statusColors {
+		style, err := f.NewStyle(&excelize.Style{Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{color}}})
+		if err != nil {
+			return err
+		}
+		styles[status] = style
+	}
+
+	start, err := excelize.CoordinatesToCellName(width+1, m.HeaderRow)
+	if err != nil {
+		return err
+	}
+	header := []string{"核对结果", "匹配方式", "平台国标编码", "平台名称", "平台经度", "平台纬度", "坐标偏差(米)"}
+	if err := f.SetSheetRow(m.Sheet, start, &header); err != nil {
+		return err
+	}
+	counts := map[string]int{}
+	for _, match := range matches {
+		counts[match.Status]++
+		row := []interface{}{statusLabels[match.Status], matchLabels[match.By], "", "", "", "", ""}
+		if match.Device != nil {
+			row[2], row[3] = match.Device.GbDeviceId, match.Device.Name
+			row[4], row[5] = string(match.Device.Longitude), string(match.Device.Latitude)
+		}
+		if match.Distance >= 0 {
+			row[6] = fmt.Sprintf("%.1f", match.Distance)
+		}
+		axis, _ := excelize.CoordinatesToCellName(width+1, match.Row.Row)
+		if err := f.SetSheetRow(m.Sheet, axis, &row); err != nil {
+			return err
+		}
+		first, _ := excelize.CoordinatesToCellName(1, match.Row.Row)
+		last, _ := excelize.CoordinatesToCellName(width+len(header), match.Row.Row)
+		if err := f.SetCellStyle(m.Sheet, first, last, styles[match.Status]); err != nil {
+			return err
+		}
+	}
+
+	f.NewSheet(extraSheet)
+	if err := f.SetSheetRow(extraSheet, "A1", &[]string{"国标编码", "名称", "目录", "经度", "纬度", "状态"}); err != nil {
+		return err
+	}
+	for i, d := range extra {
+		row := []interface{}{d.GbDeviceId, d.Name, d.Path, string(d.Longitude), string(d.Latitude), d.Status}
+		if err := f.SetSheetRow(extraSheet, fmt.Sprintf("A%d", i+2), &row); err != nil {
+			return err
+		}
+	}
+	_ = f.SetColWidth(extraSheet, "A", "A", 24)
+	_ = f.SetColWidth(extraSheet, "B", "C", 40)
+	counts[device.ReconcileExtra] = len(extra)
+
+	f.NewSheet(summarySheet)
+	if err := f.SetSheetRow(summarySheet, "A1", &[]string{"核对结果", "数量"}); err != nil {
+		return err
+	}
+	for i, status := range []string{device.ReconcileOK, device.ReconcileMismatch, device.ReconcileMissing, device.ReconcileExtra} {
+		row := []interface{}{statusLabels[status], counts[status]}
+		if err := f.SetSheetRow(summarySheet, fmt.Sprintf("A%d", i+2), &row); err != nil {
+			return err
+		}
+		if err := f.SetCellStyle(summarySheet, fmt.Sprintf("A%d", i+2), fmt.Sprintf("B%d", i+2), styles[status]); err != nil {
+			return err
+		}
+	}
+	_ = f.SetColWidth(summarySheet, "A", "A", 20)
+
+	statuses := make(map[string]string, len(devices))
+	for _, match := range matches {
+		if match.Device != nil {
+			statuses[match.Device.GbDeviceId] = match.Status
+		}
+	}
+	for _, d := range extra {
+		statuses[d.GbDeviceId] = device.ReconcileExtra
+	}
+	f.NewSheet(catalogSheet)
+	return WriteCatalog(f, catalogSheet, devices, statuses)
+}
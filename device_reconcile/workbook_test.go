@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"go-web-study/coord"
+	"go-web-study/device"
+
+	"github.com/xuri/excelize/v2"
+)
+
+var testDevices = []device.DeviceInfo{
+	{GbDeviceId: "b", Name: "大厅", Path: "沈阳/和平", Longitude: "123.414406", Latitude: "41.806038", Status: "ON"},
+	{GbDeviceId: "a", Name: "南门", Path: "沈阳/和平", Longitude: "123.414406", Latitude: "41.806038", Status: "ON"},
+	{GbDeviceId: "c", Name: "仓库", Path: "沈阳/大东", Status: "OFF"},
+}
+
+func TestExportCatalog(t *testing.T) {
+	f, err := ExportCatalog(testDevices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.GetSheetList(); !reflect.DeepEqual(got, []string{catalogSheet}) {
+		t.Errorf("sheets = %v, want [%s]", got, catalogSheet)
+	}
+	rows, err := f.GetRows(catalogSheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || !reflect.DeepEqual(rows[0], catalogHeader) {
+		t.Fatalf("rows = %v", rows)
+	}
+	// 按目录和编码排序，没有核对结果时最后一列为空
+	for i, id := range []string{"a", "b", "c"} {
+		if rows[i+1][0] != id {
+			t.Errorf("row %d = %v, want %s", i+2, rows[i+1], id)
+		}
+	}
+	if got := rows[1][:3]; !reflect.DeepEqual(got, []string{"a", "南门", "沈阳/和平"}) {
+		t.Errorf("row 2 = %v", rows[1])
+	}
+	if got := rows[3][12]; got != "OFF" {
+		t.Errorf("row 4 status = %q, want OFF", got)
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	f := excelize.NewFile()
+	for i, row := range [][]interface{}{
+		{"国标编码", "设备名称", "经度", "纬度"},
+		{"a", "南门", "123.414406", "41.806038"},
+		{"", "大厅", "123.414406", "41.807038"},
+		{"x", "不存在"},
+	} {
+		axis, _ := excelize.CoordinatesToCellName(1, i+1)
+		if err := f.SetSheetRow("Sheet1", axis, &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := ColumnMapping{Sheet: "Sheet1", HeaderRow: 1, GbID: "国标编码", Name: "设备名称", Longitude: "经度", Latitude: "纬度"}
+	rows, width, err := LoadCustomerRows(f, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || width != 4 {
+		t.Fatalf("LoadCustomerRows = %v, %d", rows, width)
+	}
+	matches, extra := device.Reconcile(rows, testDevices, device.ReconcileConfig{Tolerance: 50, Datum: coord.WGS84, PlatformDatum: coord.WGS84})
+	if err := Annotate(f, m, width, matches, extra, testDevices); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := f.GetSheetList(), []string{"Sheet1", extraSheet, summarySheet, catalogSheet}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sheets = %v, want %v", got, want)
+	}
+	sheetRows, err := f.GetRows("Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"核对结果", "一致", "坐标不一致", "平台缺失"} {
+		if got := sheetRows[i][4]; got != want {
+			t.Errorf("Sheet1 row %d result = %q, want %q", i+1, got, want)
+		}
+	}
+	summary, err := f.GetRows(summarySheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"核对结果", "数量"}, {"一致", "1"}, {"坐标不一致", "1"}, {"平台缺失", "1"}, {"平台多出", "1"}}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("summary = %v, want %v", summary, want)
+	}
+	// 目录中包含全部平台设备和各自的核对结果
+	catalog, err := f.GetRows(catalogSheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []string
+	for _, row := range catalog[1:] {
+		results = append(results, row[0]+":"+row[len(catalogHeader)-1])
+	}
+	if want := []string{"a:一致", "b:坐标不一致", "c:平台多出"}; !reflect.DeepEqual(results, want) {
+		t.Errorf("catalog results = %v, want %v", results, want)
+	}
+}
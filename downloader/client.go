@@ -0,0 +1,194 @@
+package downloader
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Cookie 固定携带的 cookie，Domain 为空时只发送给 AuthHosts，否则发送给该域名及其子域名
+type Cookie struct {
+	Name   string `json:"name" mapstructure:"name"`
+	Value  string `json:"value" mapstructure:"value"`
+	Domain string `json:"domain" mapstructure:"domain"`
+}
+
+// ClientConfig 所有下载请求共用的 http 配置
+type ClientConfig struct {
+	Timeout     time.Duration     `json:"timeout" mapstructure:"timeout"`
+	Headers     map[string]string `json:"headers" mapstructure:"headers"`
+	Username    string            `json:"username" mapstructure:"username"`
+	Password    string            `json:"password" mapstructure:"password"`
+	BearerToken string            `json:"bearerToken" mapstructure:"bearer_token"`
+	Cookies     []Cookie          `json:"cookies" mapstructure:"cookies"`
+	// AuthHosts 允许携带请求头、认证和无 Domain cookie 的主机(host 或 host:port)，
+	// 为空时只发送给最初请求的主机，跳转到其它主机时不再携带
+	AuthHosts []string `json:"authHosts" mapstructure:"auth_hosts"`
+	Proxy     string   `json:"proxy" mapstructure:"proxy"`
+	CAFile    string   `json:"caFile" mapstructure:"ca_file"`
+	Insecure  bool     `json:"insecure" mapstructure:"insecure"`
+}
+
+// NewClient 根据配置创建 http.Client，请求头、认证、cookie、代理和限速对每个请求统一生效
+func NewClient(config ClientConfig, throttle *Throttle) (*http.Client, error) {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	if config.Proxy != "" {
+		proxyURL, err := url.Parse(config.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy [%s]: %v", config.Proxy, err)
+		}
+		base.Proxy = http.ProxyURL(proxyURL)
+	}
+	if config.CAFile != "" || config.Insecure {
+		tlsConfig := &tls.Config{InsecureSkipVerify: config.Insecure}
+		if config.CAFile != "" {
+			pem, err := ioutil.ReadFile(config.CAFile)
+			if err != nil {
+				return nil, err
+			}
+			// 在系统根证书的基础上追加，否则公网 https 主机都会校验失败
+			if tlsConfig.RootCAs, err = x509.SystemCertPool(); err != nil {
+				tlsConfig.RootCAs = x509.NewCertPool()
+			}
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificate found in [%s]", config.CAFile)
+			}
+		}
+		base.TLSClientConfig = tlsConfig
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var transport http.RoundTripper = base
+	if throttle != nil {
+		transport = throttle.Transport(transport)
+	}
+	return &http.Client{
+		Transport: &authTransport{base: transport, config: config},
+		Jar:       jar,
+		Timeout:   config.Timeout,
+	}, nil
+}
+
+type authTransport struct {
+	base   http.RoundTripper
+	config ClientConfig
+}
+
+// trusted 判断请求的主机能否收到认证信息，防止跳转时泄露给第三方
+func (t *authTransport) trusted(req *http.Request) bool {
+	if len(t.config.AuthHosts) > 0 {
+		for _, host := range t.config.AuthHosts {
+			if strings.EqualFold(host, req.URL.Host) || strings.EqualFold(host, req.URL.Hostname()) {
+				return true
+			}
+		}
+		return false
+	}
+	// 跳转请求的 Response 指向上一跳的响应，沿链找到最初的请求
+	origin := req
+	for origin.Response != nil && origin.Response.Request != nil {
+		origin = origin.Response.Request
+	}
+	return strings.EqualFold(origin.URL.Host, req.URL.Host)
+}
+
+// matchDomain 主机与 domain 相同或是其子域名
+func matchDomain(host, domain string) bool {
+	host, domain = strings.ToLower(host), strings.ToLower(strings.TrimPrefix(domain, "."))
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	trusted := t.trusted(req)
+	// RoundTripper 不应修改原始请求
+	req = req.Clone(req.Context())
+	for _, c := range t.config.Cookies {
+		if (c.Domain == "" && trusted) || (c.Domain != "" && matchDomain(req.URL.Hostname(), c.Domain)) {
+			req.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+		}
+	}
+	if !trusted {
+		return t.base.RoundTrip(req)
+	}
+	for k, v := range t.config.Headers {
+		if req.Header.Get(k) == "" {
+			req.Header.Set(k, v)
+		}
+	}
+	if req.Header.Get("Authorization") == "" {
+		if t.config.BearerToken != "" {
+			req.Header.Set("Authorization", "Bearer "+t.config.BearerToken)
+		} else if t.config.Username != "" {
+			req.SetBasicAuth(t.config.Username, t.config.Password)
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// RegisterClientFlags 注册 -header/-user/-password/-token/-cookie/-auth-host/-proxy/-ca-file/-insecure 参数
+func RegisterClientFlags(fs *flag.FlagSet, config *ClientConfig) {
+	fs.Var((*headerFlag)(config), "header", "extra request header, e.g. -header 'X-Site: sy', repeatable")
+	fs.StringVar(&config.Username, "user", config.Username, "basic auth username")
+	fs.StringVar(&config.Password, "password", config.Password, "basic auth password")
+	fs.StringVar(&config.BearerToken, "token", config.BearerToken, "bearer token")
+	fs.Var((*cookieFlag)(config), "cookie", "cookie sent with every request, e.g. -cookie 'SESSION=xxx', repeatable")
+	fs.Var((*authHostFlag)(config), "auth-host", "host allowed to receive headers, auth and cookies, default the requested host, repeatable")
+	fs.StringVar(&config.Proxy, "proxy", config.Proxy, "proxy url, default from HTTP_PROXY/HTTPS_PROXY")
+	fs.StringVar(&config.CAFile, "ca-file", config.CAFile, "extra CA certificate file in PEM format")
+	fs.BoolVar(&config.Insecure, "insecure", config.Insecure, "skip tls certificate verification")
+}
+
+type headerFlag ClientConfig
+
+func (f *headerFlag) String() string {
+	return ""
+}
+
+func (f *headerFlag) Set(s string) error {
+	kv := strings.SplitN(s, ":", 2)
+	if len(kv) != 2 {
+		return fmt.Errorf("header must be 'Name: value'")
+	}
+	if f.Headers == nil {
+		f.Headers = make(map[string]string)
+	}
+	f.Headers[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	return nil
+}
+
+type cookieFlag ClientConfig
+
+func (f *cookieFlag) String() string {
+	return ""
+}
+
+func (f *cookieFlag) Set(s string) error {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 {
+		return fmt.Errorf("cookie must be 'name=value'")
+	}
+	f.Cookies = append(f.Cookies, Cookie{Name: strings.TrimSpace(kv[0]), Value: strings.TrimSpace(kv[1])})
+	return nil
+}
+
+type authHostFlag ClientConfig
+
+func (f *authHostFlag) String() string {
+	return ""
+}
+
+func (f *authHostFlag) Set(s string) error {
+	f.AuthHosts = append(f.AuthHosts, strings.TrimSpace(s))
+	return nil
+}
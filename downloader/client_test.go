@@ -0,0 +1,67 @@
+package downloader
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthNotSentToOtherHost(t *testing.T) {
+	// 127.0.0.1 和 localhost 是不同的主机
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "" {
+			t.Errorf("redirected request has Authorization %q", got)
+		}
+		if got := r.Header.Get("X-Site"); got != "" {
+			t.Errorf("redirected request has X-Site %q", got)
+		}
+		if len(r.Cookies()) != 0 {
+			t.Errorf("redirected request has cookies %v", r.Cookies())
+		}
+	}))
+	defer other.Close()
+	otherURL := "http://localhost:" + other.Listener.Addr().String()[len("127.0.0.1:"):]
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization = %q, want Bearer secret", got)
+		}
+		if c, err := r.Cookie("SESSION"); err != nil || c.Value != "xxx" {
+			t.Errorf("cookie SESSION = %v, %v", c, err)
+		}
+		http.Redirect(w, r, otherURL+"/file", http.StatusFound)
+	}))
+	defer origin.Close()
+
+	client, err := NewClient(ClientConfig{
+		Headers:     map[string]string{"X-Site": "sy"},
+		BearerToken: "secret",
+		Cookies:     []Cookie{{Name: "SESSION", Value: "xxx"}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(origin.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestMatchDomain(t *testing.T) {
+	cases := []struct {
+		host, domain string
+		want         bool
+	}{
+		{"example.com", "example.com", true},
+		{"a.example.com", "example.com", true},
+		{"a.example.com", ".example.com", true},
+		{"evilexample.com", "example.com", false},
+		{"example.com.evil.org", "example.com", false},
+	}
+	for _, c := range cases {
+		if got := matchDomain(c.host, c.domain); got != c.want {
+			t.Errorf("matchDomain(%q, %q) = %v, want %v", c.host, c.domain, got, c.want)
+		}
+	}
+}
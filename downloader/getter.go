@@ -0,0 +1,78 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"github.com/hashicorp/go-getter"
+)
+
+// Fetcher 按 go-getter 风格的源地址下载，支持:
+//   http(s)://host/path               普通 http 下载
+//   file:///mirror/path 或 ./path     本地镜像
+//   s3::http://127.0.0.1:9000/b/key   s3 兼容存储(MinIO)
+//   git::https://host/repo.git        git 仓库
+//   ?checksum=sha256:xxx              下载后校验
+//   ?archive=zip 或 .zip/.tar.gz 后缀  FetchDir 自动解压，FetchFile 原样保存
+type Fetcher struct {
+	// Client 用于 http/https 源，可以带上限速等 Transport
+	Client *http.Client
+	// Header 附加到每个 http 请求上的请求头
+	Header http.Header
+	// Pwd 解析相对路径的 file 源，为空时使用当前目录
+	Pwd string
+}
+
+func NewFetcher(client *http.Client) *Fetcher {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Fetcher{Client: client}
+}
+
+// FetchFile 下载单个文件到 dst，内容原样保存，不会按后缀解压
+func (f *Fetcher) FetchFile(ctx context.Context, src, dst string) error {
+	return f.fetch(ctx, src, dst, getter.ClientModeFile)
+}
+
+// FetchDir 下载到目录 dst，压缩包会被解压，git 仓库会被 clone
+func (f *Fetcher) FetchDir(ctx context.Context, src, dst string) error {
+	return f.fetch(ctx, src, dst, getter.ClientModeDir)
+}
+
+func (f *Fetcher) fetch(ctx context.Context, src, dst string, mode getter.ClientMode) error {
+	pwd := f.Pwd
+	if pwd == "" {
+		var err error
+		if pwd, err = os.Getwd(); err != nil {
+			return err
+		}
+	}
+	client := &getter.Client{
+		Ctx:     ctx,
+		Src:     src,
+		Dst:     dst,
+		Pwd:     pwd,
+		Mode:    mode,
+		Getters: f.getters(),
+	}
+	if mode == getter.ClientModeFile {
+		// 为 nil 时 go-getter 使用默认的解压器，.zip 会解压失败，.gz 会保存解压后的内容
+		client.Decompressors = map[string]getter.Decompressor{}
+	}
+	return client.Get()
+}
+
+func (f *Fetcher) getters() map[string]getter.Getter {
+	httpGetter := &getter.HttpGetter{Netrc: true, Client: f.Client, Header: f.Header}
+	getters := make(map[string]getter.Getter, len(getter.Getters))
+	for k, v := range getter.Getters {
+		getters[k] = v
+	}
+	getters["http"] = httpGetter
+	getters["https"] = httpGetter
+	// 默认的 file getter 只创建软链接，镜像目录可能随后被清理，这里改为复制
+	getters["file"] = &getter.FileGetter{Copy: true}
+	return getters
+}
@@ -0,0 +1,147 @@
+package downloader
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testContent = "hello go-getter"
+
+func newFileServer(t *testing.T, files map[string][]byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "HEAD" {
+			return
+		}
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("X-Site"); got != "sy" {
+			t.Errorf("header X-Site = %q, want sy", got)
+		}
+		_, _ = w.Write(content)
+	}))
+}
+
+func readFile(t *testing.T, name string) string {
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestFetchFileChecksum(t *testing.T) {
+	srv := newFileServer(t, map[string][]byte{"/a.txt": []byte(testContent)})
+	defer srv.Close()
+	fetcher := NewFetcher(srv.Client())
+	fetcher.Header = http.Header{"X-Site": []string{"sy"}}
+	dir := t.TempDir()
+
+	sum := sha256.Sum256([]byte(testContent))
+	dst := filepath.Join(dir, "a.txt")
+	if err := fetcher.FetchFile(context.Background(), srv.URL+"/a.txt?checksum=sha256:"+hex.EncodeToString(sum[:]), dst); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dst); got != testContent {
+		t.Errorf("content = %q, want %q", got, testContent)
+	}
+
+	bad := filepath.Join(dir, "bad.txt")
+	err := fetcher.FetchFile(context.Background(), srv.URL+"/a.txt?checksum=sha256:"+hex.EncodeToString(make([]byte, 32)), bad)
+	if err == nil {
+		t.Error("FetchFile with wrong checksum should fail")
+	}
+}
+
+func zipContent(t *testing.T) []byte {
+	buf := bytes.Buffer{}
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("sub/a.txt")
+	_, _ = w.Write([]byte(testContent))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gzipContent(t *testing.T) []byte {
+	buf := bytes.Buffer{}
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write([]byte(testContent))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFetchFileKeepsArchives(t *testing.T) {
+	files := map[string][]byte{"/tool.zip": zipContent(t), "/log.gz": gzipContent(t)}
+	srv := newFileServer(t, files)
+	defer srv.Close()
+	fetcher := NewFetcher(srv.Client())
+	fetcher.Header = http.Header{"X-Site": []string{"sy"}}
+	dir := t.TempDir()
+
+	for _, name := range []string{"/tool.zip", "/log.gz"} {
+		dst := filepath.Join(dir, name)
+		if err := fetcher.FetchFile(context.Background(), srv.URL+name, dst); err != nil {
+			t.Errorf("FetchFile(%s): %v", name, err)
+			continue
+		}
+		if got := readFile(t, dst); got != string(files[name]) {
+			t.Errorf("FetchFile(%s) saved %d bytes, want the %d byte archive unchanged", name, len(got), len(files[name]))
+		}
+	}
+}
+
+func TestFetchDirArchive(t *testing.T) {
+	srv := newFileServer(t, map[string][]byte{"/a.zip": zipContent(t)})
+	defer srv.Close()
+	fetcher := NewFetcher(srv.Client())
+	fetcher.Header = http.Header{"X-Site": []string{"sy"}}
+
+	dst := filepath.Join(t.TempDir(), "out")
+	if err := fetcher.FetchDir(context.Background(), srv.URL+"/a.zip", dst); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dst, "sub", "a.txt")); got != testContent {
+		t.Errorf("content = %q, want %q", got, testContent)
+	}
+}
+
+func TestFetchFileLocalCopy(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "mirror.txt")
+	if err := ioutil.WriteFile(src, []byte(testContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fetcher := NewFetcher(nil)
+	fetcher.Pwd = dir
+
+	dst := filepath.Join(dir, "copy.txt")
+	if err := fetcher.FetchFile(context.Background(), "./mirror.txt", dst); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		t.Error("local source should be copied, not symlinked")
+	}
+	if got := readFile(t, dst); got != testContent {
+		t.Errorf("content = %q, want %q", got, testContent)
+	}
+}
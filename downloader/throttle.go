@@ -0,0 +1,302 @@
+package downloader
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Window 限速生效的时间段，Weekdays 与 time.Weekday 一致(0 为周日)，为空表示每天
+type Window struct {
+	Weekdays  []int `json:"weekdays" mapstructure:"weekdays"`
+	StartHour int   `json:"startHour" mapstructure:"start_hour"`
+	EndHour   int   `json:"endHour" mapstructure:"end_hour"`
+}
+
+// HostRate 单主机限速
+type HostRate struct {
+	Host string `json:"host" mapstructure:"host"`
+	Rate int64  `json:"rate" mapstructure:"rate"`
+}
+
+// ThrottleConfig 带宽限制配置，速率单位为 bytes/sec，0 表示不限速
+type ThrottleConfig struct {
+	Rate      int64      `json:"rate" mapstructure:"rate"`
+	HostRates []HostRate `json:"hostRates" mapstructure:"host_rates"`
+	Windows   []Window   `json:"windows" mapstructure:"windows"`
+}
+
+// Throttle 所有下载协程共享的令牌桶
+type Throttle struct {
+	global  *rate.Limiter
+	hosts   map[string]*rate.Limiter
+	windows []Window
+	now     func() time.Time
+}
+
+func NewThrottle(config ThrottleConfig) *Throttle {
+	t := &Throttle{
+		hosts:   make(map[string]*rate.Limiter),
+		windows: config.Windows,
+		now:     time.Now,
+	}
+	if config.Rate > 0 {
+		t.global = newLimiter(config.Rate)
+	}
+	for _, h := range config.HostRates {
+		if h.Rate > 0 {
+			t.hosts[h.Host] = newLimiter(h.Rate)
+		}
+	}
+	return t
+}
+
+func newLimiter(bytesPerSec int64) *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(bytesPerSec), int(bytesPerSec))
+}
+
+func (w Window) contains(t time.Time) bool {
+	if len(w.Weekdays) > 0 {
+		matched := false
+		for _, day := range w.Weekdays {
+			if day == int(t.Weekday()) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	hour := t.Hour()
+	if w.StartHour <= w.EndHour {
+		return hour >= w.StartHour && hour < w.EndHour
+	}
+	// 跨零点，例如 22 点到 6 点
+	return hour >= w.StartHour || hour < w.EndHour
+}
+
+// Active 当前时间是否处于限速时段，没有配置时段时始终限速
+func (t *Throttle) Active() bool {
+	if t == nil {
+		return false
+	}
+	if len(t.windows) == 0 {
+		return true
+	}
+	now := t.now()
+	for _, w := range t.windows {
+		if w.contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Throttle) limiters(host string) []*rate.Limiter {
+	var res []*rate.Limiter
+	if t.global != nil {
+		res = append(res, t.global)
+	}
+	if l, ok := t.hosts[host]; ok {
+		res = append(res, l)
+	}
+	return res
+}
+
+// Reader 对 r 的读取进行限速，host 用于匹配单主机限速
+func (t *Throttle) Reader(ctx context.Context, host string, r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	limiters := t.limiters(host)
+	if len(limiters) == 0 {
+		return r
+	}
+	return &throttledReader{ctx: ctx, reader: r, throttle: t, limiters: limiters}
+}
+
+// Transport 返回对响应体限速的 RoundTripper，base 为空时使用 http.DefaultTransport
+func (t *Throttle) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &throttledTransport{base: base, throttle: t}
+}
+
+type throttledReader struct {
+	ctx      context.Context
+	reader   io.Reader
+	throttle *Throttle
+	limiters []*rate.Limiter
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if !r.throttle.Active() {
+		return r.reader.Read(p)
+	}
+	// 单次读取不能超过令牌桶容量，否则 WaitN 会直接报错
+	for _, l := range r.limiters {
+		if burst := l.Burst(); len(p) > burst {
+			p = p[:burst]
+		}
+	}
+	n, err := r.reader.Read(p)
+	if n <= 0 {
+		return n, err
+	}
+	for _, l := range r.limiters {
+		if waitErr := l.WaitN(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+type throttledTransport struct {
+	base     http.RoundTripper
+	throttle *Throttle
+}
+
+type throttledBody struct {
+	io.Reader
+	io.Closer
+}
+
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.Body == nil {
+		return resp, err
+	}
+	resp.Body = throttledBody{
+		Reader: t.throttle.Reader(req.Context(), req.URL.Hostname(), resp.Body),
+		Closer: resp.Body,
+	}
+	return resp, nil
+}
+
+// ParseThrottle 解析命令行形式的限速配置
+// hostRates 形如 "10.0.0.1=1048576,10.0.0.2=524288"，weekdays 形如 "1,2,3,4,5" 或 "mon-fri"，hours 形如 "8-20"，
+// weekdays 和 hours 都为空时始终限速，只配置 weekdays 时全天限速
+func ParseThrottle(bytesPerSec int64, hostRates, weekdays, hours string) (ThrottleConfig, error) {
+	config := ThrottleConfig{Rate: bytesPerSec}
+	for _, item := range splitList(hostRates) {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return config, fmt.Errorf("invalid host rate %q", item)
+		}
+		r, err := strconv.ParseInt(kv[1], 10, 64)
+		if err != nil {
+			return config, fmt.Errorf("invalid host rate %q: %v", item, err)
+		}
+		config.HostRates = append(config.HostRates, HostRate{Host: kv[0], Rate: r})
+	}
+	if hours == "" && weekdays == "" {
+		return config, nil
+	}
+	window := Window{StartHour: 0, EndHour: 24}
+	if hours != "" {
+		if _, err := fmt.Sscanf(hours, "%d-%d", &window.StartHour, &window.EndHour); err != nil {
+			return config, fmt.Errorf("invalid hours %q: %v", hours, err)
+		}
+	}
+	days, err := parseWeekdays(weekdays)
+	if err != nil {
+		return config, err
+	}
+	window.Weekdays = days
+	if err := window.Validate(); err != nil {
+		return config, err
+	}
+	config.Windows = append(config.Windows, window)
+	return config, nil
+}
+
+// ThrottleFlags 命令行形式的限速参数，字段的初始值即参数默认值
+type ThrottleFlags struct {
+	Rate      int64
+	HostRates string
+	Weekdays  string
+	Hours     string
+}
+
+// RegisterThrottleFlags 注册 -rate/-host-rate/-limit-weekdays/-limit-hours 参数
+func RegisterThrottleFlags(fs *flag.FlagSet, f *ThrottleFlags) {
+	fs.Int64Var(&f.Rate, "rate", f.Rate, "global bandwidth limit in bytes/sec, 0 means unlimited")
+	fs.StringVar(&f.HostRates, "host-rate", f.HostRates, "per host bandwidth limit, e.g. 10.0.0.1=1048576,10.0.0.2=524288")
+	fs.StringVar(&f.Weekdays, "limit-weekdays", f.Weekdays, "weekdays when the limit applies, 0 is Sunday, e.g. 1,2,3,4,5 or mon-fri, empty means every day")
+	fs.StringVar(&f.Hours, "limit-hours", f.Hours, "hours when the limit applies, e.g. 8-20, empty means all day")
+}
+
+// Config 解析为 ThrottleConfig
+func (f ThrottleFlags) Config() (ThrottleConfig, error) {
+	return ParseThrottle(f.Rate, f.HostRates, f.Weekdays, f.Hours)
+}
+
+// Validate 小时范围为 0-24，起止相同的时段永远不会生效
+func (w Window) Validate() error {
+	if w.StartHour < 0 || w.StartHour > 23 || w.EndHour < 0 || w.EndHour > 24 || w.StartHour == w.EndHour {
+		return fmt.Errorf("invalid hours %d-%d", w.StartHour, w.EndHour)
+	}
+	for _, day := range w.Weekdays {
+		if day < 0 || day > 6 {
+			return fmt.Errorf("invalid weekday %d", day)
+		}
+	}
+	return nil
+}
+
+var weekdayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+func parseWeekday(s string) (int, error) {
+	if day, ok := weekdayNames[strings.ToLower(s)]; ok {
+		return day, nil
+	}
+	day, err := strconv.Atoi(s)
+	if err != nil || day < 0 || day > 6 {
+		return 0, fmt.Errorf("invalid weekday %q", s)
+	}
+	return day, nil
+}
+
+// parseWeekdays 支持数字和 mon 等英文缩写，以及 mon-fri、5-1 这样的区间
+func parseWeekdays(s string) ([]int, error) {
+	var res []int
+	for _, item := range splitList(s) {
+		bounds := strings.SplitN(item, "-", 2)
+		start, err := parseWeekday(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if len(bounds) == 2 {
+			if end, err = parseWeekday(bounds[1]); err != nil {
+				return nil, err
+			}
+		}
+		for day := start; ; day = (day + 1) % 7 {
+			res = append(res, day)
+			if day == end {
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+func splitList(s string) []string {
+	var res []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
@@ -0,0 +1,180 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseThrottle(t *testing.T) {
+	cases := []struct {
+		hostRates, weekdays, hours string
+		want                       ThrottleConfig
+		err                        bool
+	}{
+		{want: ThrottleConfig{Rate: 100}},
+		{
+			hostRates: "10.0.0.1=1048576, 10.0.0.2=524288",
+			want:      ThrottleConfig{Rate: 100, HostRates: []HostRate{{"10.0.0.1", 1048576}, {"10.0.0.2", 524288}}},
+		},
+		{hours: "8-20", want: ThrottleConfig{Rate: 100, Windows: []Window{{StartHour: 8, EndHour: 20}}}},
+		{hours: "22-6", want: ThrottleConfig{Rate: 100, Windows: []Window{{StartHour: 22, EndHour: 6}}}},
+		// 只配置星期时全天限速
+		{weekdays: "mon-fri", want: ThrottleConfig{Rate: 100, Windows: []Window{{Weekdays: []int{1, 2, 3, 4, 5}, StartHour: 0, EndHour: 24}}}},
+		{weekdays: "6,0", hours: "0-24", want: ThrottleConfig{Rate: 100, Windows: []Window{{Weekdays: []int{6, 0}, StartHour: 0, EndHour: 24}}}},
+		{hostRates: "10.0.0.1", err: true},
+		{hostRates: "10.0.0.1=fast", err: true},
+		{hours: "8", err: true},
+		{hours: "8-8", err: true},
+		{hours: "24-6", err: true},
+		{hours: "8-25", err: true},
+		{weekdays: "funday", err: true},
+		{weekdays: "1-7", err: true},
+	}
+	for _, c := range cases {
+		got, err := ParseThrottle(100, c.hostRates, c.weekdays, c.hours)
+		if c.err {
+			if err == nil {
+				t.Errorf("ParseThrottle(%q, %q, %q) = %+v, want error", c.hostRates, c.weekdays, c.hours, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseThrottle(%q, %q, %q) = %+v, %v, want %+v", c.hostRates, c.weekdays, c.hours, got, err, c.want)
+		}
+	}
+}
+
+func TestParseWeekdays(t *testing.T) {
+	cases := []struct {
+		s    string
+		want []int
+	}{
+		{"", nil},
+		{"1,2,3", []int{1, 2, 3}},
+		{"Mon,wed", []int{1, 3}},
+		{"mon-fri", []int{1, 2, 3, 4, 5}},
+		{"1-5", []int{1, 2, 3, 4, 5}},
+		// 跨周末的区间
+		{"fri-mon", []int{5, 6, 0, 1}},
+		{"sat", []int{6}},
+	}
+	for _, c := range cases {
+		got, err := parseWeekdays(c.s)
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseWeekdays(%q) = %v, %v, want %v", c.s, got, err, c.want)
+		}
+	}
+}
+
+func TestWindowContains(t *testing.T) {
+	// 2021-08-23 是周一
+	at := func(day, hour int) time.Time {
+		return time.Date(2021, 8, 22+day, hour, 30, 0, 0, time.Local)
+	}
+	workday := Window{Weekdays: []int{1, 2, 3, 4, 5}, StartHour: 8, EndHour: 20}
+	night := Window{StartHour: 22, EndHour: 6}
+	fridayNight := Window{Weekdays: []int{5}, StartHour: 22, EndHour: 6}
+	cases := []struct {
+		w    Window
+		t    time.Time
+		want bool
+	}{
+		{workday, at(1, 8), true},
+		{workday, at(1, 19), true},
+		{workday, at(1, 20), false},
+		{workday, at(1, 7), false},
+		{workday, at(0, 12), false},
+		{night, at(1, 23), true},
+		{night, at(2, 0), true},
+		{night, at(2, 5), true},
+		{night, at(2, 6), false},
+		{night, at(2, 21), false},
+		// 星期按当前时间判断，周五 22 点之后的周六凌晨不在周五的时段内
+		{fridayNight, at(5, 23), true},
+		{fridayNight, at(6, 1), false},
+		{fridayNight, at(5, 1), true},
+		{Window{StartHour: 0, EndHour: 24}, at(3, 23), true},
+	}
+	for _, c := range cases {
+		if got := c.w.contains(c.t); got != c.want {
+			t.Errorf("%+v contains %s = %v, want %v", c.w, c.t.Format("Mon 15:04"), got, c.want)
+		}
+	}
+}
+
+// chunkReader 记录每次 Read 的缓冲区大小
+type chunkReader struct {
+	r     io.Reader
+	sizes []int
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	c.sizes = append(c.sizes, len(p))
+	return c.r.Read(p)
+}
+
+func TestThrottledReader(t *testing.T) {
+	const rate = 1000
+	data := bytes.Repeat([]byte("x"), rate*3/2)
+
+	throttle := NewThrottle(ThrottleConfig{Rate: rate})
+	src := &chunkReader{r: bytes.NewReader(data)}
+	start := time.Now()
+	// 缓冲区远大于令牌桶容量
+	got, err := readAll(throttle.Reader(context.Background(), "host", src), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("read %d bytes, want %d", len(got), len(data))
+	}
+	for _, n := range src.sizes {
+		if n > rate {
+			t.Errorf("read with %d byte buffer, want at most burst %d", n, rate)
+		}
+	}
+	// 第一秒的令牌桶是满的，剩余 500 字节需要约 0.5 秒
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("read finished in %v, want about 500ms", elapsed)
+	}
+
+	// 限速时段之外不限速
+	throttle = NewThrottle(ThrottleConfig{Rate: rate, Windows: []Window{{StartHour: 8, EndHour: 20}}})
+	throttle.now = func() time.Time { return time.Date(2021, 8, 23, 21, 0, 0, 0, time.Local) }
+	src = &chunkReader{r: bytes.NewReader(data)}
+	if _, err := readAll(throttle.Reader(context.Background(), "host", src), 4096); err != nil {
+		t.Fatal(err)
+	}
+	if src.sizes[0] != 4096 {
+		t.Errorf("read outside window with %d byte buffer, want 4096", src.sizes[0])
+	}
+
+	// 取消后不再等待令牌
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	throttle = NewThrottle(ThrottleConfig{Rate: rate})
+	_, err = readAll(throttle.Reader(ctx, "host", bytes.NewReader(data)), 4096)
+	if err != context.Canceled {
+		t.Errorf("read after cancel error = %v, want context.Canceled", err)
+	}
+}
+
+// readAll 每次用 size 大小的缓冲区读取
+func readAll(r io.Reader, size int) ([]byte, error) {
+	var res []byte
+	buf := make([]byte, size)
+	for {
+		n, err := r.Read(buf)
+		res = append(res, buf[:n]...)
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return res, err
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-web-study/downloader"
+
+	"github.com/chixm/filedownloader"
+)
+
+// Result 单个下载项的结果
+type Result struct {
+	Entry    Entry
+	Attempts int
+	Size     int64
+	Duration time.Duration
+	Err      error
+}
+
+// DownloadAll 按 filedownloader 的配置下载清单：最多 MaxDownloadThreads 个并发，每项失败后最多重试 MaxRetry 次，
+// 整批超过 DownloadTimeoutMinutes 后取消。filedownloader 内部固定使用 http.DefaultClient，
+// 也不返回单个文件的错误，这里用 client 逐项下载，限速和认证只作用于这一批下载
+func DownloadAll(ctx context.Context, client *http.Client, entries []Entry, config filedownloader.Config) []Result {
+	if config.MaxDownloadThreads <= 0 {
+		config.MaxDownloadThreads = 3
+	}
+	if config.DownloadTimeoutMinutes > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(config.DownloadTimeoutMinutes)*time.Minute)
+		defer cancel()
+	}
+	fetcher := downloader.NewFetcher(client)
+	retry := config.MaxRetry
+	results := make([]Result, len(entries))
+	sem := make(chan struct{}, config.MaxDownloadThreads)
+	wg := sync.WaitGroup{}
+	for i, entry := range entries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, entry Entry) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = downloadEntry(ctx, fetcher, entry, retry)
+		}(i, entry)
+	}
+	wg.Wait()
+	return results
+}
+
+func downloadEntry(ctx context.Context, fetcher *downloader.Fetcher, entry Entry, retry int) Result {
+	start := time.Now()
+	result := Result{Entry: entry}
+
+	src := sourceWithChecksum(entry)
+	f := *fetcher
+	if len(entry.Headers) > 0 {
+		f.Header = make(http.Header)
+		for k, v := range fetcher.Header {
+			f.Header[k] = v
+		}
+		for k, v := range entry.Headers {
+			f.Header.Set(k, v)
+		}
+	}
+	if dir := filepath.Dir(entry.Destination); dir != "" {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			result.Err = err
+			return result
+		}
+	}
+
+	for result.Attempts = 1; ; result.Attempts++ {
+		result.Err = f.FetchFile(ctx, src, entry.Destination)
+		if result.Err == nil || result.Attempts > retry || ctx.Err() != nil {
+			break
+		}
+		log.Printf("download [%s] failed, attempt %d: %v", entry.URL, result.Attempts, result.Err)
+		if !wait(ctx, time.Duration(result.Attempts)*time.Second) {
+			break
+		}
+	}
+	if result.Err == nil {
+		if fi, err := os.Stat(entry.Destination); err == nil {
+			result.Size = fi.Size()
+		}
+	}
+	result.Duration = time.Since(start)
+	return result
+}
+
+// wait 等待 d，ctx 结束时返回 false
+func wait(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// sourceWithChecksum 把校验值放进 go-getter 的 checksum 参数
+func sourceWithChecksum(entry Entry) string {
+	if entry.Checksum == "" {
+		return entry.URL
+	}
+	sep := "?"
+	if strings.Contains(entry.URL, "?") {
+		sep = "&"
+	}
+	return entry.URL + sep + "checksum=" + url.QueryEscape(entry.Checksum)
+}
+
+// WriteReport 输出 csv 格式的下载报告
+func WriteReport(w io.Writer, results []Result) error {
+	writer := csv.NewWriter(w)
+	_ = writer.Write([]string{"url", "destination", "status", "attempts", "size", "duration", "error"})
+	for _, r := range results {
+		status, errMsg := "ok", ""
+		if r.Err != nil {
+			status, errMsg = "failed", r.Err.Error()
+		}
+		_ = writer.Write([]string{
+			r.Entry.URL,
+			r.Entry.Destination,
+			status,
+			strconv.Itoa(r.Attempts),
+			strconv.FormatInt(r.Size, 10),
+			r.Duration.Round(time.Millisecond).String(),
+			errMsg,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func summary(results []Result) string {
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	return fmt.Sprintf("total %d, success %d, failed %d", len(results), len(results)-failed, failed)
+}
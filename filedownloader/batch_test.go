@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"go-web-study/downloader"
+
+	"github.com/chixm/filedownloader"
+)
+
+func TestDownloadAll(t *testing.T) {
+	content := []byte("tool bundle")
+	lock := sync.Mutex{}
+	requests := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "HEAD" {
+			return
+		}
+		lock.Lock()
+		requests[r.URL.Path]++
+		n := requests[r.URL.Path]
+		lock.Unlock()
+		if got := r.Header.Get("X-Site"); got != "sy" {
+			t.Errorf("%s: X-Site = %q, want sy from the configured client", r.URL.Path, got)
+		}
+		switch r.URL.Path {
+		case "/flaky":
+			// 第一次失败，重试后成功
+			if n == 1 {
+				http.Error(w, "busy", http.StatusServiceUnavailable)
+				return
+			}
+		case "/private":
+			if got := r.Header.Get("Authorization"); got != "Bearer x" {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+		case "/missing":
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(content)
+	}))
+	defer srv.Close()
+
+	client, err := downloader.NewClient(downloader.ClientConfig{Headers: map[string]string{"X-Site": "sy"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	sum := sha256.Sum256(content)
+	entries := []Entry{
+		{URL: srv.URL + "/flaky", Destination: filepath.Join(dir, "flaky")},
+		{URL: srv.URL + "/private", Destination: filepath.Join(dir, "sub", "private"), Headers: map[string]string{"Authorization": "Bearer x"}},
+		{URL: srv.URL + "/sum", Destination: filepath.Join(dir, "sum"), Checksum: "sha256:" + hex.EncodeToString(sum[:])},
+		{URL: srv.URL + "/bad-sum", Destination: filepath.Join(dir, "bad-sum"), Checksum: "sha256:" + hex.EncodeToString(make([]byte, 32))},
+		{URL: srv.URL + "/missing", Destination: filepath.Join(dir, "missing")},
+	}
+	results := DownloadAll(context.Background(), client, entries, filedownloader.Config{MaxDownloadThreads: 2, MaxRetry: 1})
+
+	want := []struct {
+		ok       bool
+		attempts int
+	}{{true, 2}, {true, 1}, {true, 1}, {false, 2}, {false, 2}}
+	for i, r := range results {
+		if (r.Err == nil) != want[i].ok || r.Attempts != want[i].attempts {
+			t.Errorf("%s: err = %v, attempts = %d, want ok %v after %d", r.Entry.URL, r.Err, r.Attempts, want[i].ok, want[i].attempts)
+		}
+		if r.Err == nil {
+			got, err := ioutil.ReadFile(r.Entry.Destination)
+			if err != nil || !bytes.Equal(got, content) || r.Size != int64(len(content)) {
+				t.Errorf("%s: content = %q, size %d, %v", r.Entry.URL, got, r.Size, err)
+			}
+		}
+	}
+	if http.DefaultClient.Transport != nil {
+		t.Error("DownloadAll changed http.DefaultClient")
+	}
+
+	buf := bytes.Buffer{}
+	if err := WriteReport(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil || len(records) != 6 || records[4][2] != "failed" || records[4][3] != "2" || records[1][2] != "ok" {
+		t.Errorf("report = %q, %v", records, err)
+	}
+	if got := summary(results); got != "total 5, success 3, failed 2" {
+		t.Errorf("summary = %q", got)
+	}
+}
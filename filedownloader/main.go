@@ -1,14 +1,80 @@
 package main
 
 import (
-	"github.com/chixm/filedownloader"
+	"context"
+	"flag"
 	"log"
+	"net/http"
+	"os"
+
+	"go-web-study/downloader"
+
+	"github.com/chixm/filedownloader"
+)
+
+var (
+	manifest = flag.String("manifest", "", "download manifest file (.csv/.json/.yaml) with url, destination, checksum, headers")
+	threads  = flag.Int("threads", 3, "parallel download threads")
+	retry    = flag.Int("retry", 2, "retry count for each failed entry")
+	timeout  = flag.Int("timeout", 60, "timeout in minutes for the whole batch")
+	report   = flag.String("report", "", "write csv results report to this file, default stdout")
+
+	clientConfig downloader.ClientConfig
+	// 默认工作日 8 点到 20 点限速 10MB/s，-rate 0 关闭
+	throttleFlags = downloader.ThrottleFlags{Rate: 10 << 20, Weekdays: "mon-fri", Hours: "8-20"}
 )
 
+func init() {
+	downloader.RegisterClientFlags(flag.CommandLine, &clientConfig)
+	downloader.RegisterThrottleFlags(flag.CommandLine, &throttleFlags)
+}
+
 func main() {
-	fdl := filedownloader.New(nil)
-	err := fdl.SimpleFileDownload(`https://dl.google.com/go/go1.17.windows-amd64.msi`, "go1.17.msi")
+	flag.Parse()
+
+	throttleConfig, err := throttleFlags.Config()
 	if err != nil {
+		log.Fatal(err)
+	}
+	client, err := downloader.NewClient(clientConfig, downloader.NewThrottle(throttleConfig))
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(download(client))
+}
+
+func download(client *http.Client) int {
+	// 没有清单时下载默认的安装包
+	entries := []Entry{{URL: "https://dl.google.com/go/go1.17.windows-amd64.msi", Destination: "go1.17.msi"}}
+	var err error
+	if *manifest != "" {
+		if entries, err = LoadManifest(*manifest); err != nil {
+			log.Println(err)
+			return 2
+		}
+		log.Printf("load %d entries from [%s]", len(entries), *manifest)
+	}
+
+	config := filedownloader.Config{MaxDownloadThreads: *threads, MaxRetry: *retry, DownloadTimeoutMinutes: *timeout}
+	results := DownloadAll(context.Background(), client, entries, config)
+
+	out := os.Stdout
+	if *report != "" {
+		if out, err = os.Create(*report); err != nil {
+			log.Println(err)
+			return 2
+		}
+		defer out.Close()
+	}
+	if err := WriteReport(out, results); err != nil {
 		log.Println(err)
+		return 2
+	}
+	log.Println(summary(results))
+	for _, r := range results {
+		if r.Err != nil {
+			return 1
+		}
 	}
+	return 0
 }
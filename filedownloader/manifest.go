@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Entry 清单中的一个下载项
+// checksum 形如 sha256:xxxx，支持 md5/sha1/sha256/sha512
+type Entry struct {
+	URL         string            `json:"url" yaml:"url"`
+	Destination string            `json:"destination" yaml:"destination"`
+	Checksum    string            `json:"checksum" yaml:"checksum"`
+	Headers     map[string]string `json:"headers" yaml:"headers"`
+}
+
+// LoadManifest 按扩展名读取 csv/json/yaml 格式的下载清单
+func LoadManifest(fileName string) ([]Entry, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []Entry
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		entries, err = readCSVManifest(file)
+	case ".json":
+		err = json.NewDecoder(file).Decode(&entries)
+	case ".yaml", ".yml":
+		var content []byte
+		if content, err = ioutil.ReadAll(file); err == nil {
+			err = yaml.Unmarshal(content, &entries)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported manifest format [%s]", fileName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse manifest [%s] failed: %v", fileName, err)
+	}
+
+	// 目标文件相同的下载项会相互覆盖，按清理后的路径检查
+	destinations := make(map[string]int)
+	for i, entry := range entries {
+		if entry.URL == "" {
+			return nil, fmt.Errorf("manifest entry %d has no url", i+1)
+		}
+		if entry.Destination == "" {
+			entries[i].Destination = filepath.Base(strings.SplitN(entry.URL, "?", 2)[0])
+		}
+		dst := filepath.Clean(entries[i].Destination)
+		if prev, ok := destinations[dst]; ok {
+			return nil, fmt.Errorf("manifest entries %d and %d have the same destination [%s]", prev+1, i+1, dst)
+		}
+		destinations[dst] = i
+	}
+	return entries, nil
+}
+
+// readCSVManifest 第一行为表头: url,destination,checksum,headers
+// headers 列形如 "Authorization: Bearer xxx; X-Site: sy"
+func readCSVManifest(r io.Reader) ([]Entry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["url"]; !ok {
+		return nil, fmt.Errorf("csv header must contain url column")
+	}
+	get := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var entries []Entry
+	for _, record := range records[1:] {
+		entry := Entry{
+			URL:         get(record, "url"),
+			Destination: get(record, "destination"),
+			Checksum:    get(record, "checksum"),
+		}
+		if headers := get(record, "headers"); headers != "" {
+			entry.Headers = make(map[string]string)
+			for _, kv := range strings.Split(headers, ";") {
+				pair := strings.SplitN(kv, ":", 2)
+				if len(pair) != 2 {
+					return nil, fmt.Errorf("invalid header [%s]", kv)
+				}
+				entry.Headers[strings.TrimSpace(pair[0])] = strings.TrimSpace(pair[1])
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeManifest(t *testing.T, name, content string) string {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(fileName, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func TestLoadManifest(t *testing.T) {
+	want := []Entry{
+		{URL: "http://mirror/a.tgz", Destination: "tools/a.tgz", Checksum: "sha256:abc",
+			Headers: map[string]string{"Authorization": "Bearer x", "X-Site": "sy"}},
+		// 没有目标路径时使用 url 的文件名
+		{URL: "http://mirror/b.zip?token=1", Destination: "b.zip"},
+	}
+	cases := []struct {
+		name, content string
+	}{
+		{"m.csv", "URL, destination, checksum, headers\n" +
+			"http://mirror/a.tgz,tools/a.tgz,sha256:abc,Authorization: Bearer x; X-Site: sy\n" +
+			"http://mirror/b.zip?token=1\n"},
+		{"m.json", `[{"url": "http://mirror/a.tgz", "destination": "tools/a.tgz", "checksum": "sha256:abc",
+			"headers": {"Authorization": "Bearer x", "X-Site": "sy"}},
+			{"url": "http://mirror/b.zip?token=1"}]`},
+		{"m.yaml", `
+- url: http://mirror/a.tgz
+  destination: tools/a.tgz
+  checksum: sha256:abc
+  headers:
+    Authorization: Bearer x
+    X-Site: sy
+- url: http://mirror/b.zip?token=1
+`},
+	}
+	for _, c := range cases {
+		entries, err := LoadManifest(writeManifest(t, c.name, c.content))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(entries, want) {
+			t.Errorf("%s: entries = %+v, want %+v", c.name, entries, want)
+		}
+	}
+}
+
+func TestLoadManifestErrors(t *testing.T) {
+	cases := []struct {
+		name, content, err string
+	}{
+		{"m.csv", "url,destination\nhttp://mirror/a.tgz,out/a.tgz\nhttp://other/a.tgz,out/./a.tgz\n", "same destination"},
+		// 默认目标路径也参与检查
+		{"m.csv", "url,destination\nhttp://mirror/a.tgz,\nhttp://other/x,a.tgz\n", "same destination"},
+		{"m.json", `[{"url": "http://mirror/a.tgz", "destination": "x/../a.tgz"}, {"url": "http://other/a.tgz"}]`, "same destination"},
+		{"m.csv", "destination\nout/a.tgz\n", "url column"},
+		{"m.csv", "url,headers\nhttp://mirror/a.tgz,Authorization\n", "invalid header"},
+		{"m.json", `[{"destination": "a"}]`, "has no url"},
+		{"m.json", `{"url": "http://mirror/a.tgz"}`, "parse manifest"},
+		{"m.txt", "http://mirror/a.tgz", "unsupported manifest format"},
+	}
+	for _, c := range cases {
+		_, err := LoadManifest(writeManifest(t, c.name, c.content))
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s %q: error = %v, want %q", c.name, c.content, err, c.err)
+		}
+	}
+}
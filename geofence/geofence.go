@@ -0,0 +1,98 @@
+package geofence
+
+import (
+	"fmt"
+
+	"go-web-study/coord"
+	"go-web-study/track"
+)
+
+const (
+	TypeCircle  = "circle"
+	TypePolygon = "polygon"
+)
+
+// Fence 电子围栏，圆形使用 Center+Radius(米)，多边形使用 Points，坐标均为 Datum 坐标系下的 [经度, 纬度]。
+// Terminals 为空时对所有终端生效
+type Fence struct {
+	Name      string      `json:"name" mapstructure:"name"`
+	Type      string      `json:"type" mapstructure:"type"`
+	Datum     string      `json:"datum" mapstructure:"datum"`
+	Center    []float64   `json:"center" mapstructure:"center"`
+	Radius    float64     `json:"radius" mapstructure:"radius"`
+	Points    [][]float64 `json:"points" mapstructure:"points"`
+	Terminals []string    `json:"terminals" mapstructure:"terminals"`
+	datum     coord.Datum
+}
+
+// Validate 检查配置并解析坐标系，使用前必须调用
+func (f *Fence) Validate() error {
+	if f.Name == "" {
+		return fmt.Errorf("geofence has no name")
+	}
+	datum, err := coord.ParseDatum(f.Datum)
+	if err != nil {
+		return fmt.Errorf("geofence %s: %v", f.Name, err)
+	}
+	f.datum = datum
+	switch f.Type {
+	case TypeCircle:
+		if len(f.Center) != 2 || f.Radius <= 0 {
+			return fmt.Errorf("geofence %s: circle needs center [lon, lat] and a positive radius", f.Name)
+		}
+	case TypePolygon:
+		if len(f.Points) < 3 {
+			return fmt.Errorf("geofence %s: polygon needs at least 3 points", f.Name)
+		}
+		for _, p := range f.Points {
+			if len(p) != 2 {
+				return fmt.Errorf("geofence %s: polygon point must be [lon, lat]", f.Name)
+			}
+		}
+	default:
+		return fmt.Errorf("geofence %s: unknown type %q", f.Name, f.Type)
+	}
+	return nil
+}
+
+// AppliesTo 围栏是否对终端生效
+func (f *Fence) AppliesTo(terminalID string) bool {
+	if len(f.Terminals) == 0 {
+		return true
+	}
+	for _, id := range f.Terminals {
+		if id == terminalID {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains 点是否在围栏内，点先转换到围栏的坐标系，无法转换时认为不在围栏内
+func (f *Fence) Contains(p coord.Point) bool {
+	p, err := p.To(f.datum)
+	if err != nil {
+		return false
+	}
+	switch f.Type {
+	case TypeCircle:
+		center := coord.Point{Lon: f.Center[0], Lat: f.Center[1], Datum: f.datum}
+		return track.Haversine(center, p) <= f.Radius
+	case TypePolygon:
+		return inPolygon(f.Points, p.Lon, p.Lat)
+	}
+	return false
+}
+
+// inPolygon 射线法，围栏范围较小，直接在经纬度平面上计算
+func inPolygon(points [][]float64, lon, lat float64) bool {
+	inside := false
+	for i, j := 0, len(points)-1; i < len(points); j, i = i, i+1 {
+		xi, yi := points[i][0], points[i][1]
+		xj, yj := points[j][0], points[j][1]
+		if (yi > lat) != (yj > lat) && lon < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
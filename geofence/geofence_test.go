@@ -0,0 +1,52 @@
+package geofence
+
+import (
+	"testing"
+
+	"go-web-study/coord"
+)
+
+func TestContains(t *testing.T) {
+	square := Fence{Name: "square", Type: TypePolygon, Datum: "wgs84",
+		Points: [][]float64{{123.0, 41.0}, {123.1, 41.0}, {123.1, 41.1}, {123.0, 41.1}}}
+	circle := Fence{Name: "circle", Type: TypeCircle, Datum: "wgs84", Center: []float64{123.0, 41.0}, Radius: 100}
+	for _, f := range []*Fence{&square, &circle} {
+		if err := f.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gcj, _ := coord.Point{Lon: 123.0, Lat: 41.0, Datum: coord.WGS84}.To(coord.GCJ02)
+	cases := []struct {
+		fence *Fence
+		p     coord.Point
+		want  bool
+	}{
+		{&square, coord.Point{Lon: 123.05, Lat: 41.05, Datum: coord.WGS84}, true},
+		{&square, coord.Point{Lon: 123.15, Lat: 41.05, Datum: coord.WGS84}, false},
+		{&circle, coord.Point{Lon: 123.0005, Lat: 41.0, Datum: coord.WGS84}, true},
+		{&circle, coord.Point{Lon: 123.002, Lat: 41.0, Datum: coord.WGS84}, false},
+		// 圆心的 GCJ02 坐标与圆心是同一个位置
+		{&circle, gcj, true},
+		{&circle, coord.Point{Lon: 123.0, Lat: 41.0, Datum: "UTM"}, false},
+	}
+	for _, c := range cases {
+		if got := c.fence.Contains(c.p); got != c.want {
+			t.Errorf("%s.Contains(%+v) = %v, want %v", c.fence.Name, c.p, got, c.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	bad := []Fence{
+		{Type: TypeCircle, Center: []float64{1, 1}, Radius: 1},
+		{Name: "a", Type: TypeCircle, Center: []float64{1, 1}},
+		{Name: "a", Type: TypePolygon, Points: [][]float64{{1, 1}, {2, 2}}},
+		{Name: "a", Type: "square"},
+		{Name: "a", Type: TypeCircle, Datum: "utm", Center: []float64{1, 1}, Radius: 1},
+	}
+	for _, f := range bad {
+		if err := f.Validate(); err == nil {
+			t.Errorf("Validate(%+v) should fail", f)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package geofence
+
+import (
+	"time"
+
+	"go-web-study/storage"
+
+	"gorm.io/gorm"
+)
+
+// eventV1 第 1 版发布时的表结构，迁移使用固定的结构，模型以后的改动不会影响已发布的版本
+type eventV1 struct {
+	ID         uint64    `gorm:"primaryKey;autoIncrement;column:id"`
+	TerminalID string    `gorm:"type:varchar(32);not null;column:terminal_id;index:idx_terminal_fence,priority:1"`
+	Fence      string    `gorm:"type:varchar(64);not null;column:fence;index:idx_terminal_fence,priority:2"`
+	Type       string    `gorm:"type:varchar(8);not null;column:type"`
+	Longitude  float64   `gorm:"column:longitude"`
+	Latitude   float64   `gorm:"column:latitude"`
+	GpsTime    int64     `gorm:"type:bigint;column:gps_time"`
+	Dwell      int64     `gorm:"type:bigint;column:dwell"`
+	CreatedAt  time.Time `gorm:"column:created_at"`
+}
+
+func (eventV1) TableName() string {
+	return "tb_geofence_event"
+}
+
+// migrations 只能追加，不能修改已发布的版本
+var migrations = []storage.Migration{
+	{Version: 1, Name: "create tb_geofence_event", Up: func(tx *gorm.DB) error {
+		// 之前由服务启动时 AutoMigrate 建的表与第 1 版相同，再次执行不会改变
+		return tx.AutoMigrate(&eventV1{})
+	}},
+}
+
+// Migrate 执行 tb_geofence_event 尚未执行的迁移，记录在 geofence_schema_migrations 表中
+func Migrate(db *gorm.DB) error {
+	return storage.Migrate(db, "geofence_schema_migrations", migrations)
+}
@@ -0,0 +1,46 @@
+package geofence
+
+import (
+	"path/filepath"
+	"testing"
+
+	"go-web-study/storage"
+)
+
+func TestMigrate(t *testing.T) {
+	db, err := storage.Open(storage.Config{DSN: "sqlite://" + filepath.Join(t.TempDir(), "geofence.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 升级前服务启动时直接 AutoMigrate 建表
+	if err := db.AutoMigrate(&eventV1{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&Event{TerminalID: "a", Fence: "park", Type: EventEnter, GpsTime: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := Migrate(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var versions []int
+	if err := db.Table("geofence_schema_migrations").Order("version").Pluck("version", &versions).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != len(migrations) || versions[0] != 1 {
+		t.Errorf("applied versions = %v, want %d", versions, len(migrations))
+	}
+	var n int64
+	if err := db.Model(&Event{}).Count(&n).Error; err != nil || n != 1 {
+		t.Errorf("Count = %d, %v, want the existing event kept", n, err)
+	}
+	if !db.Migrator().HasIndex(&Event{}, "idx_terminal_fence") {
+		t.Error("idx_terminal_fence missing")
+	}
+	// 迁移之后的表可以直接写入当前模型
+	if err := db.Create(&Event{TerminalID: "a", Fence: "park", Type: EventExit, GpsTime: 2, Dwell: 60}).Error; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,193 @@
+package geofence
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go-web-study/coord"
+	"go-web-study/gpslog"
+)
+
+const (
+	EventEnter = "enter"
+	EventExit  = "exit"
+)
+
+// Event 进出围栏事件，Dwell 为离开时在围栏内停留的时长(秒)
+type Event struct {
+	ID         uint64    `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	TerminalID string    `json:"terminalId" gorm:"type:varchar(32);not null;column:terminal_id;index:idx_terminal_fence,priority:1"`
+	Fence      string    `json:"fence" gorm:"type:varchar(64);not null;column:fence;index:idx_terminal_fence,priority:2"`
+	Type       string    `json:"type" gorm:"type:varchar(8);not null;column:type"`
+	Longitude  float64   `json:"longitude" gorm:"column:longitude"`
+	Latitude   float64   `json:"latitude" gorm:"column:latitude"`
+	GpsTime    int64     `json:"gpsTime" gorm:"type:bigint;column:gps_time"`
+	Dwell      int64     `json:"dwell" gorm:"type:bigint;column:dwell"`
+	CreatedAt  time.Time `json:"createdAt" gorm:"column:created_at"`
+}
+
+func (Event) TableName() string {
+	return "tb_geofence_event"
+}
+
+type state struct {
+	inside bool
+	since  int64
+}
+
+// Monitor 记录每个终端相对每个围栏的状态，根据新定位产生进出事件
+type Monitor struct {
+	Fences []Fence
+
+	lock   sync.Mutex
+	states map[string]state
+}
+
+// NewMonitor 检查围栏配置，围栏名用于区分状态和事件，不能重复
+func NewMonitor(fences []Fence) (*Monitor, error) {
+	names := make(map[string]bool, len(fences))
+	for i := range fences {
+		if err := fences[i].Validate(); err != nil {
+			return nil, err
+		}
+		if names[fences[i].Name] {
+			return nil, fmt.Errorf("duplicate geofence name %s", fences[i].Name)
+		}
+		names[fences[i].Name] = true
+	}
+	return &Monitor{Fences: fences, states: map[string]state{}}, nil
+}
+
+// Restore 用每个终端每个围栏最近的一条事件恢复状态，重启后不会重复产生或丢失进出事件
+func (m *Monitor) Restore(events []Event) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, e := range events {
+		m.states[e.TerminalID+"\x00"+e.Fence] = state{inside: e.Type == EventEnter, since: e.GpsTime}
+	}
+}
+
+// Update 用新的定位点更新状态。终端第一次出现在围栏内时产生 enter 事件，第一次出现在围栏外时只记录状态
+func (m *Monitor) Update(gps gpslog.GPS) []Event {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var events []Event
+	p := coord.Point{Lon: gps.Longitude, Lat: gps.Latitude, Datum: coord.WGS84}
+	for i := range m.Fences {
+		f := &m.Fences[i]
+		if !f.AppliesTo(gps.TerminalID) {
+			continue
+		}
+		key := gps.TerminalID + "\x00" + f.Name
+		inside := f.Contains(p)
+		prev, ok := m.states[key]
+		if ok && prev.inside == inside {
+			continue
+		}
+		m.states[key] = state{inside: inside, since: gps.GpsTime}
+		if !ok && !inside {
+			continue
+		}
+		event := Event{
+			TerminalID: gps.TerminalID,
+			Fence:      f.Name,
+			Type:       EventEnter,
+			Longitude:  gps.Longitude,
+			Latitude:   gps.Latitude,
+			GpsTime:    gps.GpsTime,
+		}
+		if !inside {
+			event.Type = EventExit
+			event.Dwell = (gps.GpsTime - prev.since) / 1000
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// Notifier 以 json 形式把事件 POST 到 webhook。Enqueue 把事件放入有界队列，由 Run 在后台逐个发送，
+// webhook 响应慢时不会阻塞定位
+type Notifier struct {
+	URL    string
+	Client *http.Client
+	// Timeout 单次推送的超时时间
+	Timeout time.Duration
+	// OnError 推送失败或队列已满时回调，可以为空
+	OnError func(event Event, err error)
+
+	queue chan Event
+}
+
+func NewNotifier(url string, client *http.Client, queueSize int) *Notifier {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if queueSize <= 0 {
+		queueSize = 1
+	}
+	return &Notifier{URL: url, Client: client, Timeout: 10 * time.Second, queue: make(chan Event, queueSize)}
+}
+
+// Enqueue 不阻塞，队列已满时丢弃事件并返回 false，事件已经保存在数据库中
+func (n *Notifier) Enqueue(event Event) bool {
+	select {
+	case n.queue <- event:
+		return true
+	default:
+		n.reportError(event, fmt.Errorf("webhook queue is full"))
+		return false
+	}
+}
+
+// Run 发送队列中的事件，直到 ctx 结束
+func (n *Notifier) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-n.queue:
+			if err := n.Notify(ctx, event); err != nil && ctx.Err() == nil {
+				n.reportError(event, err)
+			}
+		}
+	}
+}
+
+func (n *Notifier) reportError(event Event, err error) {
+	if n.OnError != nil {
+		n.OnError(event, err)
+	}
+}
+
+// Notify 同步发送一个事件
+func (n *Notifier) Notify(ctx context.Context, event Event) error {
+	if n.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.Timeout)
+		defer cancel()
+	}
+	body, _ := json.Marshal(event)
+	req, err := http.NewRequestWithContext(ctx, "POST", n.URL, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json;charset=UTF-8")
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s returned %s", n.URL, resp.Status)
+	}
+	return nil
+}
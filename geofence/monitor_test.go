@@ -0,0 +1,158 @@
+package geofence
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-web-study/gpslog"
+	"go-web-study/storage"
+)
+
+func newTestMonitor(t *testing.T) *Monitor {
+	m, err := NewMonitor([]Fence{{Name: "park", Type: TypeCircle, Datum: "wgs84", Center: []float64{123.0, 41.0}, Radius: 100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func gpsAt(lon float64, seconds int64) gpslog.GPS {
+	return gpslog.GPS{TerminalID: "a", Longitude: lon, Latitude: 41.0, GpsTime: seconds * 1000}
+}
+
+func TestMonitorUpdate(t *testing.T) {
+	m := newTestMonitor(t)
+	inside, outside := 123.0, 123.01
+
+	// 第一次出现在围栏外只记录状态
+	if events := m.Update(gpsAt(outside, 0)); len(events) != 0 {
+		t.Errorf("first point outside = %+v, want no event", events)
+	}
+	events := m.Update(gpsAt(inside, 10))
+	if len(events) != 1 || events[0].Type != EventEnter || events[0].Fence != "park" {
+		t.Fatalf("enter = %+v", events)
+	}
+	if events := m.Update(gpsAt(inside, 20)); len(events) != 0 {
+		t.Errorf("still inside = %+v, want no event", events)
+	}
+	events = m.Update(gpsAt(outside, 70))
+	if len(events) != 1 || events[0].Type != EventExit || events[0].Dwell != 60 {
+		t.Errorf("exit = %+v, want dwell 60", events)
+	}
+}
+
+func TestMonitorRestore(t *testing.T) {
+	m := newTestMonitor(t)
+	m.Restore([]Event{{TerminalID: "a", Fence: "park", Type: EventEnter, GpsTime: 10000}})
+	// 重启前已经在围栏内，不再产生 enter
+	if events := m.Update(gpsAt(123.0, 20)); len(events) != 0 {
+		t.Errorf("inside after restore = %+v, want no event", events)
+	}
+	events := m.Update(gpsAt(123.01, 40))
+	if len(events) != 1 || events[0].Type != EventExit || events[0].Dwell != 30 {
+		t.Errorf("exit after restore = %+v, want dwell 30", events)
+	}
+
+	// 重启前在围栏内，重启后第一个点在围栏外时产生 exit
+	m = newTestMonitor(t)
+	m.Restore([]Event{{TerminalID: "a", Fence: "park", Type: EventEnter, GpsTime: 10000}})
+	if events := m.Update(gpsAt(123.01, 20)); len(events) != 1 || events[0].Type != EventExit {
+		t.Errorf("first point outside after restore = %+v, want exit", events)
+	}
+}
+
+func TestDuplicateFenceName(t *testing.T) {
+	f := Fence{Name: "park", Type: TypeCircle, Center: []float64{123.0, 41.0}, Radius: 100}
+	if _, err := NewMonitor([]Fence{f, f}); err == nil {
+		t.Error("NewMonitor with duplicate names should fail")
+	}
+}
+
+func TestLatestEvents(t *testing.T) {
+	db, err := storage.Open(storage.Config{DSN: "sqlite://" + filepath.Join(t.TempDir(), "geofence.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	events := []Event{
+		{TerminalID: "a", Fence: "park", Type: EventEnter, GpsTime: 1},
+		{TerminalID: "a", Fence: "park", Type: EventExit, GpsTime: 2},
+		{TerminalID: "a", Fence: "zone", Type: EventEnter, GpsTime: 3},
+		{TerminalID: "b", Fence: "park", Type: EventEnter, GpsTime: 4},
+	}
+	if err := db.Create(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	latest, err := LatestEvents(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int64{}
+	for _, e := range latest {
+		got[e.TerminalID+"/"+e.Fence] = e.GpsTime
+	}
+	if len(got) != 3 || got["a/park"] != 2 || got["a/zone"] != 3 || got["b/park"] != 4 {
+		t.Errorf("LatestEvents = %+v", latest)
+	}
+}
+
+func TestNotifierQueue(t *testing.T) {
+	received := make(chan Event, 10)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := Event{}
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		received <- event
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	n := NewNotifier(srv.URL, srv.Client(), 1)
+	n.Timeout = time.Second
+	dropped := 0
+	n.OnError = func(event Event, err error) { dropped++ }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Run(ctx)
+
+	// 第一个事件发送中阻塞，第二个在队列中，第三个被丢弃，Enqueue 始终不阻塞
+	start := time.Now()
+	if !n.Enqueue(Event{Fence: "1"}) {
+		t.Fatal("first Enqueue failed")
+	}
+	if e := <-received; e.Fence != "1" {
+		t.Errorf("received %+v", e)
+	}
+	if !n.Enqueue(Event{Fence: "2"}) {
+		t.Error("second Enqueue failed")
+	}
+	if n.Enqueue(Event{Fence: "3"}) || dropped != 1 {
+		t.Errorf("third Enqueue should be dropped, dropped = %d", dropped)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("Enqueue blocked for %s", d)
+	}
+}
+
+func TestNotifyTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	n := NewNotifier(srv.URL, srv.Client(), 1)
+	n.Timeout = 50 * time.Millisecond
+	if err := n.Notify(context.Background(), Event{}); err == nil {
+		t.Error("Notify to a hanging webhook should time out")
+	}
+}
@@ -0,0 +1,16 @@
+package geofence
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// LatestEvents 返回每个终端每个围栏最近的一条事件，用于 Monitor.Restore
+func LatestEvents(ctx context.Context, db *gorm.DB) ([]Event, error) {
+	var events []Event
+	err := db.WithContext(ctx).
+		Where("id IN (?)", db.Model(&Event{}).Select("MAX(id)").Group("terminal_id, fence")).
+		Find(&events).Error
+	return events, err
+}
@@ -1,9 +1,27 @@
 package main
 
-import "github.com/hashicorp/go-getter"
+import (
+	"context"
+	"flag"
+	"log"
+
+	"go-web-study/downloader"
+)
+
+var (
+	src = flag.String("src", "https://dl.google.com/go/go1.17.windows-amd64.msi", "go-getter style source, e.g. file:///mirror/a.zip, s3::http://127.0.0.1:9000/bucket/key, https://host/a.tar.gz?checksum=sha256:xxx")
+	dst = flag.String("dst", "111.msi", "destination file, or directory when -dir is set")
+	dir = flag.Bool("dir", false, "download into a directory, archives are unpacked")
+)
 
 func main() {
-	if err := getter.Get("111.msi", "https://dl.google.com/go/go1.17.windows-amd64.msi"); err != nil {
-		panic(err.Error())
+	flag.Parse()
+	fetcher := downloader.NewFetcher(nil)
+	fetch := fetcher.FetchFile
+	if *dir {
+		fetch = fetcher.FetchDir
+	}
+	if err := fetch(context.Background(), *src, *dst); err != nil {
+		log.Fatal(err)
 	}
 }
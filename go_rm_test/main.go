@@ -1,60 +1,91 @@
 package main
 
 import (
-	"encoding/json"
+	"bufio"
+	"context"
+	"flag"
 	"fmt"
-	"gorm.io/driver/mysql"
-	"gorm.io/gorm"
-	"io/ioutil"
+	"go-web-study/device"
+	"go-web-study/storage"
+	"log"
+	"os"
+	"strings"
 	"time"
 )
 
-type Device struct {
-	CommandType string
-	Item        []DeviceInfo
-}
-
-type DeviceInfo struct {
-	IsCatalog  uint8  `json:"IsCatalog" gorm:"-"`
-	Name       string `json:"Name" gorm:"name"`
-	GbDeviceId string `json:"SubDeviceID" gorm:"gb_device_id"`
-	Latitude   string `json:"Latitude" gorm:"latitude"`
-	Longitude  string `json:"Longitude" gorm:"longitude"`
-}
+var dbConfig = storage.RegisterFlags(flag.CommandLine)
 
-func FilterSlice(s []DeviceInfo) []DeviceInfo {
-	newS := s[:0]
-	for _, x := range s {
-		if x.IsCatalog == 0 {
-			newS = append(newS, x)
-		}
-	}
-	return newS
+// confirm 等待输入 y 确认
+func confirm(prompt string) bool {
+	fmt.Printf("%s [y/N] ", prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
 }
 
+// 以 GbDeviceId 为键把目录同步到 test_device：新增、更新、把目录中消失的设备标记为停用，并写入 tb_device_change_log，
+// 目录节点的层级写入 tb_device_catalog
 func main() {
-	dsn := "root:ZIWio9noSmo@tcp(10.172.198.44:3306)/shenyang?charset=utf8mb4&parseTime=True&loc=Local"
-	db, _ := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	fileName := flag.String("file", "go_rm_test/devicelist20210701.txt", "GB28181 catalog, json dump or xml Catalog response")
+	tree := flag.Bool("tree", false, "print the catalog tree and exit")
+	dryRun := flag.Bool("dry-run", false, "only print the diff")
+	yes := flag.Bool("yes", false, "apply without confirmation")
+	batchSize := flag.Int("batch", 1000, "rows per insert, capped by the column count to stay under mysql's 65535 placeholders")
+	flag.Parse()
 
-	filepath := "D:\\07_GolandProjects\\project\\go-web-study\\go_rm_test\\devicelist20210701.txt"
-	content, err := ioutil.ReadFile(filepath)
+	now := time.Now()
+	catalog, err := device.LoadCatalog(*fileName)
 	if err != nil {
-		panic(err.Error)
+		log.Fatalf("读取目录失败 %v", err)
 	}
-	device := &Device{}
-	err = json.Unmarshal(content, device)
-	if err != nil {
-		panic(err)
+	catalogTree := device.BuildTree(catalog.Item)
+	if *tree {
+		if err := catalogTree.Write(os.Stdout, true); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
+	deviceInfos := catalog.Devices()
+	if len(deviceInfos) == 0 {
+		// 空目录会把所有设备标记为停用，多半是导出失败
+		log.Fatalf("目录%s中没有设备", *fileName)
+	}
+	for i := range deviceInfos {
+		deviceInfos[i].Path = catalogTree.Path(deviceInfos[i].GbDeviceId)
+	}
+	nodes := catalogTree.Nodes()
 
-	deviceInfos := FilterSlice(device.Item)
-	now := time.Now()
-	fmt.Println(now)
-
-	db.Table("test_device").CreateInBatches(deviceInfos, 5000)
-
-	db.Commit()
-
-	fmt.Println(time.Since(now))
+	db := storage.MustOpen(*dbConfig)
+	if err := device.Migrate(db); err != nil {
+		log.Fatalf("数据库迁移失败 %v", err)
+	}
+	repo := device.NewRepository(db)
+	ctx := context.Background()
+	existing, err := repo.All(ctx)
+	if err != nil {
+		log.Fatalf("查询设备失败 %v", err)
+	}
 
-}
\ No newline at end of file
+	plan := device.Diff(existing, deviceInfos)
+	if err := device.WritePlan(os.Stdout, plan); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("catalog nodes %d\n", len(nodes))
+	if *dryRun {
+		return
+	}
+	if !plan.Empty() && !*yes && !confirm("确认执行以上变更?") {
+		log.Println("已取消")
+		return
+	}
+	// 确认期间目录可能已被其它同步修改，Apply 在事务中重新比较，以实际执行的变更为准
+	syncID, applied, err := repo.Apply(ctx, deviceInfos, *batchSize)
+	if err != nil {
+		log.Fatalf("同步失败 %v", err)
+	}
+	log.Printf("新增%d，更新%d，停用%d", len(applied.Added), len(applied.Updated), len(applied.Removed))
+	if err := repo.ReplaceNodes(ctx, nodes, *batchSize); err != nil {
+		log.Fatalf("保存目录失败 %v", err)
+	}
+	log.Printf("同步完成，变更批次%s，耗时[%s]", syncID, time.Since(now))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"go-web-study/coord"
+	"go-web-study/gpslog"
+	"go-web-study/storage"
+)
+
+var dbConfig = storage.RegisterFlags(flag.CommandLine)
+
+var (
+	terminal = flag.String("terminal", "", "terminal id")
+	from     = flag.String("from", "", "start time, 2006-01-02 or 2006-01-02 15:04:05, default today 00:00")
+	to       = flag.String("to", "", "end time (exclusive), default now")
+	format   = flag.String("format", "", "gpx, kml or geojson, default by output file extension")
+	datum    = flag.String("datum", "wgs84", "coordinate datum, wgs84 or bd09")
+	output   = flag.String("o", "", "output file, default stdout")
+)
+
+var timeLayouts = []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+func parseTime(s string, def time.Time) (time.Time, error) {
+	if s == "" {
+		return def, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+func main() {
+	flag.Parse()
+	if *terminal == "" {
+		log.Fatal("-terminal is required")
+	}
+	now := time.Now()
+	start, err := parseTime(*from, time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local))
+	if err != nil {
+		log.Fatal(err)
+	}
+	end, err := parseTime(*to, now)
+	if err != nil {
+		log.Fatal(err)
+	}
+	d, err := coord.ParseDatum(*datum)
+	if err != nil {
+		log.Fatal(err)
+	}
+	f := *format
+	if f == "" {
+		f = gpslog.FormatFromFileName(*output)
+	}
+	if f == "" {
+		f = gpslog.FormatGeoJSON
+	}
+
+	db, err := storage.Open(*dbConfig)
+	if err != nil {
+		log.Fatalf("连接数据库失败 %v", err)
+	}
+	track, err := gpslog.NewStore(db).Track(context.Background(), *terminal, start, end)
+	if err != nil {
+		log.Fatalf("查询轨迹失败 %v", err)
+	}
+	log.Printf("终端%s在%s至%s共%d个定位点", *terminal, start.Format(timeLayouts[0]), end.Format(timeLayouts[0]), len(track))
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		w = file
+	}
+	name := fmt.Sprintf("%s %s", *terminal, start.Format("2006-01-02"))
+	if err := gpslog.Export(w, f, name, track, d); err != nil {
+		log.Fatalf("导出失败 %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"go-web-study/gpslog"
+	"go-web-study/storage"
+	"go-web-study/track"
+)
+
+var dbConfig = storage.RegisterFlags(flag.CommandLine)
+
+var (
+	logFile   = flag.String("file", "", "read points from a gps.log, nmea, csv or gpx file instead of the database")
+	terminal  = flag.String("terminal", "", "terminal id, default all terminals")
+	from      = flag.String("from", "", "start date 2006-01-02, default 7 days ago, or the whole file with -file")
+	to        = flag.String("to", "", "end date 2006-01-02 (inclusive), default today, or the whole file with -file")
+	radius    = flag.Float64("stop-radius", track.DefaultStopConfig.Radius, "stop radius in meters")
+	dwell     = flag.Duration("stop-dwell", track.DefaultStopConfig.MinDwell, "minimum dwell time of a stop")
+	maxSpeed  = flag.Float64("max-speed", 200, "points implying a higher speed (km/h) are treated as GPS jumps")
+	showStops = flag.Bool("stops", false, "list every stop")
+)
+
+// ReadLog 读取定位文件，格式与 handler_gps_log 相同，自动识别 json/nmea/csv/gpx，错误行跳过
+func ReadLog(fileName, terminalID string) ([]gpslog.GPS, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader, _, err := gpslog.NewReader(gpslog.FormatAuto, fileName, file)
+	if err != nil {
+		return nil, err
+	}
+	var res []gpslog.GPS
+	for {
+		gps, _, err := reader.Read()
+		if err == io.EOF {
+			return res, nil
+		}
+		lineErr := &gpslog.LineError{}
+		if errors.As(err, &lineErr) {
+			log.Printf("%s:%d: %v", fileName, lineErr.Line, lineErr.Err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if gps.TerminalID == "" {
+			gps.TerminalID = terminalID
+		}
+		res = append(res, gps)
+	}
+}
+
+func parseDate(s string, def time.Time) time.Time {
+	if s == "" {
+		return def
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		log.Fatalf("invalid date %q", s)
+	}
+	return t
+}
+
+// loadTracks 返回终端 ID 到轨迹的映射
+func loadTracks(ctx context.Context) (map[string][]gpslog.GPS, []string, error) {
+	tracks := map[string][]gpslog.GPS{}
+	if *logFile != "" {
+		points, err := ReadLog(*logFile, *terminal)
+		if err != nil {
+			return nil, nil, err
+		}
+		// 文件模式下只在指定 -from/-to 时按日期过滤
+		var start, end time.Time
+		if *from != "" {
+			start = parseDate(*from, time.Time{})
+		}
+		if *to != "" {
+			end = parseDate(*to, time.Time{}).AddDate(0, 0, 1)
+		}
+		var terminals []string
+		for _, g := range points {
+			if *terminal != "" && g.TerminalID != *terminal {
+				continue
+			}
+			if t := g.Time(); (!start.IsZero() && t.Before(start)) || (!end.IsZero() && !t.Before(end)) {
+				continue
+			}
+			if _, ok := tracks[g.TerminalID]; !ok {
+				terminals = append(terminals, g.TerminalID)
+			}
+			tracks[g.TerminalID] = append(tracks[g.TerminalID], g)
+		}
+		return tracks, terminals, nil
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	start := parseDate(*from, today.AddDate(0, 0, -7))
+	end := parseDate(*to, today).AddDate(0, 0, 1)
+
+	db, err := storage.Open(*dbConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	store := gpslog.NewStore(db)
+	terminals := []string{*terminal}
+	if *terminal == "" {
+		if terminals, err = store.Terminals(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, id := range terminals {
+		if tracks[id], err = store.Track(ctx, id, start, end); err != nil {
+			return nil, nil, err
+		}
+	}
+	return tracks, terminals, nil
+}
+
+func main() {
+	flag.Parse()
+	tracks, terminals, err := loadTracks(context.Background())
+	if err != nil {
+		log.Fatalf("读取定位失败 %v", err)
+	}
+	config := track.StopConfig{Radius: *radius, MinDwell: *dwell}
+
+	var reports []track.DayReport
+	for _, id := range terminals {
+		reports = append(reports, track.Daily(id, tracks[id], config, *maxSpeed/3.6, time.Local)...)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TERMINAL\tDATE\tPOINTS\tOUTLIERS\tKM\tMAX KM/H\tTRIPS\tSTOPS\tSTOPPED")
+	for _, r := range reports {
+		stopped := time.Duration(0)
+		for _, s := range r.Stops {
+			stopped += s.Dwell()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.2f\t%.1f\t%d\t%d\t%s\n", r.TerminalID, r.Date, r.Points, r.Outliers,
+			r.Distance/1000, r.MaxSpeed*3.6, len(r.Trips), len(r.Stops), stopped)
+	}
+	_ = tw.Flush()
+
+	if !*showStops {
+		return
+	}
+	fmt.Println()
+	tw = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TERMINAL\tSTART\tEND\tDWELL\tLONGITUDE\tLATITUDE\tPOINTS")
+	for _, r := range reports {
+		for _, s := range r.Stops {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%.6f\t%.6f\t%d\n", r.TerminalID, s.Start.Format("2006-01-02 15:04:05"),
+				s.End.Format("15:04:05"), s.Dwell(), s.Center.Lon, s.Center.Lat, s.Points)
+		}
+	}
+	_ = tw.Flush()
+}
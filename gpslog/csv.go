@@ -0,0 +1,132 @@
+package gpslog
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-web-study/coord"
+)
+
+// csvColumns 表头别名，不区分大小写
+var csvColumns = map[string]string{
+	"terminal_id": "terminal", "terminalid": "terminal", "terminal": "terminal",
+	"longitude": "lon", "lon": "lon", "lng": "lon",
+	"latitude": "lat", "lat": "lat",
+	"gps_time": "time", "gpstime": "time", "time": "time", "timestamp": "time",
+	"datum": "datum",
+}
+
+// CSVReader 第一行为表头，至少包含经度、纬度和时间列。时间可以是毫秒/秒时间戳、RFC3339
+// 或本地时间 2006-01-02 15:04:05；没有 datum 列时使用 Datum
+type CSVReader struct {
+	Datum coord.Datum
+
+	reader  *csv.Reader
+	columns map[string]int
+	// records 已读取的记录数（含表头），字段内不含换行时即为行号
+	records int
+}
+
+func NewCSVReader(r io.Reader) *CSVReader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	return &CSVReader{Datum: coord.WGS84, reader: reader}
+}
+
+func (r *CSVReader) Read() (GPS, int, error) {
+	if r.columns == nil {
+		if err := r.readHeader(); err != nil {
+			return GPS{}, 1, err
+		}
+	}
+	record, err := r.reader.Read()
+	if err == io.EOF {
+		return GPS{}, r.records, io.EOF
+	}
+	r.records++
+	parseErr := &csv.ParseError{}
+	if errors.As(err, &parseErr) {
+		return GPS{}, parseErr.Line, &LineError{Line: parseErr.Line, Err: parseErr.Err}
+	}
+	if err != nil {
+		return GPS{}, r.records, err
+	}
+	line := r.records
+	gps, err := r.parse(record)
+	if err != nil {
+		return gps, line, &LineError{Line: line, Text: strings.Join(record, ","), Err: err}
+	}
+	return gps, line, nil
+}
+
+func (r *CSVReader) readHeader() error {
+	header, err := r.reader.Read()
+	if err != nil {
+		return err
+	}
+	r.records++
+	r.columns = map[string]int{}
+	for i, name := range header {
+		if column, ok := csvColumns[strings.ToLower(strings.TrimSpace(name))]; ok {
+			r.columns[column] = i
+		}
+	}
+	for _, column := range []string{"lon", "lat", "time"} {
+		if _, ok := r.columns[column]; !ok {
+			return fmt.Errorf("csv header has no %s column: %v", column, header)
+		}
+	}
+	return nil
+}
+
+func (r *CSVReader) field(record []string, column string) string {
+	i, ok := r.columns[column]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+func (r *CSVReader) parse(record []string) (GPS, error) {
+	lon, err := strconv.ParseFloat(r.field(record, "lon"), 64)
+	if err != nil {
+		return GPS{}, fmt.Errorf("invalid longitude %q", r.field(record, "lon"))
+	}
+	lat, err := strconv.ParseFloat(r.field(record, "lat"), 64)
+	if err != nil {
+		return GPS{}, fmt.Errorf("invalid latitude %q", r.field(record, "lat"))
+	}
+	gpsTime, err := ParseGpsTime(r.field(record, "time"))
+	if err != nil {
+		return GPS{}, err
+	}
+	datum := r.Datum
+	if s := r.field(record, "datum"); s != "" {
+		if datum, err = coord.ParseDatum(s); err != nil {
+			return GPS{}, err
+		}
+	}
+	return NewGPS(r.field(record, "terminal"), coord.Point{Lon: lon, Lat: lat, Datum: datum}, gpsTime)
+}
+
+// ParseGpsTime 解析为毫秒时间戳，小于 1e11 的整数按秒处理
+func ParseGpsTime(s string) (int64, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n < 1e11 {
+			n *= 1000
+		}
+		return n, nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006/01/02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t.UnixNano() / int64(time.Millisecond), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time %q", s)
+}
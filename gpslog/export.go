@@ -0,0 +1,225 @@
+package gpslog
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-web-study/coord"
+)
+
+const (
+	FormatGPX     = "gpx"
+	FormatKML     = "kml"
+	FormatGeoJSON = "geojson"
+)
+
+// FormatFromFileName 根据文件扩展名推断导出格式，无法识别时返回空串
+func FormatFromFileName(fileName string) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".gpx":
+		return FormatGPX
+	case ".kml":
+		return FormatKML
+	case ".geojson", ".json":
+		return FormatGeoJSON
+	}
+	return ""
+}
+
+// Export 按 format 输出轨迹，坐标使用 datum 坐标系。GPX/KML/GeoJSON 规范要求 WGS84，
+// 选择 BD09 时仅适用于百度地图等使用对应坐标系的工具
+func Export(w io.Writer, format, name string, track []GPS, datum coord.Datum) error {
+	switch format {
+	case FormatGPX:
+		return WriteGPX(w, name, track, datum)
+	case FormatKML:
+		return WriteKML(w, name, track, datum)
+	case FormatGeoJSON:
+		return WriteGeoJSON(w, name, track, datum)
+	}
+	return fmt.Errorf("unsupported format %q", format)
+}
+
+func formatTime(g GPS) string {
+	return g.Time().UTC().Format(time.RFC3339)
+}
+
+type gpx struct {
+	XMLName xml.Name `xml:"gpx"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Version string   `xml:"version,attr"`
+	Creator string   `xml:"creator,attr"`
+	Trk     gpxTrk   `xml:"trk"`
+}
+
+type gpxTrk struct {
+	Name   string      `xml:"name"`
+	Desc   string      `xml:"desc,omitempty"`
+	TrkSeg []gpxTrkSeg `xml:"trkseg"`
+}
+
+type gpxTrkSeg struct {
+	TrkPt []gpxTrkPt `xml:"trkpt"`
+}
+
+type gpxTrkPt struct {
+	Lat  float64 `xml:"lat,attr"`
+	Lon  float64 `xml:"lon,attr"`
+	Time string  `xml:"time"`
+}
+
+// WriteGPX 输出 GPX 1.1 轨迹，整段轨迹放在一个 trkseg 中
+func WriteGPX(w io.Writer, name string, track []GPS, datum coord.Datum) error {
+	seg := gpxTrkSeg{TrkPt: make([]gpxTrkPt, 0, len(track))}
+	for _, g := range track {
+		p, err := g.Point(datum)
+		if err != nil {
+			return err
+		}
+		seg.TrkPt = append(seg.TrkPt, gpxTrkPt{Lat: p.Lat, Lon: p.Lon, Time: formatTime(g)})
+	}
+	doc := gpx{
+		Xmlns:   "http://www.topografix.com/GPX/1/1",
+		Version: "1.1",
+		Creator: "go-web-study",
+		Trk:     gpxTrk{Name: name, Desc: "datum " + string(datum), TrkSeg: []gpxTrkSeg{seg}},
+	}
+	return writeXML(w, doc)
+}
+
+type kml struct {
+	XMLName  xml.Name    `xml:"kml"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	Document kmlDocument `xml:"Document"`
+}
+
+type kmlDocument struct {
+	Name      string         `xml:"name"`
+	Placemark []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name       string         `xml:"name,omitempty"`
+	TimeStamp  *kmlTimeStamp  `xml:"TimeStamp,omitempty"`
+	LineString *kmlLineString `xml:"LineString,omitempty"`
+	Point      *kmlPoint      `xml:"Point,omitempty"`
+}
+
+type kmlTimeStamp struct {
+	When string `xml:"when"`
+}
+
+type kmlLineString struct {
+	Tessellate  int    `xml:"tessellate"`
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+func kmlCoordinates(p coord.Point) string {
+	return strconv.FormatFloat(p.Lon, 'f', -1, 64) + "," + strconv.FormatFloat(p.Lat, 'f', -1, 64)
+}
+
+// WriteKML 输出一条轨迹线，以及每个定位点带时间戳的 Placemark，不足两个点时不输出轨迹线
+func WriteKML(w io.Writer, name string, track []GPS, datum coord.Datum) error {
+	doc := kmlDocument{Name: name}
+	coordinates := make([]string, 0, len(track))
+	points := make([]kmlPlacemark, 0, len(track))
+	for _, g := range track {
+		p, err := g.Point(datum)
+		if err != nil {
+			return err
+		}
+		c := kmlCoordinates(p)
+		coordinates = append(coordinates, c)
+		points = append(points, kmlPlacemark{
+			TimeStamp: &kmlTimeStamp{When: formatTime(g)},
+			Point:     &kmlPoint{Coordinates: c},
+		})
+	}
+	// LineString 至少需要两个点
+	if len(coordinates) >= 2 {
+		doc.Placemark = append(doc.Placemark, kmlPlacemark{
+			Name:       name,
+			LineString: &kmlLineString{Tessellate: 1, Coordinates: strings.Join(coordinates, " ")},
+		})
+	}
+	doc.Placemark = append(doc.Placemark, points...)
+	return writeXML(w, kml{Xmlns: "http://www.opengis.net/kml/2.2", Document: doc})
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// WriteGeoJSON 输出 FeatureCollection，第一个要素为轨迹 LineString，其余为各定位点 Point，
+// 不足两个点时只输出 Point
+func WriteGeoJSON(w io.Writer, name string, track []GPS, datum coord.Datum) error {
+	line := make([][2]float64, 0, len(track))
+	times := make([]string, 0, len(track))
+	features := []geoJSONFeature{}
+	for _, g := range track {
+		p, err := g.Point(datum)
+		if err != nil {
+			return err
+		}
+		line = append(line, [2]float64{p.Lon, p.Lat})
+		times = append(times, formatTime(g))
+		features = append(features, geoJSONFeature{
+			Type:     "Feature",
+			Geometry: geoJSONGeometry{Type: "Point", Coordinates: [2]float64{p.Lon, p.Lat}},
+			Properties: map[string]interface{}{
+				"terminalId": g.TerminalID,
+				"gpsTime":    g.GpsTime,
+				"time":       formatTime(g),
+			},
+		})
+	}
+	if len(line) >= 2 {
+		features = append([]geoJSONFeature{{
+			Type:     "Feature",
+			Geometry: geoJSONGeometry{Type: "LineString", Coordinates: line},
+			Properties: map[string]interface{}{
+				"name":  name,
+				"datum": datum,
+				"times": times,
+			},
+		}}, features...)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(geoJSONFeatureCollection{Type: "FeatureCollection", Features: features})
+}
@@ -0,0 +1,51 @@
+package gpslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go-web-study/coord"
+)
+
+func TestExportShortTrack(t *testing.T) {
+	one := []GPS{newTestGPS(t, "a", 123.4, 41.8, 1630999224000)}
+	two := append(one, newTestGPS(t, "a", 123.5, 41.8, 1630999225000))
+
+	for _, c := range []struct {
+		track []GPS
+		lines int
+	}{{nil, 0}, {one, 0}, {two, 1}} {
+		buf := bytes.Buffer{}
+		if err := WriteKML(&buf, "a", c.track, coord.WGS84); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Count(buf.String(), "<LineString>"); got != c.lines {
+			t.Errorf("KML with %d points has %d LineString, want %d", len(c.track), got, c.lines)
+		}
+
+		buf.Reset()
+		if err := WriteGeoJSON(&buf, "a", c.track, coord.WGS84); err != nil {
+			t.Fatal(err)
+		}
+		fc := geoJSONFeatureCollection{}
+		if err := json.Unmarshal(buf.Bytes(), &fc); err != nil {
+			t.Fatal(err)
+		}
+		lines, points := 0, 0
+		for _, f := range fc.Features {
+			switch f.Geometry.Type {
+			case "LineString":
+				lines++
+			case "Point":
+				points++
+			default:
+				t.Errorf("unexpected geometry %q", f.Geometry.Type)
+			}
+		}
+		if lines != c.lines || points != len(c.track) {
+			t.Errorf("GeoJSON with %d points has %d LineString and %d Point", len(c.track), lines, points)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package gpslog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	FormatAuto = "auto"
+	FormatJSON = "json"
+	FormatNMEA = "nmea"
+	FormatCSV  = "csv"
+)
+
+// DetectFormat 先按扩展名判断，无法判断时根据内容的第一个非空字符：{ 为 json，$ 为 nmea，< 为 gpx，其它按 csv
+func DetectFormat(fileName string, head []byte) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".gpx":
+		return FormatGPX
+	case ".nmea", ".nma":
+		return FormatNMEA
+	case ".csv":
+		return FormatCSV
+	case ".json", ".jsonl":
+		return FormatJSON
+	}
+	head = bytes.TrimLeft(head, " \t\r\n\ufeff")
+	if len(head) == 0 {
+		return FormatJSON
+	}
+	switch head[0] {
+	case '{':
+		return FormatJSON
+	case '$':
+		return FormatNMEA
+	case '<':
+		return FormatGPX
+	}
+	return FormatCSV
+}
+
+// NewReader 按格式创建 Reader，format 为空或 auto 时自动识别
+func NewReader(format, fileName string, r io.Reader) (Reader, string, error) {
+	if format == "" || format == FormatAuto {
+		br := bufio.NewReader(r)
+		head, _ := br.Peek(512)
+		format = DetectFormat(fileName, head)
+		r = br
+	}
+	switch format {
+	case FormatJSON:
+		return NewJSONReader(r), format, nil
+	case FormatNMEA:
+		return NewNMEAReader(r), format, nil
+	case FormatCSV:
+		return NewCSVReader(r), format, nil
+	case FormatGPX:
+		return NewGPXReader(r), format, nil
+	}
+	return nil, format, fmt.Errorf("unsupported input format %q", format)
+}
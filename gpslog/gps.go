@@ -0,0 +1,79 @@
+package gpslog
+
+import (
+	"time"
+
+	"go-web-study/coord"
+)
+
+// GPS 终端定位记录，Longitude/Latitude 为 WGS84 坐标，同时保存 GCJ02 和 BD09 坐标方便前端直接使用，
+// Datum 记录设备上报时使用的坐标系，GpsTime 为毫秒时间戳
+type GPS struct {
+	ID           uint64      `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	TerminalID   string      `json:"terminalId" gorm:"type:varchar(32);not null;default:'';column:terminal_id;uniqueIndex:uk_terminal_time,priority:1"`
+	Longitude    float64     `json:"longitude" gorm:"not null;column:longitude"`
+	Latitude     float64     `json:"latitude" gorm:"not null;column:latitude"`
+	LongitudeGCJ *float64    `json:"longitudeGCJ" gorm:"column:longitude_gcj"`
+	LatitudeGCJ  *float64    `json:"latitudeGCJ" gorm:"column:latitude_gcj"`
+	LongitudeBD  *float64    `json:"longitudeBD" gorm:"column:longitude_bd"`
+	LatitudeBD   *float64    `json:"latitudeBD" gorm:"column:latitude_bd"`
+	Datum        coord.Datum `json:"datum" gorm:"type:varchar(8);column:datum"`
+	GpsTime      int64       `json:"gpsTime" gorm:"type:bigint;not null;column:gps_time;uniqueIndex:uk_terminal_time,priority:2;index:idx_gps_time"`
+	CreatedAt    time.Time   `json:"createdAt" gorm:"column:created_at"`
+}
+
+func (g GPS) TableName() string {
+	return "tb_gps_log"
+}
+
+// NewGPS 由任意坐标系的点生成定位记录，并填充三种坐标
+func NewGPS(terminalID string, p coord.Point, gpsTime int64) (GPS, error) {
+	if p.Datum == "" {
+		p.Datum = coord.WGS84
+	}
+	wgs, err := p.To(coord.WGS84)
+	if err != nil {
+		return GPS{}, err
+	}
+	g := GPS{
+		TerminalID: terminalID,
+		Longitude:  wgs.Lon,
+		Latitude:   wgs.Lat,
+		Datum:      p.Datum,
+		GpsTime:    gpsTime,
+	}
+	g.FillCoordinates()
+	return g, nil
+}
+
+// FillCoordinates 根据 WGS84 坐标计算 GCJ02 和 BD09 坐标
+func (g *GPS) FillCoordinates() {
+	if g.Datum == "" {
+		g.Datum = coord.WGS84
+	}
+	lonGCJ, latGCJ := coord.WGS84ToGCJ02(g.Longitude, g.Latitude)
+	lonBD, latBD := coord.WGS84ToBD09(g.Longitude, g.Latitude)
+	g.LongitudeGCJ, g.LatitudeGCJ = &lonGCJ, &latGCJ
+	g.LongitudeBD, g.LatitudeBD = &lonBD, &latBD
+}
+
+// Point 返回指定坐标系下的坐标，缺少对应列时由 WGS84 换算
+func (g GPS) Point(datum coord.Datum) (coord.Point, error) {
+	wgs := coord.Point{Lon: g.Longitude, Lat: g.Latitude, Datum: coord.WGS84}
+	switch datum {
+	case coord.GCJ02:
+		if g.LongitudeGCJ != nil && g.LatitudeGCJ != nil {
+			return coord.Point{Lon: *g.LongitudeGCJ, Lat: *g.LatitudeGCJ, Datum: coord.GCJ02}, nil
+		}
+	case coord.BD09:
+		if g.LongitudeBD != nil && g.LatitudeBD != nil {
+			return coord.Point{Lon: *g.LongitudeBD, Lat: *g.LatitudeBD, Datum: coord.BD09}, nil
+		}
+	}
+	return wgs.To(datum)
+}
+
+// Time 定位时间
+func (g GPS) Time() time.Time {
+	return time.Unix(0, g.GpsTime*int64(time.Millisecond))
+}
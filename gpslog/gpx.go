@@ -0,0 +1,103 @@
+package gpslog
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go-web-study/coord"
+)
+
+// GPXReader 流式读取 GPX 中的 trkpt、rtept 和 wpt，时间使用 <time> 元素，坐标为 WGS84。
+// xml 语法错误后无法继续读取，返回普通错误而不是 *LineError
+type GPXReader struct {
+	decoder *xml.Decoder
+	lines   *lineCounter
+}
+
+func NewGPXReader(r io.Reader) *GPXReader {
+	lines := &lineCounter{r: r}
+	return &GPXReader{decoder: xml.NewDecoder(lines), lines: lines}
+}
+
+type gpxPoint struct {
+	Lat  *float64 `xml:"lat,attr"`
+	Lon  *float64 `xml:"lon,attr"`
+	Time string   `xml:"time"`
+}
+
+func (r *GPXReader) Read() (GPS, int, error) {
+	for {
+		token, err := r.decoder.Token()
+		line := r.lines.Line(r.decoder.InputOffset())
+		if err == io.EOF {
+			return GPS{}, line, err
+		}
+		if err != nil {
+			// xml.Decoder 的错误会一直返回，不能当作单行错误跳过
+			return GPS{}, line, fmt.Errorf("line %d: %v", line, err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "trkpt", "rtept", "wpt":
+		default:
+			continue
+		}
+		p := gpxPoint{}
+		if err := r.decoder.DecodeElement(&p, &start); err != nil {
+			syntaxErr := &xml.SyntaxError{}
+			if errors.As(err, &syntaxErr) {
+				return GPS{}, line, fmt.Errorf("line %d: %v", line, err)
+			}
+			return GPS{}, line, &LineError{Line: line, Err: err}
+		}
+		gps, err := p.gps()
+		if err != nil {
+			return gps, line, &LineError{Line: line, Err: err}
+		}
+		return gps, line, nil
+	}
+}
+
+func (p gpxPoint) gps() (GPS, error) {
+	if p.Lat == nil || p.Lon == nil {
+		return GPS{}, fmt.Errorf("point has no lat/lon")
+	}
+	t, err := time.Parse(time.RFC3339Nano, p.Time)
+	if err != nil {
+		return GPS{}, fmt.Errorf("invalid time %q", p.Time)
+	}
+	return NewGPS("", coord.Point{Lon: *p.Lon, Lat: *p.Lat, Datum: coord.WGS84}, t.UnixNano()/int64(time.Millisecond))
+}
+
+// lineCounter 记录已读取内容中的换行，根据 xml.Decoder 的偏移量换算行号
+type lineCounter struct {
+	r       io.Reader
+	pending []byte
+	offset  int64
+	line    int
+}
+
+func (c *lineCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.pending = append(c.pending, p[:n]...)
+	return n, err
+}
+
+// Line 返回 offset 所在的行号，offset 只能递增
+func (c *lineCounter) Line(offset int64) int {
+	n := int(offset - c.offset)
+	if n > len(c.pending) {
+		n = len(c.pending)
+	}
+	c.line += bytes.Count(c.pending[:n], []byte{'\n'})
+	c.pending = c.pending[n:]
+	c.offset += int64(n)
+	return c.line + 1
+}
@@ -0,0 +1,183 @@
+package gpslog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// minGpsTime 早于 2000 年的时间戳认为是设备未定位时上报的无效时间
+var minGpsTime = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// LineError 某一行无法解析或校验失败
+type LineError struct {
+	Line int
+	Text string
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// Reader 逐条读取定位记录，读完时返回 io.EOF。
+// 单条记录有问题时返回 *LineError，调用方可以继续读取下一条
+type Reader interface {
+	Read() (GPS, int, error)
+}
+
+// JSONReader 每行一个 json 对象，即 shenyang 记录的 gps.log 格式
+type JSONReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func NewJSONReader(r io.Reader) *JSONReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &JSONReader{scanner: scanner}
+}
+
+func (r *JSONReader) Read() (GPS, int, error) {
+	for r.scanner.Scan() {
+		r.line++
+		text := strings.TrimSpace(r.scanner.Text())
+		if text == "" {
+			continue
+		}
+		gps := GPS{}
+		if err := json.Unmarshal([]byte(text), &gps); err != nil {
+			return gps, r.line, &LineError{Line: r.line, Text: text, Err: err}
+		}
+		return gps, r.line, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return GPS{}, r.line, err
+	}
+	return GPS{}, r.line, io.EOF
+}
+
+// Validate 检查经纬度范围和定位时间，now 之后超过一天的时间认为无效
+func Validate(g GPS, now time.Time) error {
+	if g.Longitude < -180 || g.Longitude > 180 {
+		return fmt.Errorf("longitude %v out of range", g.Longitude)
+	}
+	if g.Latitude < -90 || g.Latitude > 90 {
+		return fmt.Errorf("latitude %v out of range", g.Latitude)
+	}
+	if g.Longitude == 0 && g.Latitude == 0 {
+		return errors.New("empty position")
+	}
+	t := g.Time()
+	if g.GpsTime <= 0 || t.Before(minGpsTime) {
+		return fmt.Errorf("invalid gpsTime %d", g.GpsTime)
+	}
+	if t.After(now.Add(24 * time.Hour)) {
+		return fmt.Errorf("gpsTime %s is in the future", t.Format("2006-01-02 15:04:05"))
+	}
+	return nil
+}
+
+// ImportResult 导入统计，Duplicates 为数据库中已存在而被忽略的条数
+type ImportResult struct {
+	Lines      int
+	Valid      int
+	Inserted   int64
+	Duplicates int64
+	Bad        []*LineError
+}
+
+// Importer 流式读取定位记录，校验后按 BatchSize 分批在事务中写入
+type Importer struct {
+	DB         *gorm.DB
+	BatchSize  int
+	DryRun     bool
+	TerminalID string
+	// OnBadLine 遇到错误行时回调，可以为空
+	OnBadLine func(e *LineError)
+}
+
+func (im *Importer) Import(ctx context.Context, r Reader) (ImportResult, error) {
+	result := ImportResult{}
+	batchSize := im.BatchSize
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	now := time.Now()
+	batch := make([]GPS, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 || im.DryRun {
+			batch = batch[:0]
+			return nil
+		}
+		var inserted int64
+		err := im.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var err error
+			inserted, err = NewStore(tx).SaveBatch(ctx, batch, len(batch))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		result.Inserted += inserted
+		result.Duplicates += int64(len(batch)) - inserted
+		batch = batch[:0]
+		return nil
+	}
+	bad := func(e *LineError) {
+		result.Bad = append(result.Bad, e)
+		if im.OnBadLine != nil {
+			im.OnBadLine(e)
+		}
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		gps, line, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		lineErr := &LineError{}
+		if errors.As(err, &lineErr) {
+			result.Lines++
+			bad(lineErr)
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		result.Lines++
+		if gps.TerminalID == "" {
+			gps.TerminalID = im.TerminalID
+		}
+		if err := Validate(gps, now); err != nil {
+			bad(&LineError{Line: line, Err: err})
+			continue
+		}
+		gps.ID = 0
+		if gps.LongitudeGCJ == nil || gps.LongitudeBD == nil {
+			gps.FillCoordinates()
+		}
+		result.Valid++
+		batch = append(batch, gps)
+		if len(batch) >= batchSize {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+	}
+	return result, flush()
+}
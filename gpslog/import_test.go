@@ -0,0 +1,79 @@
+package gpslog
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// gpsLog 生成 n 行 gps.log，第 bad 行是无效坐标
+func gpsLog(n, bad int) string {
+	b := strings.Builder{}
+	for i := 1; i <= n; i++ {
+		lon := 123.4 + float64(i)/1000
+		if i == bad {
+			lon = 200
+		}
+		fmt.Fprintf(&b, `{"terminalId":"a","longitude":%f,"latitude":41.8,"gpsTime":%d}`+"\n", lon, 1630999224000+int64(i)*1000)
+	}
+	return b.String()
+}
+
+func TestImporterReimport(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	content := gpsLog(10, 4) + "not json\n"
+
+	tests := []struct {
+		name       string
+		content    string
+		dryRun     bool
+		inserted   int64
+		duplicates int64
+		total      int64
+	}{
+		{name: "dry run", content: content, dryRun: true, total: 0},
+		{name: "first import", content: content, inserted: 9, total: 9},
+		// 重复导入同一文件不写入任何记录
+		{name: "reimport", content: content, duplicates: 9, total: 9},
+		// 文件追加了新的定位时只写入新增的部分
+		{name: "appended", content: gpsLog(12, 4), inserted: 2, duplicates: 9, total: 11},
+	}
+	for _, tt := range tests {
+		var badLines []int
+		im := &Importer{DB: store.DB(), BatchSize: 4, DryRun: tt.dryRun, OnBadLine: func(e *LineError) {
+			badLines = append(badLines, e.Line)
+		}}
+		res, err := im.Import(ctx, NewJSONReader(strings.NewReader(tt.content)))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if res.Inserted != tt.inserted || res.Duplicates != tt.duplicates {
+			t.Errorf("%s: inserted %d, duplicates %d, want %d, %d", tt.name, res.Inserted, res.Duplicates, tt.inserted, tt.duplicates)
+		}
+		if len(badLines) == 0 || badLines[0] != 4 || len(res.Bad) != len(badLines) {
+			t.Errorf("%s: bad lines = %v, %d reported, want line 4 first", tt.name, badLines, len(res.Bad))
+		}
+		var n int64
+		if err := store.DB().Model(&GPS{}).Count(&n).Error; err != nil || n != tt.total {
+			t.Errorf("%s: %d rows, %v, want %d", tt.name, n, err, tt.total)
+		}
+	}
+}
+
+func TestImporterTerminalID(t *testing.T) {
+	store := newTestStore(t)
+	im := &Importer{DB: store.DB(), TerminalID: "b"}
+	content := `{"longitude":123.4,"latitude":41.8,"gpsTime":1630999224000}` + "\n" +
+		`{"terminalId":"a","longitude":123.4,"latitude":41.8,"gpsTime":1630999224000}` + "\n"
+	res, err := im.Import(context.Background(), NewJSONReader(strings.NewReader(content)))
+	if err != nil || res.Inserted != 2 {
+		t.Fatalf("Import = %+v, %v, want 2 inserted", res, err)
+	}
+	// 没有终端的记录使用 TerminalID，并补充 GCJ02/BD09 坐标
+	latest, err := store.Latest(context.Background(), "b")
+	if err != nil || latest == nil || latest.LongitudeGCJ == nil || latest.LongitudeBD == nil {
+		t.Errorf("Latest(b) = %+v, %v", latest, err)
+	}
+}
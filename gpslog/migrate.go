@@ -0,0 +1,141 @@
+package gpslog
+
+import (
+	"fmt"
+	"time"
+
+	"go-web-study/coord"
+	"go-web-study/storage"
+
+	"gorm.io/gorm"
+)
+
+// gpsV2 第 2 版发布时的表结构，迁移使用固定的结构，模型以后的改动不会影响已发布的版本
+type gpsV2 struct {
+	ID           uint64      `gorm:"primaryKey;autoIncrement;column:id"`
+	TerminalID   string      `gorm:"type:varchar(32);not null;default:'';column:terminal_id;index:idx_terminal_time,priority:1"`
+	Longitude    float64     `gorm:"type:double;not null;column:longitude"`
+	Latitude     float64     `gorm:"type:double;not null;column:latitude"`
+	LongitudeGCJ *float64    `gorm:"type:double;column:longitude_gcj"`
+	LatitudeGCJ  *float64    `gorm:"type:double;column:latitude_gcj"`
+	LongitudeBD  *float64    `gorm:"type:double;column:longitude_bd"`
+	LatitudeBD   *float64    `gorm:"type:double;column:latitude_bd"`
+	Datum        coord.Datum `gorm:"type:varchar(8);column:datum"`
+	GpsTime      int64       `gorm:"type:bigint;not null;column:gps_time;index:idx_terminal_time,priority:2;index:idx_gps_time"`
+	CreatedAt    time.Time   `gorm:"column:created_at"`
+}
+
+func (gpsV2) TableName() string {
+	return "tb_gps_log"
+}
+
+// gpsV4 第 4 版的列定义，坐标列不再写死 double，由驱动选择各自的双精度类型。
+// 只包含列，索引由第 2、3 版维护
+type gpsV4 struct {
+	ID           uint64      `gorm:"primaryKey;autoIncrement;column:id"`
+	TerminalID   string      `gorm:"type:varchar(32);not null;default:'';column:terminal_id"`
+	Longitude    float64     `gorm:"not null;column:longitude"`
+	Latitude     float64     `gorm:"not null;column:latitude"`
+	LongitudeGCJ *float64    `gorm:"column:longitude_gcj"`
+	LatitudeGCJ  *float64    `gorm:"column:latitude_gcj"`
+	LongitudeBD  *float64    `gorm:"column:longitude_bd"`
+	LatitudeBD   *float64    `gorm:"column:latitude_bd"`
+	Datum        coord.Datum `gorm:"type:varchar(8);column:datum"`
+	GpsTime      int64       `gorm:"type:bigint;not null;column:gps_time"`
+	CreatedAt    time.Time   `gorm:"column:created_at"`
+}
+
+func (gpsV4) TableName() string {
+	return "tb_gps_log"
+}
+
+// migrations 只能追加，不能修改已发布的版本
+var migrations = []storage.Migration{
+	{Version: 1, Name: "add primary key to legacy tb_gps_log", Up: func(tx *gorm.DB) error {
+		// 旧表由 varchar 坐标列组成且没有主键，先补上自增 id
+		return storage.AddLegacyPrimaryKey(tx, &GPS{}, "tb_gps_log")
+	}},
+	{Version: 2, Name: "tb_gps_log numeric columns and terminal time index", Up: func(tx *gorm.DB) error {
+		if tx.Dialector.Name() != "postgres" {
+			return tx.AutoMigrate(&gpsV2{})
+		}
+		// 第 2 版发布时还不支持 postgres，postgres 没有 double 类型，直接使用第 4 版的列
+		if err := tx.AutoMigrate(&gpsV4{}); err != nil {
+			return err
+		}
+		return tx.Migrator().CreateIndex(&gpsV2{}, "idx_terminal_time")
+	}},
+	{Version: 3, Name: "unique terminal and gps time", Up: ensureUniqueTerminalTime},
+	{Version: 4, Name: "portable coordinate column types", Up: func(tx *gorm.DB) error {
+		// sqlite 的 double 和 real 都是浮点亲和性，修改列类型需要重建表，没有必要
+		if tx.Dialector.Name() == "sqlite" {
+			return nil
+		}
+		return tx.AutoMigrate(&gpsV4{})
+	}},
+}
+
+// Migrate 执行 tb_gps_log 尚未执行的迁移，记录在 schema_migrations 表中。
+// 有重复数据时返回错误，导入依赖唯一索引去重，不能在没有唯一索引时继续运行
+func Migrate(db *gorm.DB) error {
+	if err := storage.Migrate(db, "schema_migrations", migrations); err != nil {
+		return err
+	}
+	// 早期版本有重复时跳过了唯一索引但记录了第 3 版，这里补建
+	return ensureUniqueTerminalTime(db)
+}
+
+// MigrateLegacy 只执行唯一索引之前的迁移，补齐 id 和 terminal_id 列，db_migrate 在清理重复数据之前调用
+func MigrateLegacy(db *gorm.DB) error {
+	return storage.MigrateTo(db, "schema_migrations", migrations, 2)
+}
+
+// ensureUniqueTerminalTime 创建终端+时间的唯一索引，重复导入同一份日志时不会产生重复数据。
+// 迁移不删除任何数据，有重复时返回错误，由运维通过 db_migrate 查看并清理后重新执行
+func ensureUniqueTerminalTime(tx *gorm.DB) error {
+	m := tx.Migrator()
+	if !m.HasIndex(&GPS{}, "uk_terminal_time") {
+		groups, rows, err := Duplicates(tx)
+		if err != nil {
+			return err
+		}
+		if groups > 0 {
+			return fmt.Errorf("tb_gps_log has %d duplicated terminal_id and gps_time groups (%d extra rows), "+
+				"check with db_migrate -dry-run and clean up with -gps-legacy-terminal/-gps-dedupe", groups, rows)
+		}
+		if err := m.CreateIndex(&GPS{}, "uk_terminal_time"); err != nil {
+			return err
+		}
+	}
+	if m.HasIndex(&GPS{}, "idx_terminal_time") {
+		return m.DropIndex(&GPS{}, "idx_terminal_time")
+	}
+	return nil
+}
+
+// Duplicates 返回同一终端同一时间有多条定位的分组数，以及比唯一索引多出的记录数
+func Duplicates(db *gorm.DB) (groups int64, rows int64, err error) {
+	// groups 和 rows 在 mysql 8 中是保留字
+	var res struct {
+		DupGroups int64
+		DupRows   int64
+	}
+	err = db.Raw("SELECT COUNT(*) AS dup_groups, COALESCE(SUM(n - 1), 0) AS dup_rows FROM " +
+		"(SELECT COUNT(*) AS n FROM tb_gps_log GROUP BY terminal_id, gps_time HAVING COUNT(*) > 1) t").Scan(&res).Error
+	return res.DupGroups, res.DupRows, err
+}
+
+// RemoveDuplicates 删除终端、时间和坐标都相同的重复定位，只保留 id 最小的一条，返回删除的条数。
+// 同一时间坐标不同的记录无法判断哪条正确，需要人工处理
+func RemoveDuplicates(db *gorm.DB) (int64, error) {
+	// mysql 不允许在子查询中直接引用被删除的表，需要多包一层派生表
+	res := db.Exec("DELETE FROM tb_gps_log WHERE id NOT IN " +
+		"(SELECT id FROM (SELECT MIN(id) AS id FROM tb_gps_log GROUP BY terminal_id, gps_time, longitude, latitude) t)")
+	return res.RowsAffected, res.Error
+}
+
+// SetLegacyTerminal 旧表没有终端列，迁移后 terminal_id 为空，由运维指定这些记录所属的终端
+func SetLegacyTerminal(db *gorm.DB, terminalID string) (int64, error) {
+	res := db.Model(&GPS{}).Where("terminal_id = ''").Update("terminal_id", terminalID)
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,123 @@
+package gpslog
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-web-study/storage"
+)
+
+func TestMigrateKeepsDuplicates(t *testing.T) {
+	db, err := storage.Open(storage.Config{DSN: "sqlite://" + filepath.Join(t.TempDir(), "gps.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 升级前的表只有普通索引，旧记录没有终端
+	if err := db.AutoMigrate(&gpsV2{}); err != nil {
+		t.Fatal(err)
+	}
+	rows := []gpsV2{
+		{Longitude: 123.4, Latitude: 41.8, GpsTime: 1},
+		{Longitude: 123.5, Latitude: 41.9, GpsTime: 1},
+		{TerminalID: "a", Longitude: 123.4, Latitude: 41.8, GpsTime: 2},
+		{TerminalID: "a", Longitude: 123.4, Latitude: 41.8, GpsTime: 2},
+		{TerminalID: "a", Longitude: 123.4, Latitude: 41.8, GpsTime: 3},
+	}
+	if err := db.Create(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	count := func() int64 {
+		var n int64
+		if err := db.Model(&GPS{}).Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if err := MigrateLegacy(db); err != nil {
+		t.Fatal(err)
+	}
+	// 有重复时迁移失败，提示运维清理
+	if err := Migrate(db); err == nil || !strings.Contains(err.Error(), "2 duplicated") || !strings.Contains(err.Error(), "-gps-dedupe") {
+		t.Fatalf("Migrate error = %v, want duplicate count and -gps-dedupe", err)
+	}
+	if n := count(); n != 5 {
+		t.Fatalf("Migrate deleted rows, %d left, want 5", n)
+	}
+	if db.Migrator().HasIndex(&GPS{}, "uk_terminal_time") {
+		t.Error("unique index created with duplicate rows")
+	}
+	if groups, dup, err := Duplicates(db); err != nil || groups != 2 || dup != 2 {
+		t.Errorf("Duplicates = %d, %d, %v, want 2, 2", groups, dup, err)
+	}
+
+	// 只删除完全相同的记录
+	if n, err := RemoveDuplicates(db); err != nil || n != 1 {
+		t.Errorf("RemoveDuplicates = %d, %v, want 1", n, err)
+	}
+	if n, err := SetLegacyTerminal(db, "b"); err != nil || n != 2 {
+		t.Errorf("SetLegacyTerminal = %d, %v, want 2", n, err)
+	}
+	if err := Migrate(db); err == nil || !strings.Contains(err.Error(), "1 duplicated") {
+		t.Errorf("Migrate error = %v, want 1 duplicated group", err)
+	}
+	if db.Migrator().HasIndex(&GPS{}, "uk_terminal_time") {
+		t.Error("unique index created while rows with different coordinates conflict")
+	}
+
+	// 人工处理冲突后补建唯一索引
+	if err := db.Where("terminal_id = ? AND longitude = ?", "b", 123.5).Delete(&GPS{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	if !db.Migrator().HasIndex(&GPS{}, "uk_terminal_time") || db.Migrator().HasIndex(&GPS{}, "idx_terminal_time") {
+		t.Error("unique index should replace idx_terminal_time after cleanup")
+	}
+	if n := count(); n != 3 {
+		t.Errorf("%d rows left, want 3", n)
+	}
+}
+
+func TestMigrateMemory(t *testing.T) {
+	db, err := storage.Open(storage.Config{DSN: "sqlite://:memory:", MaxOpenConns: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	var versions []int
+	if err := db.Table("schema_migrations").Order("version").Pluck("version", &versions).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != len(migrations) || versions[len(versions)-1] != 4 {
+		t.Errorf("applied versions = %v, want 1-4", versions)
+	}
+	if !db.Migrator().HasIndex(&GPS{}, "uk_terminal_time") {
+		t.Error("uk_terminal_time not created on an empty table")
+	}
+}
+
+func TestMigrateMissingUniqueIndex(t *testing.T) {
+	db, err := storage.Open(storage.Config{DSN: "sqlite://" + filepath.Join(t.TempDir(), "gps.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	// 早期版本有重复时跳过了唯一索引，但第 3 版已经记录为执行过
+	if err := db.Migrator().DropIndex(&GPS{}, "uk_terminal_time"); err != nil {
+		t.Fatal(err)
+	}
+	rows := []GPS{{TerminalID: "a", GpsTime: 1}, {TerminalID: "a", GpsTime: 1}}
+	if err := db.Create(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(db); err == nil || !strings.Contains(err.Error(), "1 duplicated") {
+		t.Errorf("Migrate error = %v, want 1 duplicated group", err)
+	}
+}
@@ -0,0 +1,181 @@
+package gpslog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-web-study/coord"
+)
+
+// NMEAReader 解析 $GPRMC/$GPGGA 语句，也支持 $GN/$BD 等其它 talker。
+// GGA 不带日期，使用最近一条 RMC 的日期；未定位的语句和其它类型的语句直接跳过。
+// 同一次定位通常同时输出 RMC 和 GGA，时间相同的连续语句只返回先出现的一条
+type NMEAReader struct {
+	scanner *bufio.Scanner
+	line    int
+	date    time.Time
+	// pending 已解析但还没有返回的定位，等读到下一个时间不同的定位再返回
+	pending     *GPS
+	pendingLine int
+}
+
+func NewNMEAReader(r io.Reader) *NMEAReader {
+	return &NMEAReader{scanner: bufio.NewScanner(r)}
+}
+
+var errNoFix = errors.New("no fix")
+
+func (r *NMEAReader) Read() (GPS, int, error) {
+	for {
+		gps, line, err := r.next()
+		if err == io.EOF && r.pending != nil {
+			gps, line = *r.pending, r.pendingLine
+			r.pending = nil
+			return gps, line, nil
+		}
+		if err != nil {
+			return gps, line, err
+		}
+		if r.pending != nil && r.pending.GpsTime == gps.GpsTime {
+			continue
+		}
+		prev, prevLine := r.pending, r.pendingLine
+		r.pending, r.pendingLine = &gps, line
+		if prev != nil {
+			return *prev, prevLine, nil
+		}
+	}
+}
+
+// next 返回下一条定位语句
+func (r *NMEAReader) next() (GPS, int, error) {
+	for r.scanner.Scan() {
+		r.line++
+		text := strings.TrimSpace(r.scanner.Text())
+		if !strings.HasPrefix(text, "$") {
+			continue
+		}
+		gps, err := r.parse(text)
+		if err == errNoFix || (err == nil && gps.GpsTime == 0) {
+			continue
+		}
+		if err != nil {
+			return gps, r.line, &LineError{Line: r.line, Text: text, Err: err}
+		}
+		return gps, r.line, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return GPS{}, r.line, err
+	}
+	return GPS{}, r.line, io.EOF
+}
+
+func (r *NMEAReader) parse(sentence string) (GPS, error) {
+	body, err := nmeaChecksum(sentence)
+	if err != nil {
+		return GPS{}, err
+	}
+	fields := strings.Split(body, ",")
+	if len(fields[0]) < 3 {
+		return GPS{}, fmt.Errorf("invalid sentence %q", fields[0])
+	}
+	switch fields[0][len(fields[0])-3:] {
+	case "RMC":
+		// $GPRMC,hhmmss.ss,A,ddmm.mm,N,dddmm.mm,E,speed,course,ddmmyy,...
+		if len(fields) < 10 {
+			return GPS{}, errors.New("RMC: too few fields")
+		}
+		if fields[2] != "A" {
+			return GPS{}, errNoFix
+		}
+		date, err := time.Parse("020106", fields[9])
+		if err != nil {
+			return GPS{}, fmt.Errorf("RMC: invalid date %q", fields[9])
+		}
+		r.date = date
+		return nmeaPosition(date, fields[1], fields[3:7])
+	case "GGA":
+		// $GPGGA,hhmmss.ss,ddmm.mm,N,dddmm.mm,E,quality,...
+		if len(fields) < 7 {
+			return GPS{}, errors.New("GGA: too few fields")
+		}
+		if fields[6] == "" || fields[6] == "0" {
+			return GPS{}, errNoFix
+		}
+		if r.date.IsZero() {
+			return GPS{}, errors.New("GGA before any RMC, date unknown")
+		}
+		return nmeaPosition(r.date, fields[1], fields[2:6])
+	}
+	return GPS{}, nil
+}
+
+// nmeaChecksum 校验 *hh 校验和（如果有），返回 $ 与 * 之间的内容
+func nmeaChecksum(sentence string) (string, error) {
+	body := sentence[1:]
+	i := strings.LastIndex(body, "*")
+	if i < 0 {
+		return body, nil
+	}
+	want, err := strconv.ParseUint(body[i+1:], 16, 8)
+	if err != nil {
+		return "", fmt.Errorf("invalid checksum %q", body[i+1:])
+	}
+	body = body[:i]
+	sum := byte(0)
+	for j := 0; j < len(body); j++ {
+		sum ^= body[j]
+	}
+	if uint64(sum) != want {
+		return "", fmt.Errorf("checksum mismatch, got %02X want %02X", sum, want)
+	}
+	return body, nil
+}
+
+// nmeaPosition pos 依次为纬度、N/S、经度、E/W，时间为 UTC
+func nmeaPosition(date time.Time, hms string, pos []string) (GPS, error) {
+	if len(hms) < 6 {
+		return GPS{}, fmt.Errorf("invalid time %q", hms)
+	}
+	t, err := time.Parse("150405", hms[:6])
+	if err != nil {
+		return GPS{}, fmt.Errorf("invalid time %q", hms)
+	}
+	nanos := 0.0
+	if len(hms) > 6 {
+		nanos, _ = strconv.ParseFloat("0"+hms[6:], 64)
+	}
+	t = time.Date(date.Year(), date.Month(), date.Day(), t.Hour(), t.Minute(), t.Second(),
+		int(nanos*float64(time.Second)), time.UTC)
+	lat, err := nmeaDegrees(pos[0], pos[1], "N", "S")
+	if err != nil {
+		return GPS{}, err
+	}
+	lon, err := nmeaDegrees(pos[2], pos[3], "E", "W")
+	if err != nil {
+		return GPS{}, err
+	}
+	return NewGPS("", coord.Point{Lon: lon, Lat: lat, Datum: coord.WGS84}, t.UnixNano()/int64(time.Millisecond))
+}
+
+// nmeaDegrees 把 ddmm.mmmm / dddmm.mmmm 转换为十进制度
+func nmeaDegrees(value, hemisphere, positive, negative string) (float64, error) {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid coordinate %q", value)
+	}
+	degrees := float64(int(v / 100))
+	degrees += (v - degrees*100) / 60
+	switch hemisphere {
+	case positive:
+		return degrees, nil
+	case negative:
+		return -degrees, nil
+	}
+	return 0, fmt.Errorf("invalid hemisphere %q", hemisphere)
+}
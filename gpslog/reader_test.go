@@ -0,0 +1,87 @@
+package gpslog
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+  <trk><trkseg>
+    <trkpt lat="41.8" lon="123.4"><time>2021-09-07T08:00:00Z</time></trkpt>
+    <trkpt lat="41.9" lon="123.5"><time>2021-09-07T08:00:01Z</time></trkpt>
+    <trkpt lat="41.9" lon="123.5"><time>bad</time></trkpt>
+`
+
+func TestGPXTruncated(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	im := &Importer{DryRun: true, TerminalID: "a"}
+	result, err := im.Import(ctx, NewGPXReader(strings.NewReader(testGPX+`    <trkpt lat="41.9" lo`)))
+	if err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Import truncated gpx error = %v, want a syntax error", err)
+	}
+	if result.Valid != 2 || len(result.Bad) != 1 {
+		t.Errorf("Import = %d valid, %d bad, want 2 and 1", result.Valid, len(result.Bad))
+	}
+
+	// 文件完整时正常结束
+	result, err = im.Import(ctx, NewGPXReader(strings.NewReader(testGPX+"  </trkseg></trk>\n</gpx>\n")))
+	if err != nil || result.Valid != 2 || len(result.Bad) != 1 || result.Bad[0].Line != 6 {
+		t.Errorf("Import = %+v, %v", result, err)
+	}
+}
+
+func TestNMEAMergesRMCAndGGA(t *testing.T) {
+	log := strings.Join([]string{
+		"$GPRMC,080000.00,A,4148.0000,N,12324.0000,E,0.0,0.0,070921,,,A",
+		"$GPGGA,080000.00,4148.0000,N,12324.0000,E,1,08,1.0,50.0,M,0.0,M,,",
+		"$GPGSA,A,3,01,02,03,,,,,,,,,,1.5,1.0,1.1",
+		"$GNGGA,080001.00,4148.0060,N,12324.0060,E,1,08,1.0,50.0,M,0.0,M,,",
+		"$GNRMC,080001.00,A,4148.0060,N,12324.0060,E,0.0,0.0,070921,,,A",
+		"$GPGGA,080002.00,4148.0120,N,12324.0120,E,0,00,,,M,,M,,",
+		"$GPRMC,080003.00,A,4148.0180,N,12324.0180,E,0.0,0.0,070921,,,A*00",
+		"$GPGGA,080004.00,4148.0240,N,12324.0240,E,1,08,1.0,50.0,M,0.0,M,,",
+	}, "\n")
+	r := NewNMEAReader(strings.NewReader(log))
+	var times []int64
+	var lines []int
+	bad := 0
+	for {
+		gps, line, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		lineErr := &LineError{}
+		if errors.As(err, &lineErr) {
+			bad++
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		times = append(times, gps.GpsTime)
+		lines = append(lines, line)
+	}
+	base := time.Date(2021, 9, 7, 8, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond)
+	want := []int64{base, base + 1000, base + 4000}
+	if len(times) != len(want) {
+		t.Fatalf("times = %v, want %v", times, want)
+	}
+	for i := range want {
+		if times[i] != want[i] {
+			t.Errorf("times[%d] = %d, want %d", i, times[i], want[i])
+		}
+	}
+	if lines[0] != 1 || lines[1] != 4 || lines[2] != 8 {
+		t.Errorf("lines = %v, want [1 4 8]", lines)
+	}
+	// 校验和错误的 RMC
+	if bad != 1 {
+		t.Errorf("bad = %d, want 1", bad)
+	}
+}
@@ -0,0 +1,69 @@
+package gpslog
+
+import (
+	"context"
+	"time"
+
+	"go-web-study/storage"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Store 定位记录的读写
+type Store struct {
+	db *gorm.DB
+}
+
+func NewStore(db *gorm.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) DB() *gorm.DB {
+	return s.db
+}
+
+// Save 保存定位，同一终端同一时间的定位已存在时忽略
+func (s *Store) Save(ctx context.Context, gps *GPS) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(gps).Error
+}
+
+// SaveBatch 批量保存定位，忽略已存在的记录，返回实际写入的条数
+func (s *Store) SaveBatch(ctx context.Context, gpsArray []GPS, batchSize int) (int64, error) {
+	if len(gpsArray) == 0 {
+		return 0, nil
+	}
+	res := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(gpsArray, storage.BatchSize(s.db, &GPS{}, batchSize))
+	return res.RowsAffected, res.Error
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// Track 返回终端在 [from, to) 内按定位时间排序的轨迹
+func (s *Store) Track(ctx context.Context, terminalID string, from, to time.Time) ([]GPS, error) {
+	var track []GPS
+	err := s.db.WithContext(ctx).
+		Where("terminal_id = ? AND gps_time >= ? AND gps_time < ?", terminalID, toMillis(from), toMillis(to)).
+		Order("gps_time, id").
+		Find(&track).Error
+	return track, err
+}
+
+// Latest 返回终端最新的一条定位，没有记录时返回 nil
+func (s *Store) Latest(ctx context.Context, terminalID string) (*GPS, error) {
+	var gps []GPS
+	err := s.db.WithContext(ctx).Where("terminal_id = ?", terminalID).Order("gps_time DESC, id DESC").Limit(1).Find(&gps).Error
+	if err != nil || len(gps) == 0 {
+		return nil, err
+	}
+	return &gps[0], nil
+}
+
+// Terminals 返回有定位记录的终端
+func (s *Store) Terminals(ctx context.Context) ([]string, error) {
+	var terminals []string
+	err := s.db.WithContext(ctx).Model(&GPS{}).Distinct("terminal_id").Order("terminal_id").Pluck("terminal_id", &terminals).Error
+	return terminals, err
+}
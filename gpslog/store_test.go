@@ -0,0 +1,79 @@
+package gpslog
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-web-study/coord"
+	"go-web-study/storage"
+)
+
+func newTestStore(t *testing.T) *Store {
+	db, err := storage.Open(storage.Config{DSN: "sqlite://" + filepath.Join(t.TempDir(), "gps.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return NewStore(db)
+}
+
+func newTestGPS(t *testing.T, terminalID string, lon, lat float64, gpsTime int64) GPS {
+	g, err := NewGPS(terminalID, coord.Point{Lon: lon, Lat: lat, Datum: coord.WGS84}, gpsTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestStoreTrack(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	base := time.Date(2021, 9, 7, 8, 0, 0, 0, time.UTC)
+	ms := toMillis(base)
+	track := []GPS{
+		newTestGPS(t, "a", 123.41, 41.80, ms+2000),
+		newTestGPS(t, "a", 123.40, 41.80, ms),
+		newTestGPS(t, "a", 123.42, 41.80, ms+60000),
+		newTestGPS(t, "b", 123.50, 41.90, ms+1000),
+	}
+	n, err := store.SaveBatch(ctx, track, 2)
+	if err != nil || n != 4 {
+		t.Fatalf("SaveBatch = %d, %v, want 4", n, err)
+	}
+	// 重复的终端和时间被忽略
+	dup := newTestGPS(t, "a", 0, 0, ms)
+	if err := store.Save(ctx, &dup); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Track(ctx, "a", base, base.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].GpsTime != ms || got[1].GpsTime != ms+2000 {
+		t.Fatalf("Track = %+v, want 2 points ordered by time, end exclusive", got)
+	}
+	if got[0].Longitude != 123.40 {
+		t.Errorf("duplicate point overwrote the first one: %+v", got[0])
+	}
+	p, err := got[0].Point(coord.GCJ02)
+	if err != nil || p.Datum != coord.GCJ02 || p.Lon == got[0].Longitude {
+		t.Errorf("Point(GCJ02) = %+v, %v", p, err)
+	}
+
+	latest, err := store.Latest(ctx, "a")
+	if err != nil || latest == nil || latest.GpsTime != ms+60000 {
+		t.Errorf("Latest = %+v, %v", latest, err)
+	}
+	if latest, err := store.Latest(ctx, "none"); err != nil || latest != nil {
+		t.Errorf("Latest(none) = %+v, %v, want nil", latest, err)
+	}
+	terminals, err := store.Terminals(ctx)
+	if err != nil || len(terminals) != 2 || terminals[0] != "a" || terminals[1] != "b" {
+		t.Errorf("Terminals = %v, %v", terminals, err)
+	}
+}
@@ -1,73 +1,72 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
-	"gorm.io/driver/mysql"
-	"gorm.io/gorm"
+	"go-web-study/coord"
+	"go-web-study/gpslog"
+	"go-web-study/storage"
 	"log"
 	"os"
+	"os/signal"
+	"time"
 )
 
-type GPS struct {
-	Longitude float64 `json:"longitude" gorm:"type:varchar(20) column:longitude"`
-	Latitude  float64 `json:"latitude" gorm:"type:varchar(20) column:latitude"`
-	GpsTime   int64   `json:"gpsTime" gorm:"type:bigint column:gps_time"`
-}
+var dbConfig = storage.RegisterFlags(flag.CommandLine)
 
-func (g GPS) TableName() string {
-	return "tb_gps_log"
-}
+var (
+	fileName   = flag.String("file", "handler_gps_log/gps.log", "gps log file")
+	format     = flag.String("format", gpslog.FormatAuto, "input format: auto, json, nmea, csv or gpx")
+	datum      = flag.String("datum", "wgs84", "coordinate datum of csv files without a datum column")
+	terminalID = flag.String("terminal", "", "terminal id for records without terminalId")
+	batchSize  = flag.Int("batch", 500, "records inserted per transaction")
+	dryRun     = flag.Bool("dry-run", false, "only parse and validate, do not write the database")
+)
 
-func ReadFile(fileName string) []string {
-	var (
-		res  []string
-		file *os.File
-		err  error
-	)
+func main() {
+	flag.Parse()
+	start := time.Now()
+	file, err := os.Open(*fileName)
+	if err != nil {
+		log.Fatalf("读取文件失败 %v", err)
+	}
 	defer file.Close()
-	file, err = os.Open(fileName)
+	reader, f, err := gpslog.NewReader(*format, *fileName, file)
 	if err != nil {
-		log.Printf("读取文件失败")
+		log.Fatal(err)
 	}
-	scanner := bufio.NewScanner(file)
-	scanner.Split(bufio.ScanLines)
-	for scanner.Scan() {
-		res = append(res, scanner.Text())
+	if csvReader, ok := reader.(*gpslog.CSVReader); ok {
+		if csvReader.Datum, err = coord.ParseDatum(*datum); err != nil {
+			log.Fatal(err)
+		}
 	}
-	return res
-}
+	log.Printf("读取%s，格式%s", *fileName, f)
 
-func InitDB() *gorm.DB {
-	username := "root"        //账号
-	password := "5zgmvzXY3fY" //密码
-	host := "10.122.100.146"  //数据库地址，可以是Ip或者域名
-	port := 3306              //数据库端口
-	Dbname := "test"          //数据库名
-	timeout := "100s"
+	importer := &gpslog.Importer{
+		BatchSize:  *batchSize,
+		DryRun:     *dryRun,
+		TerminalID: *terminalID,
+		OnBadLine: func(e *gpslog.LineError) {
+			fmt.Fprintf(os.Stderr, "%s:%d: %v\n", *fileName, e.Line, e.Err)
+		},
+	}
+	if !*dryRun {
+		importer.DB = storage.MustOpen(*dbConfig)
+		if err := gpslog.Migrate(importer.DB); err != nil {
+			log.Fatalf("数据库迁移失败 %v", err)
+		}
+	}
 
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8&parseTime=True&loc=Local&timeout=%s", username, password, host, port, Dbname, timeout)
-	//连接MYSQL, 获得DB类型实例，用于后面的数据库读写操作。
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	res, err := importer.Import(ctx, reader)
+	log.Printf("共%d行，有效%d行，错误%d行，写入%d条，重复%d条，耗时[%s]",
+		res.Lines, res.Valid, len(res.Bad), res.Inserted, res.Duplicates, time.Since(start))
 	if err != nil {
-		panic("连接数据库失败, error=" + err.Error())
+		log.Fatalf("导入失败 %v", err)
 	}
-	return db
-}
-
-func main() {
-	var (
-		gpsArray []GPS
-		gps      GPS
-	)
-	db := InitDB()
-	for _, str := range ReadFile("handler_gps_log/gps.log") {
-		json.Unmarshal([]byte(str), &gps)
-
-		gpsArray = append(gpsArray, gps)
+	if len(res.Bad) > 0 {
+		os.Exit(1)
 	}
-
-	batches := db.CreateInBatches(gpsArray, len(gpsArray))
-	fmt.Println(batches)
 }
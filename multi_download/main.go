@@ -2,19 +2,32 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
-	"io"
 	"math/rand"
-	"net/http"
 	"os"
 	"time"
+
+	"go-web-study/downloader"
 )
 
 var (
 	clustername = flag.String("clustername", "c1", "download clustername")
+	source      = flag.String("source", "http://%s/file/%s", "source template filled with node and fileID, supports go-getter style urls like file:///mirror/%[2]s")
 )
 
+var (
+	clientConfig  = downloader.ClientConfig{Timeout: 900 * time.Second}
+	throttleFlags downloader.ThrottleFlags
+	fetcher       *downloader.Fetcher
+)
+
+func init() {
+	downloader.RegisterClientFlags(flag.CommandLine, &clientConfig)
+	downloader.RegisterThrottleFlags(flag.CommandLine, &throttleFlags)
+}
+
 func ReadLines(fpath string) []string {
 	fd, err := os.Open(fpath)
 	if err != nil {
@@ -38,29 +51,30 @@ func Download(clustername string, node string, fileID string) string {
 	nt := time.Now().Format("2006-01-02 15:04:05")
 	fmt.Printf("[%s]To download %s\n", nt, fileID)
 
-	url := fmt.Sprintf("http://%s/file/%s", node, fileID)
+	src := fmt.Sprintf(*source, node, fileID)
 	fpath := fmt.Sprintf("/yourpath/download/%s_%s", clustername, fileID)
-	newFile, err := os.Create(fpath)
-	if err != nil {
+	if err := fetcher.FetchFile(context.Background(), src, fpath); err != nil {
 		fmt.Println(err.Error())
 		return "process failed for " + fileID
 	}
-	defer newFile.Close()
-
-	client := http.Client{Timeout: 900 * time.Second}
-	resp, err := client.Get(url)
-	defer resp.Body.Close()
-
-	_, err = io.Copy(newFile, resp.Body)
-	if err != nil {
-		fmt.Println(err.Error())
-	}
 	return fileID
 }
 
 func main() {
 	flag.Parse()
 
+	throttleConfig, err := throttleFlags.Config()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	client, err := downloader.NewClient(clientConfig, downloader.NewThrottle(throttleConfig))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	fetcher = downloader.NewFetcher(client)
+
 	// 从文件中读取节点ip列表
 	nodelist := ReadLines(fmt.Sprintf("%s_node.txt", *clustername))
 	if len(nodelist) == 0 {
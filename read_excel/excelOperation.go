@@ -1,34 +1,79 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"os"
+	"strings"
+
+	"go-web-study/sheet"
 
 	"github.com/xuri/excelize/v2"
 )
 
+// DeviceRow 审核表中的设备信息
+type DeviceRow struct {
+	Name      string  `xlsx:"设备名称,required"`
+	GbID      string  `xlsx:"国标编码,required"`
+	Longitude float64 `xlsx:"经度"`
+	Latitude  float64 `xlsx:"纬度"`
+	Online    bool    `xlsx:"是否在线"`
+}
+
 func main() {
-	f, err := excelize.OpenFile("shenhe_20210822.xlsx")
+	fileName := flag.String("file", "shenhe_20210822.xlsx", "xlsx file")
+	sheetName := flag.String("sheet", "", "worksheet name, default the first sheet")
+	headerRow := flag.Int("header-row", 1, "row number of the header")
+	devices := flag.Bool("devices", false, "map rows to DeviceRow and report invalid cells instead of printing cells")
+	flag.Parse()
+
+	f, err := excelize.OpenFile(*fileName)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
-	// Get value from cell by given worksheet name and axis.
-	cell, err := f.GetCellValue("Sheet1", "B1")
+	if *sheetName == "" {
+		*sheetName = f.GetSheetList()[0]
+	}
+	r, err := sheet.NewReader(f, *sheetName)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
-	fmt.Println("aaa", cell)
-	// Get all the rows in the Sheet1.
-	rows, err := f.GetRows("Sheet1")
-	if err != nil {
+	r.HeaderRow = *headerRow
+
+	valid, invalid := 0, 0
+	for first := true; r.Next(); first = false {
+		if !*devices {
+			if first {
+				fmt.Println(strings.Join(r.Header(), "\t"))
+			}
+			fmt.Println(strings.Join(r.Cells(), "\t"))
+			continue
+		}
+		row := DeviceRow{}
+		err := r.Decode(&row)
+		cellErrs := sheet.Errors{}
+		if errors.As(err, &cellErrs) {
+			invalid++
+			for _, e := range cellErrs {
+				fmt.Fprintln(os.Stderr, e)
+			}
+			continue
+		}
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		valid++
+		fmt.Printf("%d\t%+v\n", r.Row(), row)
+	}
+	if err := r.Err(); err != nil {
 		fmt.Println(err)
 		return
 	}
-	for _, row := range rows {
-		for _, colCell := range row {
-			fmt.Print(colCell, "\t")
-		}
-		fmt.Println()
+	if *devices {
+		fmt.Printf("valid %d, invalid %d\n", valid, invalid)
 	}
 }
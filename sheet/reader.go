@@ -0,0 +1,145 @@
+package sheet
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Reader 用 excelize 的行迭代器逐行读取工作表并映射到结构体，不会一次性把整个工作表读入内存
+//
+//	r, err := sheet.NewReader(f, "Sheet1")
+//	for r.Next() {
+//		row := Device{}
+//		if err := r.Decode(&row); err != nil {
+//			// err 为 sheet.Errors，其余单元格仍然已经赋值
+//		}
+//	}
+//	err = r.Err()
+type Reader struct {
+	Sheet string
+	// HeaderRow 表头所在行，之前的行忽略，默认第 1 行
+	HeaderRow int
+	// Columns 按字段名覆盖 tag 中的列，用于运行时配置列映射，空串表示忽略该字段
+	Columns map[string]string
+
+	rows   *excelize.Rows
+	row    int
+	header []string
+	cells  []string
+	fields map[reflect.Type][]field
+	err    error
+}
+
+func NewReader(f *excelize.File, sheet string) (*Reader, error) {
+	rows, err := f.Rows(sheet)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{Sheet: sheet, HeaderRow: 1, rows: rows, fields: map[reflect.Type][]field{}}, nil
+}
+
+// Next 读取下一个数据行，跳过表头之前的行和空行
+func (r *Reader) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	for r.rows.Next() {
+		r.row++
+		cells, err := r.rows.Columns()
+		if err != nil {
+			r.err = err
+			return false
+		}
+		if r.row < r.HeaderRow {
+			continue
+		}
+		if r.row == r.HeaderRow {
+			r.header = cells
+			continue
+		}
+		if blank(cells) {
+			continue
+		}
+		r.cells = cells
+		return true
+	}
+	r.err = r.rows.Error()
+	if r.err == nil && r.header == nil {
+		r.err = fmt.Errorf("sheet %s has no header row %d", r.Sheet, r.HeaderRow)
+	}
+	return false
+}
+
+func blank(cells []string) bool {
+	for _, c := range cells {
+		if strings.TrimSpace(c) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Row 当前行号
+func (r *Reader) Row() int {
+	return r.row
+}
+
+// Header 表头
+func (r *Reader) Header() []string {
+	return r.header
+}
+
+// Cells 当前行的原始内容
+func (r *Reader) Cells() []string {
+	return r.cells
+}
+
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Decode 把当前行映射到 v 指向的结构体，单元格错误以 Errors 返回，表头缺少必填列时返回普通错误
+func (r *Reader) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("decode target must be a pointer to struct, got %T", v)
+	}
+	rv = rv.Elem()
+	fields, ok := r.fields[rv.Type()]
+	if !ok {
+		var err error
+		if fields, err = parseFields(rv.Type(), r.header, r.Columns); err != nil {
+			return err
+		}
+		r.fields[rv.Type()] = fields
+	}
+
+	var errs Errors
+	for _, f := range fields {
+		value := ""
+		if f.col < len(r.cells) {
+			value = strings.TrimSpace(r.cells[f.col])
+		}
+		var err error
+		if value == "" && f.required {
+			err = fmt.Errorf("required")
+		} else {
+			err = setValue(rv.Field(f.index), value, f.layout)
+		}
+		if err != nil {
+			column, _ := excelize.ColumnNumberToName(f.col + 1)
+			header := f.column
+			if f.col < len(r.header) {
+				header = r.header[f.col]
+			}
+			errs = append(errs, &CellError{Sheet: r.Sheet, Row: r.row, Column: column, Header: header, Value: value, Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
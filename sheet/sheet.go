@@ -0,0 +1,225 @@
+package sheet
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// CellError 单元格转换或校验失败，Column 为列字母
+type CellError struct {
+	Sheet  string
+	Row    int
+	Column string
+	Header string
+	Value  string
+	Err    error
+}
+
+func (e *CellError) Error() string {
+	return fmt.Sprintf("%s!%s%d (%s) %q: %v", e.Sheet, e.Column, e.Row, e.Header, e.Value, e.Err)
+}
+
+func (e *CellError) Unwrap() error {
+	return e.Err
+}
+
+// Errors 一行中所有出错的单元格
+type Errors []*CellError
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// field 结构体字段与列的对应关系，tag 形如 `xlsx:"经度,required,layout=2006/01/02"`，
+// 名称可以是表头或带 col: 前缀的列字母(如 col:C)；没有 tag 时使用字段名作为表头，"-" 表示忽略
+type field struct {
+	index    int
+	name     string
+	column   string
+	required bool
+	layout   string
+	col      int
+}
+
+// ColumnPrefix 按列字母指定列时的前缀，避免 ID、GPS 这类表头被当成列字母
+const ColumnPrefix = "col:"
+
+var columnLetters = regexp.MustCompile(`^[A-Z]{1,3}$`)
+
+// ResolveColumn 返回列序号(从 0 开始)，column 为表头名称或 col:C 形式的列字母，表头优先
+func ResolveColumn(header []string, column string) (int, error) {
+	for i, h := range header {
+		if strings.TrimSpace(h) == column {
+			return i, nil
+		}
+	}
+	if strings.HasPrefix(column, ColumnPrefix) {
+		letters := strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(column, ColumnPrefix)))
+		if !columnLetters.MatchString(letters) {
+			return -1, fmt.Errorf("invalid column letter %q", column)
+		}
+		n, err := excelize.ColumnNameToNumber(letters)
+		return n - 1, err
+	}
+	return -1, fmt.Errorf("column %q not found in header", column)
+}
+
+func parseFields(t reflect.Type, header []string, columns map[string]string) ([]field, error) {
+	var res []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		tag := sf.Tag.Get("xlsx")
+		if tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		f := field{index: i, name: sf.Name, column: strings.TrimSpace(parts[0])}
+		for _, opt := range parts[1:] {
+			opt = strings.TrimSpace(opt)
+			switch {
+			case opt == "required":
+				f.required = true
+			case strings.HasPrefix(opt, "layout="):
+				f.layout = strings.TrimPrefix(opt, "layout=")
+			}
+		}
+		if column, ok := columns[sf.Name]; ok {
+			if column == "" {
+				continue
+			}
+			f.column = column
+		}
+		if f.column == "" {
+			f.column = sf.Name
+		}
+		col, err := ResolveColumn(header, f.column)
+		if err != nil {
+			if f.required {
+				return nil, fmt.Errorf("field %s: %v", sf.Name, err)
+			}
+			continue
+		}
+		f.col = col
+		res = append(res, f)
+	}
+	return res, nil
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	// 1/2/06 15:04 和 01-02-06 是 excelize 按默认日期格式输出的日期单元格
+	timeLayouts = []string{"2006-01-02 15:04:05", "2006/01/02 15:04:05", "2006-01-02", "2006/01/02", "2006年1月2日",
+		"1/2/06 15:04", "1/2/06", "1/2/2006 15:04:05", "1/2/2006", "01-02-06", time.RFC3339}
+)
+
+// setValue 把单元格文本转换为字段类型，支持字符串、整数、浮点、布尔、时间、时长、指针和 encoding.TextUnmarshaler
+func setValue(v reflect.Value, s, layout string) error {
+	if v.Kind() == reflect.Ptr {
+		if s == "" {
+			return nil
+		}
+		v.Set(reflect.New(v.Type().Elem()))
+		v = v.Elem()
+	}
+	// time.Time 也实现了 TextUnmarshaler，只接受 RFC3339，需要先按时间处理
+	switch v.Type() {
+	case timeType:
+		if s == "" {
+			return nil
+		}
+		t, err := parseTime(s, layout)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		if s == "" {
+			return nil
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration")
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if s == "" {
+			return nil
+		}
+		n, err := strconv.ParseInt(strings.ReplaceAll(s, ",", ""), 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer")
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if s == "" {
+			return nil
+		}
+		n, err := strconv.ParseUint(strings.ReplaceAll(s, ",", ""), 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer")
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		if s == "" {
+			return nil
+		}
+		n, err := strconv.ParseFloat(strings.ReplaceAll(s, ",", ""), v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number")
+		}
+		v.SetFloat(n)
+	case reflect.Bool:
+		switch strings.ToLower(s) {
+		case "", "0", "false", "n", "no", "否", "f":
+			v.SetBool(false)
+		case "1", "true", "y", "yes", "是", "t":
+			v.SetBool(true)
+		default:
+			return fmt.Errorf("invalid boolean")
+		}
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+// parseTime 依次尝试 layout、常用格式和 Excel 日期序列号
+func parseTime(s, layout string) (time.Time, error) {
+	if layout != "" {
+		return time.ParseInLocation(layout, s, time.Local)
+	}
+	for _, l := range timeLayouts {
+		if t, err := time.ParseInLocation(l, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if serial, err := strconv.ParseFloat(s, 64); err == nil && serial > 0 {
+		return excelize.ExcelDateToTime(serial, false)
+	}
+	return time.Time{}, fmt.Errorf("invalid date")
+}
@@ -0,0 +1,201 @@
+package sheet
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// code 实现 TextUnmarshaler 的自定义类型
+type code string
+
+func (c *code) UnmarshalText(b []byte) error {
+	*c = code(strings.ToUpper(string(b)))
+	return nil
+}
+
+type record struct {
+	Name     string     `xlsx:"名称,required"`
+	ID       int64      `xlsx:"col:B"`
+	Lon      float64    `xlsx:"经度"`
+	Online   bool       `xlsx:"在线"`
+	Date     time.Time  `xlsx:"日期"`
+	Checked  *time.Time `xlsx:"检查日期,layout=2006.01.02"`
+	Code     code       `xlsx:"编码"`
+	Interval time.Duration
+	Skip     string `xlsx:"-"`
+	Missing  string `xlsx:"不存在"`
+}
+
+func newTestFile(t *testing.T, rows [][]interface{}) *excelize.File {
+	t.Helper()
+	f := excelize.NewFile()
+	for i, row := range rows {
+		cell, err := excelize.CoordinatesToCellName(1, i+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.SetSheetRow("Sheet1", cell, &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return f
+}
+
+func readAll(t *testing.T, f *excelize.File, configure func(*Reader)) ([]record, []error) {
+	t.Helper()
+	r, err := NewReader(f, "Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configure != nil {
+		configure(r)
+	}
+	var res []record
+	var errs []error
+	for r.Next() {
+		row := record{}
+		errs = append(errs, r.Decode(&row))
+		res = append(res, row)
+	}
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return res, errs
+}
+
+var header = []interface{}{"名称", "编号", "经度", "在线", "日期", "检查日期", "编码", "Interval", "Skip"}
+
+func TestDecode(t *testing.T) {
+	day := time.Date(2021, 8, 22, 0, 0, 0, 0, time.Local)
+	f := newTestFile(t, [][]interface{}{
+		header,
+		{"a", "1,024", "123.456", "是", "2021-08-22", "2021.08.22", "ab", "1m30s", "x"},
+		// 真正的日期单元格，excelize 输出为 8/22/21 13:05
+		{"b", 2, 41.8, "0", day.Add(13*time.Hour + 5*time.Minute), "", "", "", ""},
+		{"c", "", "", "", "8/22/21", "", "", "", ""},
+		{"d", "", "", "", "44430", "", "", "", ""},
+		{"e", "", "", "", "2021年8月22日", "", "", "", ""},
+	})
+	rows, errs := readAll(t, f, nil)
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("row %d: %v", i+2, err)
+		}
+	}
+	if len(rows) != 5 {
+		t.Fatalf("read %d rows, want 5", len(rows))
+	}
+
+	a := rows[0]
+	checked := day
+	want := record{Name: "a", ID: 1024, Lon: 123.456, Online: true, Date: day, Checked: &checked, Code: "AB", Interval: 90 * time.Second}
+	if a.Name != want.Name || a.ID != want.ID || a.Lon != want.Lon || a.Online != want.Online ||
+		!a.Date.Equal(want.Date) || a.Checked == nil || !a.Checked.Equal(checked) || a.Code != want.Code ||
+		a.Interval != want.Interval || a.Skip != "" || a.Missing != "" {
+		t.Errorf("row 2 = %+v, want %+v", a, want)
+	}
+	if b := rows[1]; b.ID != 2 || b.Lon != 41.8 || b.Online || b.Checked != nil ||
+		!b.Date.Equal(day.Add(13*time.Hour+5*time.Minute)) {
+		t.Errorf("row 3 = %+v", b)
+	}
+	for _, r := range rows[2:] {
+		if !r.Date.Equal(day) {
+			t.Errorf("%s: Date = %v, want %v", r.Name, r.Date, day)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	f := newTestFile(t, [][]interface{}{
+		{"标题"},
+		header,
+		{"", "x", "abc", "maybe", "2021-13-45", "2021-08-22", "", "soon", ""},
+	})
+	_, errs := readAll(t, f, func(r *Reader) { r.HeaderRow = 2 })
+	if len(errs) != 1 {
+		t.Fatalf("read %d rows, want 1", len(errs))
+	}
+	var cellErrs Errors
+	if !errors.As(errs[0], &cellErrs) {
+		t.Fatalf("error %v is not Errors", errs[0])
+	}
+	want := []CellError{
+		{Sheet: "Sheet1", Row: 3, Column: "A", Header: "名称", Value: ""},
+		{Sheet: "Sheet1", Row: 3, Column: "B", Header: "编号", Value: "x"},
+		{Sheet: "Sheet1", Row: 3, Column: "C", Header: "经度", Value: "abc"},
+		{Sheet: "Sheet1", Row: 3, Column: "D", Header: "在线", Value: "maybe"},
+		{Sheet: "Sheet1", Row: 3, Column: "E", Header: "日期", Value: "2021-13-45"},
+		{Sheet: "Sheet1", Row: 3, Column: "F", Header: "检查日期", Value: "2021-08-22"},
+		{Sheet: "Sheet1", Row: 3, Column: "H", Header: "Interval", Value: "soon"},
+	}
+	if len(cellErrs) != len(want) {
+		t.Fatalf("got %d cell errors, want %d: %v", len(cellErrs), len(want), cellErrs)
+	}
+	for i, e := range cellErrs {
+		w := want[i]
+		if e.Sheet != w.Sheet || e.Row != w.Row || e.Column != w.Column || e.Header != w.Header || e.Value != w.Value || e.Err == nil {
+			t.Errorf("cell error %d = %+v, want %+v", i, *e, w)
+		}
+	}
+	if !strings.Contains(cellErrs[0].Error(), "Sheet1!A3 (名称)") {
+		t.Errorf("Error() = %q", cellErrs[0].Error())
+	}
+}
+
+func TestDecodeColumns(t *testing.T) {
+	f := newTestFile(t, [][]interface{}{
+		{"name", "编号", "lon"},
+		{"a", "1", "123.4"},
+	})
+	// 运行时把名称映射到 A 列(col:A)，经度映射到 lon，空串忽略编号
+	rows, errs := readAll(t, f, func(r *Reader) {
+		r.Columns = map[string]string{"Name": "col:A", "Lon": "lon", "ID": ""}
+	})
+	if len(rows) != 1 || errs[0] != nil {
+		t.Fatalf("rows = %v, errors = %v", rows, errs)
+	}
+	if r := rows[0]; r.Name != "a" || r.Lon != 123.4 || r.ID != 0 {
+		t.Errorf("row = %+v", r)
+	}
+
+	// 表头缺少必填列时返回普通错误
+	_, errs = readAll(t, f, nil)
+	var cellErrs Errors
+	if errs[0] == nil || errors.As(errs[0], &cellErrs) {
+		t.Errorf("missing required column error = %v, want a plain error", errs[0])
+	}
+}
+
+func TestResolveColumn(t *testing.T) {
+	header := []string{"名称", " 经度 ", "B", "ID", "col:A"}
+	tests := []struct {
+		column string
+		want   int
+		err    bool
+	}{
+		{column: "名称", want: 0},
+		{column: "经度", want: 1},
+		{column: "B", want: 2},
+		// 大写的表头不会被当成列字母
+		{column: "ID", want: 3},
+		{column: "GPS", err: true},
+		{column: "C", err: true},
+		// 列字母需要 col: 前缀，表头优先
+		{column: "col:C", want: 2},
+		{column: "col:aa", want: 26},
+		{column: "col:A", want: 4},
+		{column: "col:", err: true},
+		{column: "col:A1", err: true},
+		{column: "纬度", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ResolveColumn(header, tt.column)
+		if (err != nil) != tt.err || (!tt.err && got != tt.want) {
+			t.Errorf("ResolveColumn(%q) = %d, %v, want %d", tt.column, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go-web-study/downloader"
+)
+
+// APIConfig 平台接口地址和认证配置，不同现场的端口、路径和认证方式可能不同
+type APIConfig struct {
+	Scheme    string
+	Host      string
+	VideoPort int
+	// APIPort galaxy 接口端口，0 表示使用协议默认端口
+	APIPort   int
+	VideoPath string
+	CountPath string
+	LoginPath string
+
+	Token     string
+	TokenFile string
+	Username  string
+	Password  string
+
+	CAFile   string
+	Insecure bool
+	Timeout  time.Duration
+}
+
+func (c APIConfig) baseURL(port int) string {
+	if port == 0 {
+		return fmt.Sprintf("%s://%s", c.Scheme, c.Host)
+	}
+	return fmt.Sprintf("%s://%s:%d", c.Scheme, c.Host, port)
+}
+
+// VideoURL 分页地址模板，依次填入 pageSize 和 pageOffset
+func (c APIConfig) VideoURL() string {
+	return c.baseURL(c.VideoPort) + c.VideoPath + "?pageSize=%d&pageOffset=%d"
+}
+
+func (c APIConfig) CountURL() string {
+	return c.baseURL(c.APIPort) + c.CountPath
+}
+
+func (c APIConfig) LoginURL() string {
+	return c.baseURL(c.APIPort) + c.LoginPath
+}
+
+func (c APIConfig) clientConfig() downloader.ClientConfig {
+	return downloader.ClientConfig{Timeout: c.Timeout, CAFile: c.CAFile, Insecure: c.Insecure}
+}
+
+// NewAPIClient 按优先级 -token、-token-file、SHENBEI_TOKEN、用户名密码登录获取认证信息，
+// 返回的 client 对每个请求携带 Authorization 头
+func NewAPIClient(c APIConfig) (*http.Client, error) {
+	token, err := c.resolveToken()
+	if err != nil {
+		return nil, err
+	}
+	clientConfig := c.clientConfig()
+	clientConfig.Headers = map[string]string{"Authorization": token}
+	return downloader.NewClient(clientConfig, nil)
+}
+
+func (c APIConfig) resolveToken() (string, error) {
+	if c.Token != "" {
+		return c.Token, nil
+	}
+	if c.TokenFile != "" {
+		content, err := ioutil.ReadFile(c.TokenFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(content)), nil
+	}
+	if token := os.Getenv("SHENBEI_TOKEN"); token != "" {
+		return token, nil
+	}
+	if c.Username != "" {
+		return c.login()
+	}
+	return "", fmt.Errorf("no credentials configured, use -token, -token-file, SHENBEI_TOKEN or -user")
+}
+
+type loginRes struct {
+	Token string `json:"token"`
+	Data  struct {
+		Token string `json:"token"`
+	} `json:"data"`
+}
+
+// login 用用户名密码换取 token，兼容 {"token":""} 和 {"data":{"token":""}} 两种返回
+func (c APIConfig) login() (string, error) {
+	client, err := downloader.NewClient(c.clientConfig(), nil)
+	if err != nil {
+		return "", err
+	}
+	password := c.Password
+	if password == "" {
+		password = os.Getenv("SHENBEI_PASSWORD")
+	}
+	reqBodyJson, _ := json.Marshal(map[string]string{
+		"username": c.Username,
+		"password": password,
+	})
+	resp, err := client.Post(c.LoginURL(), "application/json;charset=UTF-8", bytes.NewBuffer(reqBodyJson))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("login failed, status %s: %s", resp.Status, string(body))
+	}
+	res := loginRes{}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return "", err
+	}
+	if res.Token != "" {
+		return res.Token, nil
+	}
+	if res.Data.Token != "" {
+		return res.Data.Token, nil
+	}
+	return "", fmt.Errorf("login response has no token: %s", string(body))
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIConfigURLs(t *testing.T) {
+	tests := []struct {
+		config APIConfig
+		video  string
+		count  string
+		login  string
+	}{
+		{
+			config: APIConfig{Scheme: "http", Host: "10.0.0.1", VideoPort: 8080, VideoPath: "/v5/videos", CountPath: "/api/galaxy/v1/device/cameras:search", LoginPath: "/api/galaxy/v1/login"},
+			video:  "http://10.0.0.1:8080/v5/videos?pageSize=%d&pageOffset=%d",
+			count:  "http://10.0.0.1/api/galaxy/v1/device/cameras:search",
+			login:  "http://10.0.0.1/api/galaxy/v1/login",
+		},
+		{
+			// 端口为 0 时使用协议默认端口
+			config: APIConfig{Scheme: "https", Host: "shenbei.example.com", APIPort: 8443, VideoPath: "/videos", CountPath: "/count", LoginPath: "/login"},
+			video:  "https://shenbei.example.com/videos?pageSize=%d&pageOffset=%d",
+			count:  "https://shenbei.example.com:8443/count",
+			login:  "https://shenbei.example.com:8443/login",
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.config.VideoURL(); got != tt.video {
+			t.Errorf("VideoURL() = %s, want %s", got, tt.video)
+		}
+		if got := tt.config.CountURL(); got != tt.count {
+			t.Errorf("CountURL() = %s, want %s", got, tt.count)
+		}
+		if got := tt.config.LoginURL(); got != tt.login {
+			t.Errorf("LoginURL() = %s, want %s", got, tt.login)
+		}
+	}
+}
+
+// setenv 设置环境变量并在测试结束后恢复
+func setenv(t *testing.T, key, value string) {
+	old, ok := os.LookupEnv(key)
+	if value == "" {
+		_ = os.Unsetenv(key)
+	} else {
+		_ = os.Setenv(key, value)
+	}
+	t.Cleanup(func() {
+		if ok {
+			_ = os.Setenv(key, old)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+	})
+}
+
+// loginServer 模拟登录接口，只接受 admin/secret
+func loginServer(t *testing.T, response string) APIConfig {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/login" || r.Method != "POST" {
+			http.NotFound(w, r)
+			return
+		}
+		var req map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req["username"] != "admin" || req["password"] != "secret" {
+			http.Error(w, "wrong password", http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(response))
+	}))
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := strconv.Atoi(u.Port())
+	return APIConfig{Scheme: "http", Host: u.Hostname(), APIPort: port, LoginPath: "/login", Timeout: 5 * time.Second}
+}
+
+func TestResolveToken(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token.txt")
+	if err := ioutil.WriteFile(tokenFile, []byte("file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		response string
+		token    string
+		file     string
+		env      string
+		user     string
+		password string
+		envPass  string
+		want     string
+		err      string
+	}{
+		{name: "token first", token: "flag-token", file: tokenFile, env: "env-token", user: "admin", want: "flag-token"},
+		{name: "token file", file: tokenFile, env: "env-token", user: "admin", want: "file-token"},
+		{name: "missing token file", file: filepath.Join(t.TempDir(), "missing"), env: "env-token", err: "no such file"},
+		{name: "env", env: "env-token", user: "admin", want: "env-token"},
+		{name: "login token", response: `{"token":"login-token"}`, user: "admin", password: "secret", want: "login-token"},
+		{name: "login data token", response: `{"code":0,"data":{"token":"data-token"}}`, user: "admin", password: "secret", want: "data-token"},
+		{name: "login env password", response: `{"token":"login-token"}`, user: "admin", envPass: "secret", want: "login-token"},
+		{name: "wrong password", response: `{"token":"login-token"}`, user: "admin", password: "guess", err: "login failed, status 401"},
+		{name: "no token in response", response: `{"code":0,"data":{}}`, user: "admin", password: "secret", err: "login response has no token"},
+		{name: "invalid response", response: `<html>`, user: "admin", password: "secret", err: "invalid character"},
+		{name: "no credentials", err: "no credentials configured"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setenv(t, "SHENBEI_TOKEN", tt.env)
+			setenv(t, "SHENBEI_PASSWORD", tt.envPass)
+			config := loginServer(t, tt.response)
+			config.Token, config.TokenFile, config.Username, config.Password = tt.token, tt.file, tt.user, tt.password
+
+			got, err := config.resolveToken()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("resolveToken() = %q, %v, want error %q", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("resolveToken() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAPIClient(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "site-token" {
+			http.Error(w, "bad token "+auth, http.StatusUnauthorized)
+			return
+		}
+		var req map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req["action"] != "all" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"totalRecords":42}}`))
+	}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, cert, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		config APIConfig
+		total  int
+		err    string
+	}{
+		{name: "ca file", config: APIConfig{Token: "site-token", CAFile: caFile}, total: 42},
+		{name: "insecure", config: APIConfig{Token: "site-token", Insecure: true}, total: 42},
+		{name: "unknown ca", config: APIConfig{Token: "site-token"}, err: "certificate"},
+		{name: "wrong token", config: APIConfig{Token: "other", Insecure: true}, err: "401"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Timeout = 5 * time.Second
+			client, err := NewAPIClient(tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			total, err := GetVideoCount(client, srv.URL+"/count")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("GetVideoCount = %d, %v, want error %q", total, err, tt.err)
+				}
+				return
+			}
+			if err != nil || total != tt.total {
+				t.Errorf("GetVideoCount = %d, %v, want %d", total, err, tt.total)
+			}
+		})
+	}
+}
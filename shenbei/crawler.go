@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Crawler 分页拉取所有解析设备，控制并发、失败重试并校验总数
+type Crawler struct {
+	Client   *http.Client
+	CountURL string
+	// VideoURL 分页地址模板，依次填入 pageSize 和 pageOffset
+	VideoURL string
+	// PageSize 为 0 时使用 DefaultPageSize
+	PageSize int
+	Workers  int
+	Retry    int
+	// OnError 每次接口请求失败时回调，api 为 count 或 videos
+	OnError func(api string, err error)
+}
+
+const DefaultPageSize = 100
+
+func (c *Crawler) pageSize() int {
+	if c.PageSize <= 0 {
+		return DefaultPageSize
+	}
+	return c.PageSize
+}
+
+type pageResult struct {
+	page   int
+	videos []Video
+	err    error
+}
+
+// Crawl 返回按 ID 去重后的设备列表，数量与 totalRecords 不一致时返回错误
+func (c *Crawler) Crawl(ctx context.Context) ([]Video, error) {
+	total, err := GetVideoCount(c.Client, c.CountURL)
+	if err != nil {
+		c.reportError("count", err)
+		return nil, fmt.Errorf("get video count failed: %v", err)
+	}
+	if total == 0 {
+		return []Video{}, nil
+	}
+	pageSize := c.pageSize()
+	pages := (total + pageSize - 1) / pageSize
+	log.Printf("设备总数为%d，分%d页获取", total, pages)
+
+	workers := c.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	pageChan := make(chan int)
+	resultChan := make(chan pageResult, pages)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range pageChan {
+				videos, err := c.fetchPage(ctx, page, expectedPageSize(total, pageSize, page))
+				resultChan <- pageResult{page: page, videos: videos, err: err}
+			}
+		}()
+	}
+	go func() {
+		defer close(pageChan)
+		for page := 0; page < pages; page++ {
+			select {
+			case pageChan <- page:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(resultChan)
+	}()
+
+	seen := make(map[string]bool, total)
+	allVideo := make([]Video, 0, total)
+	var errs []error
+	for res := range resultChan {
+		if res.err != nil {
+			errs = append(errs, fmt.Errorf("page %d: %v", res.page, res.err))
+			continue
+		}
+		for _, video := range res.videos {
+			if seen[video.ID] {
+				log.Printf("重复的设备 id=%s name=%s", video.ID, video.Name)
+				continue
+			}
+			seen[video.ID] = true
+			allVideo = append(allVideo, video)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return allVideo, err
+	}
+	if len(errs) > 0 {
+		return allVideo, fmt.Errorf("%d pages failed, first error: %v", len(errs), errs[0])
+	}
+	if len(allVideo) != total {
+		return allVideo, fmt.Errorf("collected %d videos, but totalRecords is %d", len(allVideo), total)
+	}
+	return allVideo, nil
+}
+
+// expectedPageSize 除最后一页外每页都应该是满的
+func expectedPageSize(total, pageSize, page int) int {
+	if rest := total - page*pageSize; rest < pageSize {
+		return rest
+	}
+	return pageSize
+}
+
+func (c *Crawler) fetchPage(ctx context.Context, page, expected int) ([]Video, error) {
+	pageSize := c.pageSize()
+	url := fmt.Sprintf(c.VideoURL, pageSize, page*pageSize)
+	var err error
+	for attempt := 0; attempt <= c.Retry; attempt++ {
+		if attempt > 0 {
+			log.Printf("第%d页获取失败，第%d次重试: %v", page, attempt, err)
+			select {
+			case <-time.After(time.Duration(attempt) * time.Second):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		listVideoRes := &ListVideoRes{}
+		if err = DoGetVideos(ctx, c.Client, url, listVideoRes); err != nil {
+			c.reportError("videos", err)
+			continue
+		}
+		if len(listVideoRes.Videos) < expected {
+			err = fmt.Errorf("short page, got %d videos, expect %d", len(listVideoRes.Videos), expected)
+			continue
+		}
+		return listVideoRes.Videos, nil
+	}
+	return nil, err
+}
+
+func (c *Crawler) reportError(api string, err error) {
+	if c.OnError != nil {
+		c.OnError(api, err)
+	}
+}
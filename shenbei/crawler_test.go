@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// videoServer 模拟设备总数和分页接口，handle 返回 true 时表示已经改写了这一页的响应
+type videoServer struct {
+	total  int
+	videos []Video
+	handle func(w http.ResponseWriter, offset, attempt int) bool
+
+	lock     sync.Mutex
+	attempts map[int]int
+}
+
+func newVideoServer(total int, videos []Video) *videoServer {
+	return &videoServer{total: total, videos: videos, attempts: make(map[int]int)}
+}
+
+func (s *videoServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/count":
+		if r.Method != "POST" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"data":{"totalRecords":%d}}`, s.total)
+	case "/videos":
+		size, _ := strconv.Atoi(r.URL.Query().Get("pageSize"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("pageOffset"))
+		s.lock.Lock()
+		s.attempts[offset]++
+		attempt := s.attempts[offset]
+		s.lock.Unlock()
+		if s.handle != nil && s.handle(w, offset, attempt) {
+			return
+		}
+		end := offset + size
+		if end > len(s.videos) {
+			end = len(s.videos)
+		}
+		if offset > end {
+			offset = end
+		}
+		_ = json.NewEncoder(w).Encode(ListVideoRes{Videos: s.videos[offset:end]})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *videoServer) requests() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	n := 0
+	for _, attempts := range s.attempts {
+		n += attempts
+	}
+	return n
+}
+
+func newVideos(n int) []Video {
+	videos := make([]Video, 0, n)
+	for i := 0; i < n; i++ {
+		videos = append(videos, Video{ID: strconv.Itoa(i), Name: fmt.Sprintf("camera-%d", i), Status: "VIDEO_PROCESSING"})
+	}
+	return videos
+}
+
+func videoIDs(videos []Video) string {
+	var res []string
+	for _, v := range videos {
+		res = append(res, v.ID)
+	}
+	sort.Strings(res)
+	return strings.Join(res, ",")
+}
+
+func newTestCrawler(srv *httptest.Server, pageSize, retry int) (*Crawler, *[]string) {
+	lock := sync.Mutex{}
+	var apis []string
+	return &Crawler{
+		Client:   srv.Client(),
+		CountURL: srv.URL + "/count",
+		VideoURL: srv.URL + "/videos?pageSize=%d&pageOffset=%d",
+		PageSize: pageSize,
+		Workers:  2,
+		Retry:    retry,
+		OnError: func(api string, err error) {
+			lock.Lock()
+			apis = append(apis, api)
+			lock.Unlock()
+		},
+	}, &apis
+}
+
+func TestCrawl(t *testing.T) {
+	tests := []struct {
+		name     string
+		total    int
+		videos   []Video
+		pageSize int
+		retry    int
+		handle   func(w http.ResponseWriter, offset, attempt int) bool
+		want     string
+		requests int
+		err      string
+		apis     []string
+	}{
+		{
+			name:     "paging",
+			total:    5,
+			videos:   newVideos(5),
+			pageSize: 2,
+			want:     "0,1,2,3,4",
+			requests: 3,
+		},
+		{
+			// PageSize 为 0 时使用默认值，一页就够
+			name:     "default page size",
+			total:    5,
+			videos:   newVideos(5),
+			want:     "0,1,2,3,4",
+			requests: 1,
+		},
+		{
+			name:     "empty",
+			want:     "",
+			requests: 0,
+		},
+		{
+			name:     "retry failed page",
+			total:    4,
+			videos:   newVideos(4),
+			pageSize: 2,
+			retry:    1,
+			handle: func(w http.ResponseWriter, offset, attempt int) bool {
+				if offset == 2 && attempt == 1 {
+					http.Error(w, "busy", http.StatusServiceUnavailable)
+					return true
+				}
+				return false
+			},
+			want:     "0,1,2,3",
+			requests: 3,
+			apis:     []string{"videos"},
+		},
+		{
+			name:     "page keeps failing",
+			total:    4,
+			videos:   newVideos(4),
+			pageSize: 2,
+			handle: func(w http.ResponseWriter, offset, attempt int) bool {
+				if offset == 2 {
+					http.Error(w, "busy", http.StatusServiceUnavailable)
+					return true
+				}
+				return false
+			},
+			want:     "0,1",
+			requests: 2,
+			err:      "1 pages failed",
+			apis:     []string{"videos"},
+		},
+		{
+			name:     "invalid json",
+			total:    2,
+			videos:   newVideos(2),
+			pageSize: 2,
+			handle: func(w http.ResponseWriter, offset, attempt int) bool {
+				_, _ = w.Write([]byte("<html>"))
+				return true
+			},
+			requests: 1,
+			err:      "invalid character",
+			apis:     []string{"videos"},
+		},
+		{
+			// 不是最后一页却不满，说明分页过程中设备列表变化了
+			name:     "short page",
+			total:    4,
+			videos:   newVideos(3),
+			pageSize: 2,
+			want:     "0,1",
+			requests: 2,
+			err:      "short page, got 1 videos, expect 2",
+		},
+		{
+			name:     "duplicate across pages",
+			total:    4,
+			videos:   append(newVideos(3), Video{ID: "1", Name: "camera-1"}),
+			pageSize: 2,
+			want:     "0,1,2",
+			requests: 2,
+			err:      "collected 3 videos, but totalRecords is 4",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vs := newVideoServer(tt.total, tt.videos)
+			vs.handle = tt.handle
+			srv := httptest.NewServer(vs)
+			defer srv.Close()
+
+			crawler, apis := newTestCrawler(srv, tt.pageSize, tt.retry)
+			videos, err := crawler.Crawl(context.Background())
+			if tt.err == "" && err != nil {
+				t.Fatalf("Crawl error = %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Crawl error = %v, want %q", err, tt.err)
+			}
+			if got := videoIDs(videos); got != tt.want {
+				t.Errorf("Crawl = %s, want %s", got, tt.want)
+			}
+			if n := vs.requests(); n != tt.requests {
+				t.Errorf("%d page requests, want %d", n, tt.requests)
+			}
+			if strings.Join(*apis, ",") != strings.Join(tt.apis, ",") {
+				t.Errorf("OnError apis = %v, want %v", *apis, tt.apis)
+			}
+		})
+	}
+}
+
+func TestCrawlCountError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	crawler, apis := newTestCrawler(srv, 2, 3)
+	videos, err := crawler.Crawl(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "get video count failed") {
+		t.Errorf("Crawl error = %v, want count error", err)
+	}
+	if videos != nil {
+		t.Errorf("Crawl = %v, want nil", videos)
+	}
+	if len(*apis) != 1 || (*apis)[0] != "count" {
+		t.Errorf("OnError apis = %v, want [count]", *apis)
+	}
+}
+
+func TestCrawlCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	vs := newVideoServer(4, newVideos(4))
+	vs.handle = func(w http.ResponseWriter, offset, attempt int) bool {
+		cancel()
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+		return true
+	}
+	srv := httptest.NewServer(vs)
+	defer srv.Close()
+
+	// 重试等待期间取消时立即返回
+	crawler, _ := newTestCrawler(srv, 2, 10)
+	if _, err := crawler.Crawl(ctx); err != context.Canceled {
+		t.Errorf("Crawl error = %v, want context.Canceled", err)
+	}
+}
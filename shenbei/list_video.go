@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -10,7 +11,10 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"sync"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 )
 
 type Video struct {
@@ -32,11 +36,10 @@ type ListVideoRes struct {
 	Videos []Video `json:"videos"`
 }
 
-func GetVideoCount(url string) int {
+func GetVideoCount(client *http.Client, url string) (int, error) {
 
 	headMap := map[string]string{
-		"Authorization": "59dacfac729esuperadmin427f90bfa98c0a636e0c",
-		"Content-Type":  "application/json;charset=UTF-8",
+		"Content-Type": "application/json;charset=UTF-8",
 	}
 	reqBody := map[string]interface{}{
 		"action":   "all",
@@ -44,55 +47,84 @@ func GetVideoCount(url string) int {
 		"pageSize": 1,
 	}
 	reqBodyJson, _ := json.Marshal(reqBody)
-	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(reqBodyJson))
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(reqBodyJson))
+	if err != nil {
+		return 0, err
+	}
 	for k, v := range headMap {
 		req.Header.Set(k, v)
 	}
-	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Println(err.Error())
+		return 0, err
 	}
 	defer func(Body io.ReadCloser) {
 		_ = Body.Close()
 	}(resp.Body)
-	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
 	videoCount := &VideoCount{}
 	if err := json.Unmarshal(body, videoCount); err != nil {
-		fmt.Println(err.Error())
+		return 0, err
 	}
-	return videoCount.Data.Total
-}
-
-func GetVideos(wg *sync.WaitGroup, url string, listVideoResChan chan *ListVideoRes) {
-	defer wg.Done()
-	listVideoRes := &ListVideoRes{}
-	DoGetVideos(url, listVideoRes)
-	listVideoResChan <- listVideoRes
+	return videoCount.Data.Total, nil
 }
 
-func DoGetVideos(url string, listVideoRes *ListVideoRes) {
-	resp, err := http.Get(url)
+func DoGetVideos(ctx context.Context, client *http.Client, url string, listVideoRes *ListVideoRes) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		fmt.Println(err)
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
 	}
 	defer func(Body io.ReadCloser) {
 		_ = Body.Close()
 	}(resp.Body)
-	body, _ := ioutil.ReadAll(resp.Body)
-	if err := json.Unmarshal(body, listVideoRes); err != nil {
-		fmt.Println(err.Error())
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
 	}
+	return json.Unmarshal(body, listVideoRes)
 }
 
 type Config struct {
-	host     string
+	api      APIConfig
 	pageSize int
+	workers  int
+	retry    int
+	format   string
+	status   string
+	output   string
+	watch    WatchConfig
+	listen   string
+	action   string
+	fix      RemediateConfig
 	h        bool
 }
 
+// RemediateConfig restart/reanalyze 子命令的参数
+type RemediateConfig struct {
+	Method        string
+	RestartPath   string
+	ReanalyzePath string
+	Concurrency   int
+	DryRun        bool
+	Yes           bool
+	StuckFor      time.Duration
+}
+
 func usage() {
-	fmt.Fprintf(os.Stderr, `Usage: list_video.exe -host 127.0.0.1 -size 100
+	fmt.Fprintf(os.Stderr, `Usage: list_video.exe [restart|reanalyze] -host 127.0.0.1 -size 100 [-scheme https] [-token-file token.txt | -user admin -password xxx] [-watch 1m] [-listen :9101] [-format table|csv|json|xlsx] [-status VIDEO_ERROR,VIDEO_PREPARING] [-o report.xlsx]
 `)
 	flag.PrintDefaults()
 }
@@ -101,55 +133,212 @@ var cfg Config
 
 func init() {
 
-	flag.StringVar(&cfg.host, "host", "", "must set host")
-	flag.IntVar(&cfg.pageSize, "size", 100, "set pageSize")
+	flag.StringVar(&cfg.api.Host, "host", "", "must set host")
+	flag.StringVar(&cfg.api.Scheme, "scheme", "http", "http or https")
+	flag.IntVar(&cfg.api.VideoPort, "video-port", 8080, "port of the video api, 0 means scheme default")
+	flag.IntVar(&cfg.api.APIPort, "api-port", 0, "port of the galaxy api, 0 means scheme default")
+	flag.StringVar(&cfg.api.VideoPath, "video-path", "/v5/videos", "video list api path")
+	flag.StringVar(&cfg.api.CountPath, "count-path", "/api/galaxy/v1/device/cameras:search", "camera count api path")
+	flag.StringVar(&cfg.api.LoginPath, "login-path", "/api/galaxy/v1/login", "login api path used with -user")
+	flag.StringVar(&cfg.api.Token, "token", "", "authorization token, or use -token-file / SHENBEI_TOKEN")
+	flag.StringVar(&cfg.api.TokenFile, "token-file", "", "file containing the authorization token")
+	flag.StringVar(&cfg.api.Username, "user", "", "login username to obtain a token")
+	flag.StringVar(&cfg.api.Password, "password", "", "login password, or use SHENBEI_PASSWORD")
+	flag.StringVar(&cfg.api.CAFile, "ca-file", "", "extra CA certificate file in PEM format")
+	flag.BoolVar(&cfg.api.Insecure, "insecure", false, "skip tls certificate verification")
+	flag.DurationVar(&cfg.api.Timeout, "timeout", 30*time.Second, "http request timeout")
+	flag.IntVar(&cfg.pageSize, "size", DefaultPageSize, "set pageSize, 0 means the default")
+	flag.IntVar(&cfg.workers, "workers", 4, "concurrent page requests")
+	flag.IntVar(&cfg.retry, "retry", 3, "retry count for each failed page")
+	flag.StringVar(&cfg.format, "format", FormatTable, "report format: table, csv, json or xlsx")
+	flag.StringVar(&cfg.status, "status", "", "only report these statuses, comma separated, e.g. VIDEO_ERROR,VIDEO_PREPARING")
+	flag.StringVar(&cfg.output, "o", "", "output file, default stdout (xlsx defaults to list_video_<date>.xlsx)")
+	flag.DurationVar(&cfg.watch.Interval, "watch", 0, "poll interval for continuous monitoring, e.g. 1m, 0 means take one snapshot")
+	flag.StringVar(&cfg.watch.HistoryFile, "history", "list_video_history.jsonl", "status change history file used by -watch")
+	flag.DurationVar(&cfg.watch.FlapWindow, "flap-window", time.Hour, "time window for flapping detection")
+	flag.IntVar(&cfg.watch.FlapCount, "flap-count", 3, "status changes within -flap-window to report a camera as flapping")
+	flag.StringVar(&cfg.listen, "listen", "", "serve prometheus /metrics on this address, e.g. :9101, implies -watch 1m")
+	flag.StringVar(&cfg.fix.Method, "action-method", "POST", "http method of the camera control api")
+	flag.StringVar(&cfg.fix.RestartPath, "restart-path", "/v5/videos/%s/restart", "camera restart api path, %s is the video id")
+	flag.StringVar(&cfg.fix.ReanalyzePath, "reanalyze-path", "/v5/videos/%s/reanalyze", "camera reanalyze api path, %s is the video id")
+	flag.IntVar(&cfg.fix.Concurrency, "concurrency", 4, "concurrent camera control requests")
+	flag.BoolVar(&cfg.fix.DryRun, "dry-run", false, "only print the cameras and requests, do not call the api")
+	flag.BoolVar(&cfg.fix.Yes, "yes", false, "skip the confirmation prompt")
+	flag.DurationVar(&cfg.fix.StuckFor, "stuck-for", 0, "only act on cameras whose status has not changed for this long, based on -history")
 	flag.BoolVar(&cfg.h, "h", false, "this help")
 	flag.Usage = usage
 }
 
 func main() {
-	flag.Parse()
+	if len(os.Args) > 1 && (os.Args[1] == ActionRestart || os.Args[1] == ActionReanalyze) {
+		cfg.action = os.Args[1]
+		_ = flag.CommandLine.Parse(os.Args[2:])
+	} else {
+		flag.Parse()
+	}
 	if cfg.h {
 		flag.Usage()
 		return
 	}
 
-	if cfg.host == "" {
+	if cfg.api.Host == "" {
 		log.Println("please set the host")
 		flag.Usage()
 		return
 	}
+	switch cfg.format {
+	case FormatTable, FormatCSV, FormatJSON, FormatXLSX:
+	default:
+		log.Printf("unknown format %q", cfg.format)
+		flag.Usage()
+		return
+	}
+
+	client, err := NewAPIClient(cfg.api)
+	if err != nil {
+		log.Fatalf("初始化接口认证失败: %v", err)
+	}
+	crawler := &Crawler{
+		Client:   client,
+		CountURL: cfg.api.CountURL(),
+		VideoURL: cfg.api.VideoURL(),
+		PageSize: cfg.pageSize,
+		Workers:  cfg.workers,
+		Retry:    cfg.retry,
+	}
 
-	allVideo := make([]Video, 0)
-	offset := 0
-	videoUrl := "http://%s:8080/v5/videos?pageSize=%d&pageOffset=%d"
-	videoCountUrl := "http://%s/api/galaxy/v1/device/cameras:search"
-	total := GetVideoCount(fmt.Sprintf(videoCountUrl, cfg.host))
-	listVideoResChan := make(chan *ListVideoRes, total/cfg.pageSize+1)
-	wg := &sync.WaitGroup{}
-	for i := 0; i <= total/cfg.pageSize; i++ {
-		wg.Add(1)
-		offset = cfg.pageSize * i
-		go GetVideos(wg, fmt.Sprintf(videoUrl, cfg.host, cfg.pageSize, offset), listVideoResChan)
+	if cfg.listen != "" {
+		if cfg.watch.Interval == 0 {
+			cfg.watch.Interval = time.Minute
+		}
+		cfg.watch.Metrics = NewMetrics()
+		crawler.OnError = cfg.watch.Metrics.APIError
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", cfg.watch.Metrics.Handler())
+		go func() {
+			log.Printf("metrics 服务监听%s", cfg.listen)
+			if err := http.ListenAndServe(cfg.listen, mux); err != nil {
+				log.Fatalf("metrics 服务启动失败: %v", err)
+			}
+		}()
 	}
+
+	if cfg.watch.Interval > 0 {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := Watch(ctx, crawler, cfg.watch); err != nil {
+			log.Fatalf("监控失败: %v", err)
+		}
+		return
+	}
+
 	log.Println("等待获取所有设备结果")
-	wg.Wait()
-	close(listVideoResChan)
-	for listVideoRes := range listVideoResChan {
-		allVideo = append(allVideo, listVideoRes.Videos...)
+	allVideo, err := crawler.Crawl(context.Background())
+	if err != nil {
+		log.Fatalf("获取解析设备失败: %v", err)
 	}
 	log.Printf("获取到所有的解析设备，解析设备列表大小为%d\n", len(allVideo))
-	countMap := make(map[string]int)
-	detailMap := make(map[string][]string)
-	for _, video := range allVideo {
-		countMap[video.Status] += 1
-		if video.Status == "VIDEO_PROCESSING" || video.Status == "VIDEO_ERROR" || video.Status == "VIDEO_PREPARING" {
-			detailMap[video.Status] = append(detailMap[video.Status], video.Name)
+
+	if cfg.action != "" {
+		os.Exit(remediate(client, allVideo))
+	}
+
+	var statuses []string
+	if cfg.status != "" {
+		statuses = strings.Split(cfg.status, ",")
+	}
+	if err := writeReport(NewReport(allVideo, statuses)); err != nil {
+		log.Fatalf("输出报告失败: %v", err)
+	}
+}
+
+func writeReport(report Report) error {
+	if cfg.format == FormatXLSX {
+		fileName := cfg.output
+		if fileName == "" {
+			fileName = "list_video_" + time.Now().Format("20060102") + ".xlsx"
+		}
+		if err := WriteXLSX(fileName, report); err != nil {
+			return err
+		}
+		log.Printf("报告已写入%s", fileName)
+		return nil
+	}
+
+	out := os.Stdout
+	if cfg.output != "" {
+		file, err := os.Create(cfg.output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	switch cfg.format {
+	case FormatTable:
+		return WriteTable(out, report)
+	case FormatCSV:
+		return WriteCSV(out, report)
+	case FormatJSON:
+		return WriteJSON(out, report)
+	default:
+		return fmt.Errorf("unknown format %q", cfg.format)
+	}
+}
+
+func remediate(client *http.Client, allVideo []Video) int {
+	status := cfg.status
+	if status == "" {
+		status = "VIDEO_ERROR,VIDEO_PREPARING"
+	}
+	videos := NewReport(allVideo, strings.Split(status, ",")).Videos
+	if cfg.fix.StuckFor > 0 {
+		var err error
+		if videos, err = StuckFor(videos, cfg.watch.HistoryFile, cfg.fix.StuckFor); err != nil {
+			log.Printf("读取历史记录失败: %v", err)
+			return 2
 		}
 	}
-	indent, _ := json.MarshalIndent(countMap, "", "\t")
-	log.Println(string(indent))
+	if len(videos) == 0 {
+		log.Printf("没有状态为%s的设备", status)
+		return 0
+	}
+
+	path := cfg.fix.RestartPath
+	if cfg.action == ActionReanalyze {
+		path = cfg.fix.ReanalyzePath
+	}
+	if !cfg.fix.DryRun && !cfg.fix.Yes && !Confirm(os.Stdin, os.Stderr, cfg.action, videos) {
+		log.Println("已取消")
+		return 1
+	}
 
-	indent, _ = json.MarshalIndent(detailMap, "", "\t")
-	log.Println(string(indent))
+	remediator := &Remediator{
+		Client:      client,
+		Method:      cfg.fix.Method,
+		URL:         cfg.api.baseURL(cfg.api.VideoPort) + path,
+		Concurrency: cfg.fix.Concurrency,
+		DryRun:      cfg.fix.DryRun,
+	}
+	results := remediator.Run(context.Background(), videos)
+
+	out := os.Stdout
+	if cfg.output != "" {
+		file, err := os.Create(cfg.output)
+		if err != nil {
+			log.Println(err)
+			return 2
+		}
+		defer file.Close()
+		out = file
+	}
+	failed, err := WriteActionReport(out, results)
+	if err != nil {
+		log.Println(err)
+		return 2
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
 }
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics 解析设备状态的 prometheus 指标
+type Metrics struct {
+	registry       *prometheus.Registry
+	statusCount    *prometheus.GaugeVec
+	videoStatus    *prometheus.GaugeVec
+	scrapeDuration prometheus.Gauge
+	scrapeSuccess  prometheus.Gauge
+	lastScrape     prometheus.Gauge
+	apiErrors      *prometheus.CounterVec
+
+	// 上一次快照的标签，用于删除已经不存在的序列
+	statuses map[string]bool
+	videos   map[[3]string]bool
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		statusCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "shenbei_video_status_count",
+			Help: "Number of cameras in each analysis status.",
+		}, []string{"status"}),
+		videoStatus: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "shenbei_video_status",
+			Help: "Current analysis status of each camera, always 1.",
+		}, []string{"id", "name", "status"}),
+		scrapeDuration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "shenbei_scrape_duration_seconds",
+			Help: "Duration of the last video list scrape.",
+		}),
+		scrapeSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "shenbei_scrape_success",
+			Help: "Whether the last video list scrape succeeded.",
+		}),
+		lastScrape: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "shenbei_last_scrape_timestamp_seconds",
+			Help: "Unix time of the last successful video list scrape.",
+		}),
+		apiErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "shenbei_api_errors_total",
+			Help: "Number of failed platform API requests.",
+		}, []string{"api"}),
+	}
+	m.registry.MustRegister(m.statusCount, m.videoStatus, m.scrapeDuration, m.scrapeSuccess, m.lastScrape, m.apiErrors)
+	return m
+}
+
+// APIError 作为 Crawler.OnError 回调
+func (m *Metrics) APIError(api string, err error) {
+	m.apiErrors.WithLabelValues(api).Inc()
+}
+
+// Observe 用一次完整快照刷新指标，失败时保留上一次的设备状态
+func (m *Metrics) Observe(videos []Video, duration time.Duration, err error) {
+	m.scrapeDuration.Set(duration.Seconds())
+	if err != nil {
+		m.scrapeSuccess.Set(0)
+		return
+	}
+	m.scrapeSuccess.Set(1)
+	m.lastScrape.Set(float64(time.Now().Unix()))
+
+	// 直接设置当前值，再删除设备被删除或改名后残留的标签，避免抓取时看到空值
+	counts := make(map[string]int)
+	current := make(map[[3]string]bool, len(videos))
+	for _, video := range videos {
+		counts[video.Status]++
+		labels := [3]string{video.ID, video.Name, video.Status}
+		current[labels] = true
+		m.videoStatus.WithLabelValues(labels[:]...).Set(1)
+	}
+	for status, count := range counts {
+		m.statusCount.WithLabelValues(status).Set(float64(count))
+	}
+	for status := range m.statuses {
+		if _, ok := counts[status]; !ok {
+			m.statusCount.DeleteLabelValues(status)
+		}
+	}
+	for labels := range m.videos {
+		if !current[labels] {
+			m.videoStatus.DeleteLabelValues(labels[:]...)
+		}
+	}
+	m.statuses = make(map[string]bool, len(counts))
+	for status := range counts {
+		m.statuses[status] = true
+	}
+	m.videos = current
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	srv := httptest.NewServer(m.Handler())
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	m.Observe([]Video{
+		{ID: "1", Name: "gate", Status: "VIDEO_ERROR"},
+		{ID: "2", Name: "lobby", Status: "VIDEO_ERROR"},
+		{ID: "3", Name: "yard", Status: "VIDEO_PROCESSING"},
+	}, 2*time.Second, nil)
+	m.APIError("videos", errors.New("timeout"))
+	m.APIError("videos", errors.New("timeout"))
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		`shenbei_video_status_count{status="VIDEO_ERROR"} 2`,
+		`shenbei_video_status_count{status="VIDEO_PROCESSING"} 1`,
+		`shenbei_video_status{id="1",name="gate",status="VIDEO_ERROR"} 1`,
+		`shenbei_scrape_duration_seconds 2`,
+		`shenbei_scrape_success 1`,
+		`shenbei_api_errors_total{api="videos"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics has no %s:\n%s", want, body)
+		}
+	}
+
+	// 设备恢复或被删除后旧的序列不再输出
+	m.Observe([]Video{
+		{ID: "1", Name: "gate", Status: "VIDEO_PROCESSING"},
+		{ID: "3", Name: "yard", Status: "VIDEO_PROCESSING"},
+	}, time.Second, nil)
+	body = scrape(t, m)
+	for _, stale := range []string{
+		`status="VIDEO_ERROR"`,
+		`id="2"`,
+	} {
+		if strings.Contains(body, stale) {
+			t.Errorf("metrics still has %s:\n%s", stale, body)
+		}
+	}
+	if want := `shenbei_video_status_count{status="VIDEO_PROCESSING"} 2`; !strings.Contains(body, want) {
+		t.Errorf("metrics has no %s:\n%s", want, body)
+	}
+
+	// 抓取失败时保留上一次的设备状态
+	m.Observe(nil, time.Second, errors.New("1 pages failed"))
+	body = scrape(t, m)
+	for _, want := range []string{
+		`shenbei_scrape_success 0`,
+		`shenbei_video_status_count{status="VIDEO_PROCESSING"} 2`,
+		`shenbei_video_status{id="3",name="yard",status="VIDEO_PROCESSING"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics has no %s after failed scrape:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	ActionRestart   = "restart"
+	ActionReanalyze = "reanalyze"
+)
+
+// Remediator 对一批设备并发调用平台的设备控制接口
+type Remediator struct {
+	Client *http.Client
+	Method string
+	// URL 控制接口地址模板，填入转义后的设备 ID
+	URL         string
+	Concurrency int
+	DryRun      bool
+}
+
+type ActionResult struct {
+	Video    Video
+	Status   string
+	Duration time.Duration
+	Err      error
+}
+
+func (r *Remediator) Run(ctx context.Context, videos []Video) []ActionResult {
+	concurrency := r.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	results := make([]ActionResult, len(videos))
+	sem := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+	for i, video := range videos {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, video Video) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			start := time.Now()
+			results[i] = r.do(ctx, video)
+			results[i].Duration = time.Since(start)
+		}(i, video)
+	}
+	wg.Wait()
+	return results
+}
+
+func (r *Remediator) do(ctx context.Context, video Video) ActionResult {
+	result := ActionResult{Video: video}
+	u := fmt.Sprintf(r.URL, url.PathEscape(video.ID))
+	if r.DryRun {
+		result.Status = "dry-run " + r.Method + " " + u
+		return result
+	}
+	req, err := http.NewRequestWithContext(ctx, r.Method, u, nil)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json;charset=UTF-8")
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer resp.Body.Close()
+	result.Status = resp.Status
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		result.Err = fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return result
+}
+
+// Confirm 列出将要操作的设备并等待输入 y 确认
+func Confirm(in io.Reader, out io.Writer, action string, videos []Video) bool {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSTATUS")
+	for _, video := range videos {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", video.ID, video.Name, video.Status)
+	}
+	_ = tw.Flush()
+	fmt.Fprintf(out, "确认对以上%d个设备执行%s? [y/N] ", len(videos), action)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func WriteActionReport(w io.Writer, results []ActionResult) (failed int, err error) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSTATUS\tRESULT\tRESPONSE\tDURATION\tERROR")
+	for _, r := range results {
+		res, errMsg := "ok", ""
+		if r.Err != nil {
+			failed++
+			res, errMsg = "failed", r.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Video.ID, r.Video.Name, r.Video.Status, res, r.Status,
+			r.Duration.Round(time.Millisecond), errMsg)
+	}
+	fmt.Fprintf(tw, "\ntotal %d, success %d, failed %d\n", len(results), len(results)-failed, failed)
+	return failed, tw.Flush()
+}
+
+// StuckFor 根据 -watch 生成的历史记录，只保留当前状态持续超过 d 的设备
+func StuckFor(videos []Video, historyFile string, d time.Duration) ([]Video, error) {
+	history, err := LoadHistory(historyFile)
+	if err != nil {
+		return nil, err
+	}
+	tracker := NewStatusTracker()
+	for _, e := range history {
+		tracker.Apply(e)
+	}
+	now := time.Now()
+	var res []Video
+	for _, video := range videos {
+		prev, ok := tracker.current[video.ID]
+		if ok && prev.Status == video.Status && now.Sub(tracker.since[video.ID]) >= d {
+			res = append(res, video)
+		}
+	}
+	return res, nil
+}
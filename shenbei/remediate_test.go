@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRemediatorRun(t *testing.T) {
+	lock := sync.Mutex{}
+	running, maxRunning := 0, 0
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		paths = append(paths, r.URL.EscapedPath())
+		lock.Unlock()
+		defer func() {
+			lock.Lock()
+			running--
+			lock.Unlock()
+		}()
+
+		if r.Method != "POST" {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		if strings.Contains(r.URL.Path, "bad") {
+			http.Error(w, "camera offline", http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":0}`))
+	}))
+	defer srv.Close()
+
+	videos := []Video{{ID: "1", Status: "VIDEO_ERROR"}, {ID: "a/b c", Status: "VIDEO_ERROR"}, {ID: "bad", Status: "VIDEO_PREPARING"}}
+	r := &Remediator{Client: srv.Client(), Method: "POST", URL: srv.URL + "/v5/videos/%s/restart", Concurrency: 2}
+	results := r.Run(context.Background(), videos)
+
+	if maxRunning > 2 {
+		t.Errorf("max concurrent requests = %d, want <= 2", maxRunning)
+	}
+	if len(paths) != 3 {
+		t.Fatalf("requests = %v, want 3", paths)
+	}
+	want := map[string]bool{"/v5/videos/1/restart": true, "/v5/videos/a%2Fb%20c/restart": true, "/v5/videos/bad/restart": true}
+	for _, p := range paths {
+		if !want[p] {
+			t.Errorf("unexpected path %s", p)
+		}
+	}
+	for i, res := range results {
+		if res.Video.ID != videos[i].ID {
+			t.Errorf("results[%d] is for %s, want %s", i, res.Video.ID, videos[i].ID)
+		}
+		if wantErr := videos[i].ID == "bad"; (res.Err != nil) != wantErr {
+			t.Errorf("results[%d].Err = %v, want error %v", i, res.Err, wantErr)
+		}
+	}
+
+	buf := bytes.Buffer{}
+	failed, err := WriteActionReport(&buf, results)
+	if err != nil || failed != 1 {
+		t.Errorf("WriteActionReport = %d, %v, want 1 failed", failed, err)
+	}
+	if !strings.Contains(buf.String(), "camera offline") {
+		t.Errorf("report has no response body:\n%s", buf.String())
+	}
+}
+
+func TestRemediatorDryRun(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("dry run sent request %s %s", r.Method, r.URL)
+	}))
+	defer srv.Close()
+
+	r := &Remediator{Client: srv.Client(), Method: "POST", URL: srv.URL + "/v5/videos/%s/restart", DryRun: true}
+	results := r.Run(context.Background(), []Video{{ID: "1"}})
+	if results[0].Err != nil || !strings.HasPrefix(results[0].Status, "dry-run POST ") {
+		t.Errorf("result = %+v", results[0])
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	cases := map[string]bool{"y\n": true, "YES\n": true, "n\n": false, "\n": false, "": false}
+	for in, want := range cases {
+		out := bytes.Buffer{}
+		if got := Confirm(strings.NewReader(in), &out, ActionRestart, []Video{{ID: "1"}}); got != want {
+			t.Errorf("Confirm(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	FormatTable = "table"
+	FormatCSV   = "csv"
+	FormatJSON  = "json"
+	FormatXLSX  = "xlsx"
+)
+
+type StatusCount struct {
+	Status string `json:"status"`
+	Count  int    `json:"count"`
+}
+
+// Report 设备状态报告，Summary 按状态名排序
+type Report struct {
+	Summary []StatusCount `json:"summary"`
+	Videos  []Video       `json:"videos"`
+}
+
+// NewReport statuses 为空时保留所有设备
+func NewReport(videos []Video, statuses []string) Report {
+	filter := make(map[string]bool)
+	for _, status := range statuses {
+		filter[strings.ToUpper(strings.TrimSpace(status))] = true
+	}
+	countMap := make(map[string]int)
+	report := Report{Videos: make([]Video, 0)}
+	for _, video := range videos {
+		if len(filter) > 0 && !filter[video.Status] {
+			continue
+		}
+		countMap[video.Status] += 1
+		report.Videos = append(report.Videos, video)
+	}
+	for status, count := range countMap {
+		report.Summary = append(report.Summary, StatusCount{Status: status, Count: count})
+	}
+	sort.Slice(report.Summary, func(i, j int) bool {
+		return report.Summary[i].Status < report.Summary[j].Status
+	})
+	sort.SliceStable(report.Videos, func(i, j int) bool {
+		if report.Videos[i].Status != report.Videos[j].Status {
+			return report.Videos[i].Status < report.Videos[j].Status
+		}
+		return report.Videos[i].Name < report.Videos[j].Name
+	})
+	return report
+}
+
+var detailHeader = []string{"ID", "Name", "URL", "Status"}
+
+func (v Video) row() []string {
+	return []string{v.ID, v.Name, v.Url, v.Status}
+}
+
+func WriteTable(w io.Writer, report Report) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tCOUNT")
+	for _, s := range report.Summary {
+		fmt.Fprintf(tw, "%s\t%d\n", s.Status, s.Count)
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(detailHeader, "\t")))
+	for _, video := range report.Videos {
+		fmt.Fprintln(tw, strings.Join(video.row(), "\t"))
+	}
+	return tw.Flush()
+}
+
+func WriteCSV(w io.Writer, report Report) error {
+	writer := csv.NewWriter(w)
+	_ = writer.Write(detailHeader)
+	for _, video := range report.Videos {
+		_ = writer.Write(video.row())
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func WriteJSON(w io.Writer, report Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "\t")
+	return encoder.Encode(report)
+}
+
+// WriteXLSX 生成包含状态汇总和设备明细两个 sheet 的工作簿
+func WriteXLSX(fileName string, report Report) error {
+	f := excelize.NewFile()
+	summarySheet, detailSheet := "Summary", "Detail"
+	f.SetSheetName("Sheet1", summarySheet)
+	f.NewSheet(detailSheet)
+
+	if err := f.SetSheetRow(summarySheet, "A1", &[]string{"Status", "Count"}); err != nil {
+		return err
+	}
+	for i, s := range report.Summary {
+		if err := f.SetSheetRow(summarySheet, fmt.Sprintf("A%d", i+2), &[]interface{}{s.Status, s.Count}); err != nil {
+			return err
+		}
+	}
+
+	if err := f.SetSheetRow(detailSheet, "A1", &detailHeader); err != nil {
+		return err
+	}
+	for i, video := range report.Videos {
+		row := video.row()
+		if err := f.SetSheetRow(detailSheet, fmt.Sprintf("A%d", i+2), &row); err != nil {
+			return err
+		}
+	}
+	_ = f.SetColWidth(detailSheet, "A", "A", 40)
+	_ = f.SetColWidth(detailSheet, "B", "B", 30)
+	_ = f.SetColWidth(detailSheet, "C", "C", 60)
+	_ = f.SetColWidth(detailSheet, "D", "D", 20)
+	f.SetActiveSheet(0)
+	return f.SaveAs(fileName)
+}
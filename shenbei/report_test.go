@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+var reportVideos = []Video{
+	{ID: "3", Name: "gate", Url: "rtsp://10.0.0.3/live", Status: "VIDEO_PROCESSING"},
+	{ID: "1", Name: "lobby", Url: "rtsp://10.0.0.1/live", Status: "VIDEO_ERROR"},
+	{ID: "2", Name: "exit, north", Url: "rtsp://10.0.0.2/live", Status: "VIDEO_ERROR"},
+	{ID: "4", Name: "yard", Url: "rtsp://10.0.0.4/live", Status: "VIDEO_PREPARING"},
+}
+
+func TestNewReport(t *testing.T) {
+	tests := []struct {
+		statuses []string
+		summary  []StatusCount
+		ids      []string
+	}{
+		{
+			summary: []StatusCount{{"VIDEO_ERROR", 2}, {"VIDEO_PREPARING", 1}, {"VIDEO_PROCESSING", 1}},
+			ids:     []string{"2", "1", "4", "3"},
+		},
+		{
+			// 状态过滤忽略大小写和空格
+			statuses: []string{"video_error", " VIDEO_PREPARING "},
+			summary:  []StatusCount{{"VIDEO_ERROR", 2}, {"VIDEO_PREPARING", 1}},
+			ids:      []string{"2", "1", "4"},
+		},
+		{
+			statuses: []string{"VIDEO_STOPPED"},
+			ids:      []string{},
+		},
+	}
+	for _, tt := range tests {
+		report := NewReport(reportVideos, tt.statuses)
+		if !reflect.DeepEqual(report.Summary, tt.summary) {
+			t.Errorf("NewReport(%v).Summary = %v, want %v", tt.statuses, report.Summary, tt.summary)
+		}
+		ids := []string{}
+		for _, v := range report.Videos {
+			ids = append(ids, v.ID)
+		}
+		if !reflect.DeepEqual(ids, tt.ids) {
+			t.Errorf("NewReport(%v).Videos = %v, want %v", tt.statuses, ids, tt.ids)
+		}
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	buf := bytes.Buffer{}
+	if err := WriteTable(&buf, NewReport(reportVideos, []string{"VIDEO_ERROR"})); err != nil {
+		t.Fatal(err)
+	}
+	// 空行之后明细表单独对齐
+	want := `STATUS       COUNT
+VIDEO_ERROR  2
+
+ID  NAME         URL                   STATUS
+2   exit, north  rtsp://10.0.0.2/live  VIDEO_ERROR
+1   lobby        rtsp://10.0.0.1/live  VIDEO_ERROR
+`
+	if buf.String() != want {
+		t.Errorf("WriteTable =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	buf := bytes.Buffer{}
+	if err := WriteCSV(&buf, NewReport(reportVideos, []string{"VIDEO_ERROR"})); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"ID", "Name", "URL", "Status"},
+		{"2", "exit, north", "rtsp://10.0.0.2/live", "VIDEO_ERROR"},
+		{"1", "lobby", "rtsp://10.0.0.1/live", "VIDEO_ERROR"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("WriteCSV = %v, want %v", rows, want)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	report := NewReport(reportVideos, nil)
+	buf := bytes.Buffer{}
+	if err := WriteJSON(&buf, report); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"summary": [`) || !strings.Contains(buf.String(), `"url": "rtsp://10.0.0.1/live"`) {
+		t.Errorf("WriteJSON field names changed:\n%s", buf.String())
+	}
+	var got Report
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, report) {
+		t.Errorf("WriteJSON round trip = %+v, want %+v", got, report)
+	}
+
+	// 过滤后没有设备时输出空数组而不是 null
+	buf.Reset()
+	if err := WriteJSON(&buf, NewReport(reportVideos, []string{"VIDEO_STOPPED"})); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"videos": []`) {
+		t.Errorf("WriteJSON of empty report:\n%s", buf.String())
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "report.xlsx")
+	if err := WriteXLSX(fileName, NewReport(reportVideos, nil)); err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sheets := f.GetSheetList(); !reflect.DeepEqual(sheets, []string{"Summary", "Detail"}) {
+		t.Errorf("sheets = %v, want [Summary Detail]", sheets)
+	}
+	summary, err := f.GetRows("Summary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSummary := [][]string{{"Status", "Count"}, {"VIDEO_ERROR", "2"}, {"VIDEO_PREPARING", "1"}, {"VIDEO_PROCESSING", "1"}}
+	if !reflect.DeepEqual(summary, wantSummary) {
+		t.Errorf("Summary = %v, want %v", summary, wantSummary)
+	}
+	detail, err := f.GetRows("Detail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(detail) != 5 || !reflect.DeepEqual(detail[0], detailHeader) ||
+		!reflect.DeepEqual(detail[1], []string{"2", "exit, north", "rtsp://10.0.0.2/live", "VIDEO_ERROR"}) {
+		t.Errorf("Detail = %v", detail)
+	}
+}
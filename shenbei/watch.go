@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+// StatusEvent 设备状态变化，From 为空表示新增设备，To 为空表示设备被删除
+type StatusEvent struct {
+	Time time.Time `json:"time"`
+	ID   string    `json:"id"`
+	Name string    `json:"name"`
+	From string    `json:"from"`
+	To   string    `json:"to"`
+}
+
+// StatusTracker 保存上一次快照以及每个设备的状态持续时间和变化记录
+type StatusTracker struct {
+	current map[string]Video
+	since   map[string]time.Time
+	changes map[string][]time.Time
+}
+
+type StatusDuration struct {
+	Video    Video
+	Since    time.Time
+	Duration time.Duration
+}
+
+func NewStatusTracker() *StatusTracker {
+	return &StatusTracker{
+		current: make(map[string]Video),
+		since:   make(map[string]time.Time),
+		changes: make(map[string][]time.Time),
+	}
+}
+
+// Apply 根据一条历史事件更新状态
+func (t *StatusTracker) Apply(e StatusEvent) {
+	if e.To == "" {
+		delete(t.current, e.ID)
+		delete(t.since, e.ID)
+		delete(t.changes, e.ID)
+		return
+	}
+	video := t.current[e.ID]
+	video.ID, video.Name, video.Status = e.ID, e.Name, e.To
+	t.current[e.ID] = video
+	t.since[e.ID] = e.Time
+	if e.From != "" {
+		t.changes[e.ID] = append(t.changes[e.ID], e.Time)
+	}
+}
+
+// Update 与上一次快照比较，返回状态变化事件
+func (t *StatusTracker) Update(videos []Video, now time.Time) []StatusEvent {
+	var events []StatusEvent
+	seen := make(map[string]bool, len(videos))
+	for _, video := range videos {
+		seen[video.ID] = true
+		prev, ok := t.current[video.ID]
+		if !ok || prev.Status != video.Status {
+			events = append(events, StatusEvent{Time: now, ID: video.ID, Name: video.Name, From: prev.Status, To: video.Status})
+		}
+	}
+	for id, prev := range t.current {
+		if !seen[id] {
+			events = append(events, StatusEvent{Time: now, ID: id, Name: prev.Name, From: prev.Status})
+		}
+	}
+	for _, e := range events {
+		t.Apply(e)
+	}
+	// 快照里的 url 等字段以最新为准
+	for _, video := range videos {
+		t.current[video.ID] = video
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events
+}
+
+// InStatus 返回处于 status 的设备及持续时间，持续时间长的在前
+func (t *StatusTracker) InStatus(status string, now time.Time) []StatusDuration {
+	var res []StatusDuration
+	for id, video := range t.current {
+		if video.Status == status {
+			res = append(res, StatusDuration{Video: video, Since: t.since[id], Duration: now.Sub(t.since[id])})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Duration > res[j].Duration })
+	return res
+}
+
+// Flapping 返回 window 内状态变化次数不少于 minChanges 的设备，同时丢弃 window 之外的变化记录，
+// 避免长时间运行时内存持续增长
+func (t *StatusTracker) Flapping(window time.Duration, minChanges int, now time.Time) map[string]int {
+	res := make(map[string]int)
+	for id, changes := range t.changes {
+		kept := changes[:0]
+		for _, c := range changes {
+			if now.Sub(c) <= window {
+				kept = append(kept, c)
+			}
+		}
+		if len(kept) == 0 {
+			delete(t.changes, id)
+			continue
+		}
+		t.changes[id] = kept
+		if len(kept) >= minChanges {
+			res[id] = len(kept)
+		}
+	}
+	return res
+}
+
+// LoadHistory 读取 json lines 格式的历史事件文件，文件不存在时返回空
+func LoadHistory(fileName string) ([]StatusEvent, error) {
+	file, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var events []StatusEvent
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e StatusEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			log.Printf("忽略无法解析的历史记录: %s", scanner.Text())
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+func AppendHistory(fileName string, events []StatusEvent) error {
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, e := range events {
+		if err := encoder.Encode(e); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// WatchConfig 持续监控的参数
+type WatchConfig struct {
+	Interval    time.Duration
+	HistoryFile string
+	FlapWindow  time.Duration
+	FlapCount   int
+	// Metrics 不为空时每次轮询后刷新 prometheus 指标
+	Metrics *Metrics
+}
+
+// Watch 按 interval 轮询设备列表，输出状态变化、故障持续时间和抖动设备，直到 ctx 结束
+func Watch(ctx context.Context, crawler *Crawler, config WatchConfig) error {
+	tracker := NewStatusTracker()
+	history, err := LoadHistory(config.HistoryFile)
+	if err != nil {
+		return err
+	}
+	for _, e := range history {
+		tracker.Apply(e)
+	}
+	log.Printf("从%s加载%d条历史记录", config.HistoryFile, len(history))
+
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+	for {
+		watchOnce(ctx, crawler, tracker, config)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func watchOnce(ctx context.Context, crawler *Crawler, tracker *StatusTracker, config WatchConfig) {
+	start := time.Now()
+	videos, err := crawler.Crawl(ctx)
+	if config.Metrics != nil {
+		config.Metrics.Observe(videos, time.Since(start), err)
+	}
+	if err != nil {
+		// 快照不完整时不做比较，避免误报设备被删除
+		log.Printf("获取解析设备失败，跳过本次比较: %v", err)
+		return
+	}
+	now := time.Now()
+	events := tracker.Update(videos, now)
+	for _, e := range events {
+		log.Printf("设备状态变化 id=%s name=%s %s -> %s", e.ID, e.Name, displayStatus(e.From), displayStatus(e.To))
+	}
+	if err := AppendHistory(config.HistoryFile, events); err != nil {
+		log.Printf("写入历史记录失败: %v", err)
+	}
+
+	for _, d := range tracker.InStatus("VIDEO_ERROR", now) {
+		log.Printf("设备 id=%s name=%s 已处于 VIDEO_ERROR %s (自 %s)", d.Video.ID, d.Video.Name,
+			d.Duration.Round(time.Second), d.Since.Format("2006-01-02 15:04:05"))
+	}
+	for id, count := range tracker.Flapping(config.FlapWindow, config.FlapCount, now) {
+		log.Printf("设备 id=%s name=%s 在%s内状态变化%d次", id, tracker.current[id].Name, config.FlapWindow, count)
+	}
+}
+
+func displayStatus(status string) string {
+	if status == "" {
+		return "-"
+	}
+	return status
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStatusTracker(t *testing.T) {
+	start := time.Date(2021, 9, 1, 8, 0, 0, 0, time.Local)
+	tracker := NewStatusTracker()
+
+	snapshots := []struct {
+		videos []Video
+		events []StatusEvent
+	}{
+		{
+			videos: []Video{{ID: "1", Name: "gate", Status: "VIDEO_PROCESSING"}, {ID: "2", Name: "lobby", Status: "VIDEO_PROCESSING"}},
+			events: []StatusEvent{{ID: "1", Name: "gate", To: "VIDEO_PROCESSING"}, {ID: "2", Name: "lobby", To: "VIDEO_PROCESSING"}},
+		},
+		{
+			videos: []Video{{ID: "1", Name: "gate", Status: "VIDEO_ERROR"}, {ID: "2", Name: "lobby", Status: "VIDEO_PROCESSING"}},
+			events: []StatusEvent{{ID: "1", Name: "gate", From: "VIDEO_PROCESSING", To: "VIDEO_ERROR"}},
+		},
+		// 只有 url 变化不算状态变化
+		{
+			videos: []Video{{ID: "1", Name: "gate", Status: "VIDEO_ERROR", Url: "rtsp://new"}, {ID: "2", Name: "lobby", Status: "VIDEO_PROCESSING"}},
+		},
+		{
+			videos: []Video{{ID: "1", Name: "gate", Status: "VIDEO_PROCESSING"}},
+			events: []StatusEvent{{ID: "1", Name: "gate", From: "VIDEO_ERROR", To: "VIDEO_PROCESSING"}, {ID: "2", Name: "lobby", From: "VIDEO_PROCESSING"}},
+		},
+		{
+			videos: []Video{{ID: "1", Name: "gate", Status: "VIDEO_ERROR"}},
+			events: []StatusEvent{{ID: "1", Name: "gate", From: "VIDEO_PROCESSING", To: "VIDEO_ERROR"}},
+		},
+	}
+	for i, s := range snapshots {
+		now := start.Add(time.Duration(i) * 10 * time.Minute)
+		for j := range s.events {
+			s.events[j].Time = now
+		}
+		if events := tracker.Update(s.videos, now); !reflect.DeepEqual(events, s.events) {
+			t.Errorf("snapshot %d: events = %+v, want %+v", i, events, s.events)
+		}
+	}
+
+	now := start.Add(time.Hour)
+	errors := tracker.InStatus("VIDEO_ERROR", now)
+	if len(errors) != 1 || errors[0].Video.ID != "1" || errors[0].Duration != 20*time.Minute {
+		t.Errorf("InStatus = %+v, want camera 1 for 20m", errors)
+	}
+
+	// 三次状态变化分别在 10、30、40 分钟
+	if got := tracker.Flapping(time.Hour, 3, now); !reflect.DeepEqual(got, map[string]int{"1": 3}) {
+		t.Errorf("Flapping(1h) = %v, want 1: 3", got)
+	}
+	if got := tracker.Flapping(30*time.Minute, 2, now); !reflect.DeepEqual(got, map[string]int{"1": 2}) {
+		t.Errorf("Flapping(30m) = %v, want 1: 2", got)
+	}
+	// 窗口外的记录已经被丢弃，放大窗口也不会再出现
+	if got := tracker.Flapping(time.Hour, 3, now); len(got) != 0 {
+		t.Errorf("Flapping after prune = %v, want none", got)
+	}
+	if got := tracker.Flapping(time.Minute, 1, now); len(got) != 0 || len(tracker.changes) != 0 {
+		t.Errorf("Flapping(1m) = %v, %d cameras kept, want none", got, len(tracker.changes))
+	}
+}
+
+func TestHistory(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "history.jsonl")
+	if events, err := LoadHistory(fileName); err != nil || events != nil {
+		t.Fatalf("LoadHistory of missing file = %v, %v, want nil", events, err)
+	}
+
+	now := time.Date(2021, 9, 1, 8, 0, 0, 0, time.UTC)
+	first := []StatusEvent{{Time: now, ID: "1", Name: "gate", To: "VIDEO_PROCESSING"}}
+	second := []StatusEvent{{Time: now.Add(time.Minute), ID: "1", Name: "gate", From: "VIDEO_PROCESSING", To: "VIDEO_ERROR"}}
+	if err := AppendHistory(fileName, first); err != nil {
+		t.Fatal(err)
+	}
+	// 手工编辑留下的坏行被跳过
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = file.WriteString("not json\n")
+	_ = file.Close()
+	if err := AppendHistory(fileName, second); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := LoadHistory(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := append(first, second...); !reflect.DeepEqual(events, want) {
+		t.Errorf("LoadHistory = %+v, want %+v", events, want)
+	}
+
+	// 重放历史后状态持续时间从第一次进入该状态算起
+	tracker := NewStatusTracker()
+	for _, e := range events {
+		tracker.Apply(e)
+	}
+	tracker.Update([]Video{{ID: "1", Name: "gate", Status: "VIDEO_ERROR"}}, now.Add(time.Hour))
+	errors := tracker.InStatus("VIDEO_ERROR", now.Add(time.Hour))
+	if len(errors) != 1 || errors[0].Duration != 59*time.Minute {
+		t.Errorf("InStatus after replay = %+v, want 59m", errors)
+	}
+}
+
+func TestWatchOnce(t *testing.T) {
+	vs := newVideoServer(2, []Video{{ID: "1", Name: "gate", Status: "VIDEO_ERROR"}, {ID: "2", Name: "lobby", Status: "VIDEO_PROCESSING"}})
+	srv := httptest.NewServer(vs)
+	defer srv.Close()
+	crawler, _ := newTestCrawler(srv, 10, 0)
+
+	historyFile := filepath.Join(t.TempDir(), "history.jsonl")
+	config := WatchConfig{Interval: time.Hour, HistoryFile: historyFile, FlapWindow: time.Hour, FlapCount: 3, Metrics: NewMetrics()}
+	tracker := NewStatusTracker()
+	ctx := context.Background()
+	watchOnce(ctx, crawler, tracker, config)
+	events, err := LoadHistory(historyFile)
+	if err != nil || len(events) != 2 {
+		t.Fatalf("history = %+v, %v, want 2 events", events, err)
+	}
+
+	// 快照不完整时不做比较，避免误报设备被删除
+	vs.total, vs.videos = 3, vs.videos[:1]
+	watchOnce(ctx, crawler, tracker, config)
+	if events, _ := LoadHistory(historyFile); len(events) != 2 {
+		t.Errorf("history after failed scrape = %+v, want 2 events", events)
+	}
+
+	// 重复轮询没有变化时不写历史
+	vs.total, vs.videos = 2, []Video{{ID: "1", Name: "gate", Status: "VIDEO_ERROR"}, {ID: "2", Name: "lobby", Status: "VIDEO_PROCESSING"}}
+	watchOnce(ctx, crawler, tracker, config)
+	if events, _ := LoadHistory(historyFile); len(events) != 2 {
+		t.Errorf("history after unchanged scrape = %+v, want 2 events", events)
+	}
+
+	// Watch 重放历史，ctx 结束后返回
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := Watch(ctx, crawler, config); err != nil {
+		t.Fatal(err)
+	}
+	if events, _ := LoadHistory(historyFile); len(events) != 2 {
+		t.Errorf("history after Watch = %+v, want no new events", events)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"go-web-study/anddrive"
+	"go-web-study/geofence"
+	"go-web-study/storage"
+
+	"github.com/spf13/viper"
+)
+
+// TerminalConfig 单个车载终端的配置
+type TerminalConfig struct {
+	ID               string        `json:"id" mapstructure:"id"`
+	CameraType       string        `json:"cameraType" mapstructure:"camera_type"`
+	StreamMode       int           `json:"streamMode" mapstructure:"stream_mode"`
+	LocationInterval time.Duration `json:"locationInterval" mapstructure:"location_interval"`
+	ContinueInterval time.Duration `json:"continueInterval" mapstructure:"continue_interval"`
+}
+
+type Config struct {
+	BaseURL      string `json:"baseURL" mapstructure:"base_url"`
+	SignatureKey string `json:"signatureKey" mapstructure:"signature_key"`
+	// RateLimit 所有终端共享的每秒请求数，0 表示不限制
+	RateLimit   float64          `json:"rateLimit" mapstructure:"rate_limit"`
+	MaxFailures int              `json:"maxFailures" mapstructure:"max_failures"`
+	Timeout     time.Duration    `json:"timeout" mapstructure:"timeout"`
+	Health      string           `json:"health" mapstructure:"health"`
+	Terminals   []TerminalConfig `json:"terminals" mapstructure:"terminals"`
+	Geofences   []geofence.Fence `json:"geofences" mapstructure:"geofences"`
+	// Webhook 进出围栏事件推送地址，为空时只写入数据库
+	Webhook  string         `json:"webhook" mapstructure:"webhook"`
+	Database storage.Config `json:"database" mapstructure:"database"`
+}
+
+// LoadConfig 读取配置文件，overrides 中非空的值(例如命令行参数)优先于配置文件和环境变量
+func LoadConfig(fileName string, overrides map[string]string) (Config, error) {
+	v := viper.New()
+	v.SetConfigFile(fileName)
+	v.SetDefault("base_url", anddrive.DefaultBaseURL)
+	// 签名密钥也可以通过环境变量 ANDDRIVE_SIGNATURE_KEY 传入
+	_ = v.BindEnv("signature_key", "ANDDRIVE_SIGNATURE_KEY")
+	v.SetDefault("max_failures", 5)
+	v.SetDefault("timeout", 10*time.Second)
+	v.SetDefault("health", ":8090")
+	// 数据库地址也可以通过环境变量 DATABASE_URL 传入
+	_ = v.BindEnv("database.dsn", "DATABASE_URL")
+	v.SetDefault("database.max_open_conns", 100)
+	v.SetDefault("database.max_idle_conns", 20)
+	config := Config{}
+	if err := v.ReadInConfig(); err != nil {
+		return config, err
+	}
+	for k, value := range overrides {
+		if value != "" {
+			v.Set(k, value)
+		}
+	}
+	if err := v.Unmarshal(&config); err != nil {
+		return config, err
+	}
+	if config.SignatureKey == "" {
+		return config, fmt.Errorf("signature_key is not configured, set ANDDRIVE_SIGNATURE_KEY or -signature-key")
+	}
+	if config.Database.DSN == "" {
+		return config, fmt.Errorf("database.dsn is not configured, set DATABASE_URL or -dsn")
+	}
+	if config.RateLimit < 0 {
+		return config, fmt.Errorf("rate_limit %v must not be negative", config.RateLimit)
+	}
+	if config.MaxFailures <= 0 {
+		return config, fmt.Errorf("max_failures %d must be positive", config.MaxFailures)
+	}
+	if config.Timeout <= 0 {
+		return config, fmt.Errorf("timeout %s must be positive", config.Timeout)
+	}
+	if len(config.Terminals) == 0 {
+		return config, fmt.Errorf("no terminal configured in [%s]", fileName)
+	}
+	seen := make(map[string]bool, len(config.Terminals))
+	for i := range config.Terminals {
+		t := &config.Terminals[i]
+		if t.ID == "" {
+			return config, fmt.Errorf("terminal %d has no id", i+1)
+		}
+		// 同一终端配置两次会重复开流并写入重复定位
+		if seen[t.ID] {
+			return config, fmt.Errorf("terminal %s is configured more than once", t.ID)
+		}
+		seen[t.ID] = true
+		if t.LocationInterval < 0 || t.ContinueInterval < 0 {
+			return config, fmt.Errorf("terminal %s has a negative polling interval", t.ID)
+		}
+		if t.CameraType == "" {
+			t.CameraType = "FRONT"
+		}
+		if t.LocationInterval == 0 {
+			t.LocationInterval = time.Second
+		}
+		if t.ContinueInterval == 0 {
+			t.ContinueInterval = time.Minute
+		}
+	}
+	return config, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-web-study/anddrive"
+)
+
+// setenv 设置环境变量并在测试结束后恢复
+func setenv(t *testing.T, key, value string) {
+	old, ok := os.LookupEnv(key)
+	if value == "" {
+		_ = os.Unsetenv(key)
+	} else {
+		_ = os.Setenv(key, value)
+	}
+	t.Cleanup(func() {
+		if ok {
+			_ = os.Setenv(key, old)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+	})
+}
+
+func TestLoadSampleConfig(t *testing.T) {
+	setenv(t, "ANDDRIVE_SIGNATURE_KEY", "env-key")
+	setenv(t, "DATABASE_URL", "sqlite:///tmp/gps.db")
+
+	config, err := LoadConfig("shenyang.yaml", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.BaseURL != anddrive.DefaultBaseURL || config.SignatureKey != "env-key" || config.Database.DSN != "sqlite:///tmp/gps.db" {
+		t.Errorf("config = %+v", config)
+	}
+	if config.RateLimit != 5 || config.MaxFailures != 5 || config.Timeout != 10*time.Second || config.Health != ":8090" {
+		t.Errorf("config = %+v", config)
+	}
+	if config.Database.MaxOpenConns != 100 || config.Database.ConnMaxLifetime != time.Hour {
+		t.Errorf("database = %+v", config.Database)
+	}
+	want := TerminalConfig{ID: "860404040006697", CameraType: "FRONT", LocationInterval: time.Second, ContinueInterval: time.Minute}
+	if len(config.Terminals) != 1 || config.Terminals[0] != want {
+		t.Errorf("terminals = %+v, want %+v", config.Terminals, want)
+	}
+	if len(config.Geofences) != 2 || config.Geofences[1].Radius != 100 {
+		t.Errorf("geofences = %+v", config.Geofences)
+	}
+
+	// 命令行参数优先于环境变量，空值不覆盖
+	config, err = LoadConfig("shenyang.yaml", map[string]string{"signature_key": "flag-key", "database.dsn": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.SignatureKey != "flag-key" || config.Database.DSN != "sqlite:///tmp/gps.db" {
+		t.Errorf("overrides: signature_key %q, dsn %q", config.SignatureKey, config.Database.DSN)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	setenv(t, "ANDDRIVE_SIGNATURE_KEY", "")
+	setenv(t, "DATABASE_URL", "")
+	const base = `
+signature_key: 'key'
+database:
+  dsn: 'sqlite:///tmp/gps.db'
+`
+	tests := []struct {
+		name string
+		yaml string
+		err  string
+	}{
+		{name: "defaults", yaml: base + "terminals:\n  - id: 'a'\n"},
+		{name: "no signature key", yaml: "database:\n  dsn: 'sqlite:///tmp/gps.db'\nterminals:\n  - id: 'a'\n", err: "signature_key is not configured"},
+		{name: "no dsn", yaml: "signature_key: 'key'\nterminals:\n  - id: 'a'\n", err: "database.dsn is not configured"},
+		{name: "no terminal", yaml: base, err: "no terminal configured"},
+		{name: "terminal without id", yaml: base + "terminals:\n  - camera_type: 'FRONT'\n", err: "terminal 1 has no id"},
+		{name: "duplicate terminal", yaml: base + "terminals:\n  - id: 'a'\n  - id: 'a'\n", err: "configured more than once"},
+		{name: "negative interval", yaml: base + "terminals:\n  - id: 'a'\n    location_interval: -1s\n", err: "negative polling interval"},
+		{name: "bad duration", yaml: base + "terminals:\n  - id: 'a'\n    continue_interval: 'soon'\n", err: "continue_interval"},
+		{name: "negative rate limit", yaml: base + "rate_limit: -1\nterminals:\n  - id: 'a'\n", err: "rate_limit"},
+		{name: "zero max failures", yaml: base + "max_failures: 0\nterminals:\n  - id: 'a'\n", err: "max_failures"},
+		{name: "zero timeout", yaml: base + "timeout: 0s\nterminals:\n  - id: 'a'\n", err: "timeout"},
+		{name: "invalid yaml", yaml: base + "terminals: [", err: "yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "shenyang.yaml")
+			if err := ioutil.WriteFile(fileName, []byte(tt.yaml), 0600); err != nil {
+				t.Fatal(err)
+			}
+			config, err := LoadConfig(fileName, nil)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("LoadConfig error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := TerminalConfig{ID: "a", CameraType: "FRONT", LocationInterval: time.Second, ContinueInterval: time.Minute}
+			if config.MaxFailures != 5 || config.Timeout != 10*time.Second || config.Terminals[0] != want {
+				t.Errorf("config = %+v", config)
+			}
+		})
+	}
+}
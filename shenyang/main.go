@@ -1,198 +1,127 @@
 package main
 
 import (
-	"bytes"
-	"crypto/sha1"
-	"encoding/base64"
-	"encoding/hex"
-	"encoding/json"
-	"fmt"
-	"github.com/suifengtec/gocoord"
-	"gorm.io/driver/mysql"
+	"context"
+	"flag"
+	"go-web-study/anddrive"
+	"go-web-study/coord"
+	"go-web-study/geofence"
+	"go-web-study/gpslog"
+	"go-web-study/storage"
 	"gorm.io/gorm"
-	"io/ioutil"
+	"log"
 	"net/http"
-	"strconv"
-	"time"
-)
-
-type ReqBody struct {
-	Data      string `json:"data"`
-	Sign      string `json:"sign"`
-	Timestamp int64  `json:"timestamp"`
-}
-
-type MonitorStartParam struct {
-	CameraType string `json:"cameraType"`
-	StreamMode int    `json:"streamMode"`
-}
-
-type GPS struct {
-	Longitude   float64 `json:"longitude" gorm:"type:varchar(20) column:longitude"`
-	LongitudeBD float64 `gorm:"type:varchar(20) column:longitudeBD"`
-	Latitude    float64 `json:"latitude" gorm:"type:varchar(20) column:latitude"`
-	LatitudeBD  float64 `gorm:"type:varchar(20) column:latitudeBD"`
-	GpsTime     int64   `json:"gpsTime" gorm:"type:bigint column:gps_time"`
-}
-
-func (g GPS) TableName() string {
-	return "tb_gps_log"
-}
-
-func SHA1(s string) string {
-	h := sha1.New()
-	h.Write([]byte(s))
-	return hex.EncodeToString(h.Sum(nil))
-}
-
-func sign(reqBody string, time int64, signatureKey string) string {
-	str := base64.StdEncoding.EncodeToString([]byte(reqBody)) + strconv.FormatInt(time, 10) + signatureKey
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
-	return SHA1(str)
-}
-
-var _db *gorm.DB
-
-func init() {
-	username := "root"
-	password := "5zgmvzXY3fY"
-	host := "10.122.100.146"
-	port := 3306
-	Dbname := "test"
-	timeout := "100s"
+	"golang.org/x/time/rate"
+)
 
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8&parseTime=True&loc=Local&timeout=%s", username, password, host, port, Dbname, timeout)
-	var err error
-	_db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
-	if err != nil {
-		panic("连接数据库失败, error=" + err.Error())
-	}
-	sqlDB, _ := _db.DB()
-	sqlDB.SetMaxOpenConns(100)
-	sqlDB.SetMaxIdleConns(20)
-}
+var (
+	_db   *gorm.DB
+	store *gpslog.Store
+)
 
 func GetDB() *gorm.DB {
 	return _db
 }
 
 func main() {
-	unixTime := time.Now().UnixNano() / 1e6
-	startURL := "https://portal.anddrive.cn/api/v0/thirdpart/terminals/860404040006697/monitor-start"
-	continueURL := "https://portal.anddrive.cn/api/v0/thirdpart/terminals/860404040006697/monitor-continue"
-	LocationURL := "https://portal.anddrive.cn/api/v0/thirdpart/terminals/860404040006697/realtime?timestamp=%d&sign=%s"
-	headMap := map[string]string{
-		"Content-Type": "application/json;charset=UTF-8",
-		"sysCode":      "30007",
-		"from":         "OTHER",
-		"msgId":        strconv.FormatInt(unixTime, 10),
-	}
+	configFile := flag.String("config", "shenyang/shenyang.yaml", "terminal config file")
+	signatureKey := flag.String("signature-key", "", "anddrive signature key, default from config or ANDDRIVE_SIGNATURE_KEY")
+	dsn := flag.String("dsn", "", "database url, default from config or DATABASE_URL")
+	flag.Parse()
 
-	MonitorStart(unixTime, startURL, headMap)
-
-	go func() {
-		for {
-			GetLocation(unixTime, LocationURL)
-			time.Sleep(1 * time.Second)
+	config, err := LoadConfig(*configFile, map[string]string{"signature_key": *signatureKey, "database.dsn": *dsn})
+	if err != nil {
+		log.Fatalf("读取配置文件失败 %v", err)
+	}
+	_db = storage.MustOpen(config.Database)
+	store = gpslog.NewStore(_db)
+	if err := gpslog.Migrate(GetDB()); err != nil {
+		log.Fatalf("数据库迁移失败 %v", err)
+	}
+	if err := geofence.Migrate(GetDB()); err != nil {
+		log.Fatalf("数据库迁移失败 %v", err)
+	}
+	var monitor *geofence.Monitor
+	if len(config.Geofences) > 0 {
+		if monitor, err = geofence.NewMonitor(config.Geofences); err != nil {
+			log.Fatalf("围栏配置错误 %v", err)
 		}
-	}()
-
-	go func() {
-		for {
-			unixTime = time.Now().UnixNano() / 1e6
-			headMap["msgId"] = strconv.FormatInt(unixTime, 10)
-			MonitorContinue(unixTime, continueURL, headMap)
-			time.Sleep(1 * time.Minute)
+		// 从最近的事件恢复终端在围栏内外的状态
+		events, err := geofence.LatestEvents(context.Background(), GetDB())
+		if err != nil {
+			log.Fatalf("读取围栏事件失败 %v", err)
 		}
-	}()
-
-	time.Sleep(time.Hour * 24)
-
-}
-
-func MonitorContinue(unixTime int64, continueURL string, headMap map[string]string) {
-	param := make(map[string]interface{})
-	paramJson, err := json.Marshal(param)
-	signStr := sign(string(paramJson), unixTime, "I51#H!44uR3")
-	reqBody := ReqBody{
-		Data:      base64.StdEncoding.EncodeToString(paramJson),
-		Sign:      signStr,
-		Timestamp: unixTime,
-	}
-	reqBodyJson, _ := json.Marshal(reqBody)
-	req, _ := http.NewRequest("POST", continueURL, bytes.NewBuffer(reqBodyJson))
-	for k, v := range headMap {
-		req.Header.Set(k, v)
+		monitor.Restore(events)
 	}
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		panic(err)
+	var notifier *geofence.Notifier
+	if config.Webhook != "" {
+		notifier = geofence.NewNotifier(config.Webhook, &http.Client{}, 1000)
+		notifier.Timeout = config.Timeout
+		notifier.OnError = func(event geofence.Event, err error) {
+			log.Printf("推送终端%s围栏%s事件失败: %v", event.TerminalID, event.Fence, err)
+		}
 	}
-	defer resp.Body.Close()
-	fmt.Println("续期 Status:", resp.Status)
 
-}
-
-func GetLocation(unixTime int64, url string) {
-	headMap := map[string]string{
-		"sysCode": "30007",
-		"from":    "OTHER",
-		"msgId":   strconv.FormatInt(unixTime, 10),
-	}
-	signStr := sign("", unixTime, "I51#H!44uR3")
-	req, _ := http.NewRequest("GET", fmt.Sprintf(url, unixTime, signStr), nil)
-	for k, v := range headMap {
-		req.Header.Set(k, v)
+	var limiter *rate.Limiter
+	if config.RateLimit > 0 {
+		limiter = rate.NewLimiter(rate.Limit(config.RateLimit), 1)
 	}
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		panic(err)
+	client := anddrive.NewClient(config.SignatureKey, &http.Client{Timeout: config.Timeout})
+	client.BaseURL = config.BaseURL
+	trackers := make([]*Tracker, 0, len(config.Terminals))
+	for _, terminal := range config.Terminals {
+		tracker := NewTracker(terminal, client, limiter, config.MaxFailures)
+		tracker.Geofence = monitor
+		tracker.Notifier = notifier
+		trackers = append(trackers, tracker)
 	}
-	defer resp.Body.Close()
 
-	body, _ := ioutil.ReadAll(resp.Body)
-	gps := GPS{}
-	json.Unmarshal(body, &gps)
-	p := gocoord.Position{Lon: gps.Longitude, Lat: gps.Latitude}
-	bd09 := gocoord.WGS84ToBD09(p)
-	gps.LongitudeBD = bd09.Lon
-	gps.LatitudeBD = bd09.Lat
-	db := GetDB()
-	db.Create(&gps)
-	fmt.Println("gps Status:", resp.Status)
-}
-
-func MonitorStart(unixTime int64, startURL string, headMap map[string]string) {
-	param := MonitorStartParam{
-		CameraType: "FRONT",
-		StreamMode: 0,
+	if config.Health != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/health", HealthHandler(trackers))
+			if err := http.ListenAndServe(config.Health, mux); err != nil {
+				log.Printf("health 服务启动失败: %v", err)
+			}
+		}()
 	}
-	paramJson, err := json.Marshal(param)
-	if err != nil {
-		fmt.Println("error is " + err.Error())
-	}
-	fmt.Println(string(paramJson))
-	signStr := sign(string(paramJson), unixTime, "I51#H!44uR3")
 
-	reqBody := ReqBody{
-		Data:      base64.StdEncoding.EncodeToString(paramJson),
-		Sign:      signStr,
-		Timestamp: unixTime,
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if notifier != nil {
+		go notifier.Run(ctx)
 	}
-	reqBodyJson, _ := json.Marshal(reqBody)
-	req, err := http.NewRequest("POST", startURL, bytes.NewBuffer(reqBodyJson))
-	for k, v := range headMap {
-		req.Header.Set(k, v)
+	wg := sync.WaitGroup{}
+	for _, tracker := range trackers {
+		wg.Add(1)
+		go func(tracker *Tracker) {
+			defer wg.Done()
+			tracker.Run(ctx)
+		}(tracker)
 	}
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	log.Printf("开始跟踪%d个终端", len(trackers))
+	wg.Wait()
+	log.Println("tracker stopped")
+}
+
+// SaveLocation 转换坐标并保存定位
+func SaveLocation(ctx context.Context, terminalID string, location *anddrive.Location) (*gpslog.GPS, error) {
+	p := coord.Point{Lon: location.Longitude, Lat: location.Latitude, Datum: coord.WGS84}
+	gps, err := gpslog.NewGPS(terminalID, p, location.GpsTime)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	defer resp.Body.Close()
+	if err := store.Save(ctx, &gps); err != nil {
+		return nil, err
+	}
+	return &gps, nil
+}
 
-	body, _ := ioutil.ReadAll(resp.Body)
-	fmt.Println("开流 Body:", string(body))
+func SaveEvent(ctx context.Context, event *geofence.Event) error {
+	return store.DB().WithContext(ctx).Create(event).Error
 }
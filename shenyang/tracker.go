@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"go-web-study/anddrive"
+	"go-web-study/geofence"
+	"go-web-study/gpslog"
+
+	"golang.org/x/time/rate"
+)
+
+// Tracker 维护单个终端的开流会话并持续拉取定位，网络异常时退避重试，会话失效时重新开流
+type Tracker struct {
+	Terminal         TerminalConfig
+	LocationInterval time.Duration
+	ContinueInterval time.Duration
+	// MaxFailures 连续失败达到该次数后认为会话失效，重新开流
+	MaxFailures int
+	Client      *anddrive.Client
+	// Limiter 多个终端共享的请求频率限制，可以为空
+	Limiter *rate.Limiter
+	// Geofence 多个终端共享的围栏状态，可以为空
+	Geofence *geofence.Monitor
+	Notifier *geofence.Notifier
+
+	lock   sync.Mutex
+	health Health
+}
+
+// Health 对外暴露的运行状态
+type Health struct {
+	TerminalID          string    `json:"terminalId"`
+	SessionStarted      time.Time `json:"sessionStarted"`
+	SessionRestarts     int       `json:"sessionRestarts"`
+	LastLocation        time.Time `json:"lastLocation"`
+	LastContinue        time.Time `json:"lastContinue"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	LastError           string    `json:"lastError"`
+}
+
+func NewTracker(terminal TerminalConfig, client *anddrive.Client, limiter *rate.Limiter, maxFailures int) *Tracker {
+	return &Tracker{
+		Terminal:         terminal,
+		LocationInterval: terminal.LocationInterval,
+		ContinueInterval: terminal.ContinueInterval,
+		MaxFailures:      maxFailures,
+		Client:           client,
+		Limiter:          limiter,
+		health:           Health{TerminalID: terminal.ID},
+	}
+}
+
+// wait 等待共享限流，ctx 结束时返回错误
+func (t *Tracker) wait(ctx context.Context) error {
+	if t.Limiter == nil {
+		return nil
+	}
+	return t.Limiter.Wait(ctx)
+}
+
+// Run 阻塞运行直到 ctx 结束
+func (t *Tracker) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		if !t.startSession(ctx) {
+			return
+		}
+		sessionCtx, cancel := context.WithCancel(ctx)
+		wg := sync.WaitGroup{}
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			defer cancel()
+			t.loop(sessionCtx, t.LocationInterval, t.pollLocation)
+		}()
+		go func() {
+			defer wg.Done()
+			defer cancel()
+			t.loop(sessionCtx, t.ContinueInterval, t.keepAlive)
+		}()
+		wg.Wait()
+		cancel()
+		if ctx.Err() == nil {
+			log.Printf("终端%s会话失效，重新开流", t.Terminal.ID)
+		}
+	}
+}
+
+// startSession 退避重试 monitor-start，直到成功或 ctx 结束
+func (t *Tracker) startSession(ctx context.Context) bool {
+	backoff := newBackoff(time.Second, time.Minute)
+	param := anddrive.MonitorStartParam{
+		CameraType: t.Terminal.CameraType,
+		StreamMode: t.Terminal.StreamMode,
+	}
+	for {
+		if err := t.wait(ctx); err != nil {
+			return false
+		}
+		err := t.Client.MonitorStart(ctx, t.Terminal.ID, param)
+		t.record(err, func(h *Health) {
+			if !h.SessionStarted.IsZero() {
+				h.SessionRestarts++
+			}
+			h.SessionStarted = time.Now()
+		})
+		if err == nil {
+			return true
+		}
+		log.Printf("终端%s开流失败: %v", t.Terminal.ID, err)
+		if !backoff.Wait(ctx) {
+			return false
+		}
+	}
+}
+
+// loop 周期执行 fn，失败时按退避间隔重试，连续失败 MaxFailures 次后返回以触发重新开流
+func (t *Tracker) loop(ctx context.Context, interval time.Duration, fn func(ctx context.Context) error) {
+	backoff := newBackoff(interval, time.Minute)
+	failures := 0
+	for {
+		if err := fn(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			failures++
+			log.Printf("终端%s请求失败(%d/%d): %v", t.Terminal.ID, failures, t.MaxFailures, err)
+			if failures >= t.MaxFailures {
+				return
+			}
+			if !backoff.Wait(ctx) {
+				return
+			}
+			continue
+		}
+		failures = 0
+		backoff.Reset()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (t *Tracker) pollLocation(ctx context.Context) error {
+	if err := t.wait(ctx); err != nil {
+		return err
+	}
+	location, err := t.Client.Realtime(ctx, t.Terminal.ID)
+	var gps *gpslog.GPS
+	if err == nil {
+		gps, err = SaveLocation(ctx, t.Terminal.ID, location)
+	}
+	t.record(err, func(h *Health) { h.LastLocation = time.Now() })
+	if err == nil {
+		t.checkGeofence(ctx, *gps)
+	}
+	return err
+}
+
+// checkGeofence 保存进出围栏事件并放入推送队列，失败只记录日志，不影响定位
+func (t *Tracker) checkGeofence(ctx context.Context, gps gpslog.GPS) {
+	if t.Geofence == nil {
+		return
+	}
+	for _, event := range t.Geofence.Update(gps) {
+		log.Printf("终端%s%s围栏%s，停留%ds", event.TerminalID, event.Type, event.Fence, event.Dwell)
+		if err := SaveEvent(ctx, &event); err != nil {
+			log.Printf("保存围栏事件失败: %v", err)
+		}
+		if t.Notifier != nil {
+			t.Notifier.Enqueue(event)
+		}
+	}
+}
+
+func (t *Tracker) keepAlive(ctx context.Context) error {
+	if err := t.wait(ctx); err != nil {
+		return err
+	}
+	err := t.Client.MonitorContinue(ctx, t.Terminal.ID)
+	t.record(err, func(h *Health) { h.LastContinue = time.Now() })
+	return err
+}
+
+// record 成功时执行 onSuccess 更新状态
+func (t *Tracker) record(err error, onSuccess func(h *Health)) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err != nil {
+		t.health.ConsecutiveFailures++
+		t.health.LastError = err.Error()
+		return
+	}
+	t.health.ConsecutiveFailures = 0
+	onSuccess(&t.health)
+}
+
+func (t *Tracker) Health() Health {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.health
+}
+
+// Healthy 最近 3 个定位周期内拿到过定位即认为正常
+func (t *Tracker) Healthy() bool {
+	h := t.Health()
+	return !h.LastLocation.IsZero() && time.Since(h.LastLocation) < 3*t.LocationInterval+10*time.Second
+}
+
+// HealthHandler 输出所有终端的状态，任一终端异常时返回 503
+func HealthHandler(trackers []*Tracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		healthy := true
+		res := make([]Health, 0, len(trackers))
+		for _, t := range trackers {
+			healthy = healthy && t.Healthy()
+			res = append(res, t.Health())
+		}
+		w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(res)
+	}
+}
+
+// backoff 指数退避，最长不超过 max
+type backoff struct {
+	min, max, current time.Duration
+}
+
+func newBackoff(min, max time.Duration) *backoff {
+	return &backoff{min: min, max: max, current: min}
+}
+
+func (b *backoff) Reset() {
+	b.current = b.min
+}
+
+// Wait 等待当前退避间隔，ctx 结束时返回 false
+func (b *backoff) Wait(ctx context.Context) bool {
+	timer := time.NewTimer(b.current)
+	defer timer.Stop()
+	b.current *= 2
+	if b.current > b.max {
+		b.current = b.max
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
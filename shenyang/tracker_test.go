@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-web-study/anddrive"
+	"go-web-study/gpslog"
+	"go-web-study/storage"
+)
+
+func TestBackoff(t *testing.T) {
+	ctx := context.Background()
+	b := newBackoff(time.Millisecond, 5*time.Millisecond)
+	var got []time.Duration
+	for i := 0; i < 5; i++ {
+		got = append(got, b.current)
+		if !b.Wait(ctx) {
+			t.Fatal("Wait returned false")
+		}
+	}
+	want := []time.Duration{1, 2, 4, 5, 5}
+	for i := range want {
+		if got[i] != want[i]*time.Millisecond {
+			t.Errorf("backoff %d = %v, want %v", i, got[i], want[i]*time.Millisecond)
+		}
+	}
+	b.Reset()
+	if b.current != time.Millisecond {
+		t.Errorf("after Reset = %v, want 1ms", b.current)
+	}
+
+	// ctx 结束时不再等待
+	b = newBackoff(time.Hour, time.Hour)
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if b.Wait(ctx) {
+		t.Error("Wait after cancel returned true")
+	}
+}
+
+func TestTrackerLoop(t *testing.T) {
+	tracker := &Tracker{Terminal: TerminalConfig{ID: "t1"}, MaxFailures: 3}
+	errFail := errors.New("network down")
+
+	// 连续失败 MaxFailures 次后返回
+	calls := 0
+	tracker.loop(context.Background(), time.Millisecond, func(ctx context.Context) error {
+		calls++
+		return errFail
+	})
+	if calls != 3 {
+		t.Errorf("loop called fn %d times, want 3", calls)
+	}
+
+	// 中间成功一次会重新计数
+	calls = 0
+	tracker.loop(context.Background(), time.Millisecond, func(ctx context.Context) error {
+		calls++
+		if calls == 2 {
+			return nil
+		}
+		return errFail
+	})
+	if calls != 5 {
+		t.Errorf("loop called fn %d times, want 5", calls)
+	}
+
+	// ctx 结束时立即返回，不计入失败
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tracker.loop(ctx, time.Hour, func(ctx context.Context) error {
+			return nil
+		})
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("loop did not stop after cancel")
+	}
+}
+
+// fakeAnddrive 模拟开流、续期和定位接口，每次开流后只能获取 sessionLocations 次定位
+type fakeAnddrive struct {
+	sessionLocations int
+
+	lock      sync.Mutex
+	starts    int
+	locations int
+	gpsTime   int64
+}
+
+func (f *fakeAnddrive) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/monitor-start"):
+		f.starts++
+		// 第一次开流失败，验证开流重试
+		if f.starts == 1 {
+			http.Error(w, `{"code":50000,"message":"busy"}`, http.StatusInternalServerError)
+			return
+		}
+		f.locations = 0
+		_, _ = w.Write([]byte(`{"code":0}`))
+	case strings.HasSuffix(r.URL.Path, "/monitor-continue"):
+		_, _ = w.Write([]byte(`{"code":0}`))
+	case strings.HasSuffix(r.URL.Path, "/realtime"):
+		if f.locations >= f.sessionLocations {
+			_, _ = w.Write([]byte(`{"code":50001,"msg":"session expired"}`))
+			return
+		}
+		f.locations++
+		f.gpsTime += 1000
+		_, _ = fmt.Fprintf(w, `{"longitude":123.414406,"latitude":41.806038,"gpsTime":%d,"runStatus":"STARTED"}`, f.gpsTime)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeAnddrive) startCount() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.starts
+}
+
+func newTestStore(t *testing.T) {
+	db, err := storage.Open(storage.Config{DSN: "sqlite://" + filepath.Join(t.TempDir(), "gps.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gpslog.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	_db, store = db, gpslog.NewStore(db)
+}
+
+func TestTrackerRun(t *testing.T) {
+	newTestStore(t)
+	fake := &fakeAnddrive{sessionLocations: 2, gpsTime: 1630999224000}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	client := anddrive.NewClient("key", srv.Client())
+	client.BaseURL = srv.URL
+
+	terminal := TerminalConfig{ID: "860404040006697", CameraType: "FRONT", LocationInterval: 5 * time.Millisecond, ContinueInterval: 5 * time.Millisecond}
+	tracker := NewTracker(terminal, client, nil, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tracker.Run(ctx)
+	}()
+
+	// 第一次开流失败退避 1 秒，之后会话每拿到两次定位就失效并重新开流
+	deadline := time.Now().Add(5 * time.Second)
+	for fake.startCount() < 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not stop after cancel")
+	}
+
+	if n := fake.startCount(); n < 4 {
+		t.Fatalf("monitor-start called %d times, want at least 4", n)
+	}
+	h := tracker.Health()
+	if h.TerminalID != terminal.ID || h.SessionRestarts < 2 || h.LastLocation.IsZero() || h.LastContinue.IsZero() {
+		t.Errorf("Health = %+v, want restarted sessions with locations", h)
+	}
+	var n int64
+	if err := GetDB().Model(&gpslog.GPS{}).Count(&n).Error; err != nil || n < 4 {
+		t.Errorf("%d locations saved, %v, want at least 4", n, err)
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	healthy := NewTracker(TerminalConfig{ID: "a", LocationInterval: time.Second}, nil, nil, 5)
+	healthy.record(nil, func(h *Health) { h.LastLocation = time.Now() })
+	stale := NewTracker(TerminalConfig{ID: "b", LocationInterval: time.Second}, nil, nil, 5)
+	stale.record(nil, func(h *Health) { h.LastLocation = time.Now().Add(-time.Minute) })
+	never := NewTracker(TerminalConfig{ID: "c", LocationInterval: time.Second}, nil, nil, 5)
+	never.record(errors.New("dial tcp: timeout"), nil)
+
+	tests := []struct {
+		trackers []*Tracker
+		status   int
+	}{
+		{[]*Tracker{healthy}, http.StatusOK},
+		{[]*Tracker{}, http.StatusOK},
+		{[]*Tracker{healthy, stale}, http.StatusServiceUnavailable},
+		{[]*Tracker{never, healthy}, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		HealthHandler(tt.trackers)(w, httptest.NewRequest("GET", "/health", nil))
+		if w.Code != tt.status {
+			t.Errorf("status = %d, want %d", w.Code, tt.status)
+		}
+		var res []Health
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || len(res) != len(tt.trackers) {
+			t.Errorf("body = %s, %v, want %d terminals", w.Body.String(), err, len(tt.trackers))
+		}
+	}
+
+	var res []Health
+	w := httptest.NewRecorder()
+	HealthHandler([]*Tracker{never})(w, httptest.NewRequest("GET", "/health", nil))
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res[0].TerminalID != "c" || res[0].ConsecutiveFailures != 1 || res[0].LastError != "dial tcp: timeout" {
+		t.Errorf("Health = %+v", res[0])
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -11,8 +12,24 @@ import (
 	"strconv"
 	"sync"
 	"time"
+
+	"go-web-study/downloader"
 )
 
+var (
+	client       = http.DefaultClient
+	clientConfig = downloader.ClientConfig{
+		Headers: map[string]string{"User-Agent": "Silly Download Manager v001"},
+	}
+	// 默认工作日 8 点到 20 点限速 10MB/s，-rate 0 关闭
+	throttleFlags = downloader.ThrottleFlags{Rate: 10 << 20, Weekdays: "mon-fri", Hours: "8-20"}
+)
+
+func init() {
+	downloader.RegisterClientFlags(flag.CommandLine, &clientConfig)
+	downloader.RegisterThrottleFlags(flag.CommandLine, &throttleFlags)
+}
+
 type Download struct {
 	Url           string
 	TargetPath    string
@@ -20,7 +37,7 @@ type Download struct {
 }
 
 func DownloadFile(url, filename string) {
-	r, err := http.Get(url)
+	r, err := client.Get(url)
 	if err != nil {
 		panic(err)
 	}
@@ -37,13 +54,22 @@ func DownloadFile(url, filename string) {
 }
 
 func main() {
+	flag.Parse()
+	throttleConfig, err := throttleFlags.Config()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if client, err = downloader.NewClient(clientConfig, downloader.NewThrottle(throttleConfig)); err != nil {
+		log.Fatal(err)
+	}
+
 	startTime := time.Now()
 	d := Download{
 		Url:           "https://dl.google.com/go/go1.17.windows-amd64.msi",
 		TargetPath:    "slice_download/go1.17.1.msi",
 		TotalSections: 20,
 	}
-	err := d.Do()
+	err = d.Do()
 	if err != nil {
 		log.Printf("An error occured while downloading the file: %s\n", err)
 	}
@@ -59,7 +85,7 @@ func (d Download) Do() error {
 	if err != nil {
 		return err
 	}
-	resp, err := http.DefaultClient.Do(r)
+	resp, err := client.Do(r)
 	if err != nil {
 		return err
 	}
@@ -111,7 +137,7 @@ func (d Download) downloadSection(i int, c [2]int) error {
 		return err
 	}
 	r.Header.Set("Range", fmt.Sprintf("bytes=%v-%v", c[0], c[1]))
-	resp, err := http.DefaultClient.Do(r)
+	resp, err := client.Do(r)
 	if err != nil {
 		return err
 	}
@@ -138,7 +164,6 @@ func (d Download) getNewRequest(method string) (*http.Request, error) {
 	if err != nil {
 		return nil, err
 	}
-	r.Header.Set("User-Agent", "Silly Download Manager v001")
 	return r, nil
 }
 
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SchemaMigration 已执行的迁移记录
+type SchemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false;column:version"`
+	Name      string    `gorm:"type:varchar(128);column:name"`
+	AppliedAt time.Time `gorm:"column:applied_at"`
+}
+
+// Migration 一次表结构变更，已发布的 Migration 不能修改，只能追加新版本
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+}
+
+// Migrate 按版本顺序执行 table 中没有记录的迁移，不同模块使用不同的记录表
+func Migrate(db *gorm.DB, table string, migrations []Migration) error {
+	if err := db.Table(table).AutoMigrate(&SchemaMigration{}); err != nil {
+		return err
+	}
+	var applied []SchemaMigration
+	if err := db.Table(table).Find(&applied).Error; err != nil {
+		return err
+	}
+	done := make(map[int]bool, len(applied))
+	for _, a := range applied {
+		done[a.Version] = true
+	}
+	for _, m := range migrations {
+		if done[m.Version] {
+			continue
+		}
+		log.Printf("执行数据库迁移 %s %d %s", table, m.Version, m.Name)
+		// mysql 的 DDL 会隐式提交，迁移本身不放在事务里
+		if err := m.Up(db); err != nil {
+			return fmt.Errorf("migration %d %s failed: %v", m.Version, m.Name, err)
+		}
+		record := SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}
+		if err := db.Table(table).Create(&record).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateTo 只执行版本不超过 version 的迁移，用于在后面的迁移之前补齐清理数据需要的列
+func MigrateTo(db *gorm.DB, table string, migrations []Migration, version int) error {
+	var res []Migration
+	for _, m := range migrations {
+		if m.Version <= version {
+			res = append(res, m)
+		}
+	}
+	return Migrate(db, table, res)
+}
+
+// AddLegacyPrimaryKey 早期工具建的表没有主键，在 mysql 上补一个自增 id 列，其它数据库不支持
+func AddLegacyPrimaryKey(tx *gorm.DB, model interface{}, table string) error {
+	m := tx.Migrator()
+	if !m.HasTable(model) || m.HasColumn(model, "id") {
+		return nil
+	}
+	if tx.Dialector.Name() != "mysql" {
+		return fmt.Errorf("legacy %s without id is only supported on mysql", table)
+	}
+	return tx.Exec("ALTER TABLE " + table + " ADD COLUMN id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY FIRST").Error
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestDialector(t *testing.T) {
+	tests := []struct {
+		dsn    string
+		driver string
+		err    string
+	}{
+		{dsn: "mysql://root:pw@db:3306/test", driver: "mysql"},
+		{dsn: "root:pw@tcp(db:3306)/test?charset=utf8", driver: "mysql"},
+		{dsn: "postgres://user:pw@db:5432/test?sslmode=disable", driver: "postgres"},
+		{dsn: "postgresql://user:pw@db/test", driver: "postgres"},
+		{dsn: "sqlite:///var/lib/gps.db", driver: "sqlite"},
+		{dsn: "sqlite://:memory:", driver: "sqlite"},
+		{dsn: "", err: "not configured"},
+		{dsn: "db:3306/test", err: "no scheme"},
+		{dsn: "sqlite://", err: "no path"},
+		{dsn: "oracle://db/test", err: "unsupported"},
+	}
+	for _, tt := range tests {
+		driver, _, err := Dialector(tt.dsn)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Dialector(%q) error = %v, want %q", tt.dsn, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || driver != tt.driver {
+			t.Errorf("Dialector(%q) = %q, %v, want %q", tt.dsn, driver, err, tt.driver)
+		}
+	}
+}
+
+func TestMysqlDSN(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"mysql://root:pw@db/test", "root:pw@tcp(db:3306)/test?charset=utf8mb4&loc=Local&parseTime=True"},
+		{"mysql://root@db:3307/test?charset=utf8", "root@tcp(db:3307)/test?charset=utf8&loc=Local&parseTime=True"},
+		{"mysql://db/test?timeout=10s", "tcp(db:3306)/test?charset=utf8mb4&loc=Local&parseTime=True&timeout=10s"},
+	}
+	for _, tt := range tests {
+		got, err := mysqlDSN(tt.url)
+		if err != nil || got != tt.want {
+			t.Errorf("mysqlDSN(%q) = %q, %v, want %q", tt.url, got, err, tt.want)
+		}
+	}
+}
+
+type item struct {
+	ID   uint64 `gorm:"primaryKey"`
+	Name string `gorm:"type:varchar(32)"`
+}
+
+func TestMemoryMigrate(t *testing.T) {
+	// 连接池配置较大时内存库也只能使用一个连接，否则迁移建的表在其它连接上不存在
+	db, err := Open(Config{DSN: "sqlite://:memory:", MaxOpenConns: 20, MaxIdleConns: 5, ConnMaxLifetime: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := 0
+	migrations := []Migration{
+		{Version: 1, Name: "create item", Up: func(tx *gorm.DB) error {
+			runs++
+			return tx.AutoMigrate(&item{})
+		}},
+	}
+	for i := 0; i < 2; i++ {
+		if err := Migrate(db, "test_migrations", migrations); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if runs != 1 {
+		t.Errorf("migration ran %d times, want 1", runs)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	done := make(chan error, 10)
+	for i := 0; i < cap(done); i++ {
+		go func() {
+			done <- db.Create(&item{Name: "a"}).Error
+		}()
+	}
+	for i := 0; i < cap(done); i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	var n int64
+	if err := db.Model(&item{}).Count(&n).Error; err != nil || n != 10 {
+		t.Errorf("Count = %d, %v, want 10", n, err)
+	}
+}
+
+func TestBatchSize(t *testing.T) {
+	db, err := Open(Config{DSN: "sqlite://:memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// item 有 id、name 两列，sqlite 最多 32766 个占位符
+	tests := []struct {
+		size int
+		want int
+	}{
+		{100, 100},
+		{16383, 16383},
+		{16384, 16383},
+		{100000, 16383},
+		{0, 16383},
+	}
+	for _, tt := range tests {
+		if got := BatchSize(db, &item{}, tt.size); got != tt.want {
+			t.Errorf("BatchSize(%d) = %d, want %d", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestMigrateTo(t *testing.T) {
+	db, err := Open(Config{DSN: "sqlite://:memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var runs []int
+	migrations := make([]Migration, 0, 3)
+	for v := 1; v <= 3; v++ {
+		v := v
+		migrations = append(migrations, Migration{Version: v, Name: "step", Up: func(tx *gorm.DB) error {
+			runs = append(runs, v)
+			return nil
+		}})
+	}
+	if err := MigrateTo(db, "test_migrations", migrations, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(db, "test_migrations", migrations); err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 3 || runs[0] != 1 || runs[1] != 2 || runs[2] != 3 {
+		t.Errorf("runs = %v, want [1 2 3]", runs)
+	}
+}
@@ -0,0 +1,138 @@
+package track
+
+import (
+	"time"
+
+	"go-web-study/coord"
+	"go-web-study/gpslog"
+)
+
+// StopConfig 在 Radius 米范围内停留超过 MinDwell 认为是一次停车
+type StopConfig struct {
+	Radius   float64
+	MinDwell time.Duration
+}
+
+var DefaultStopConfig = StopConfig{Radius: 50, MinDwell: 5 * time.Minute}
+
+type Stop struct {
+	Start  time.Time
+	End    time.Time
+	Center coord.Point
+	Points int
+}
+
+func (s Stop) Dwell() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+type Trip struct {
+	Points []gpslog.GPS
+}
+
+func (t Trip) Start() time.Time {
+	return t.Points[0].Time()
+}
+
+func (t Trip) End() time.Time {
+	return t.Points[len(t.Points)-1].Time()
+}
+
+func (t Trip) Distance() float64 {
+	return Length(t.Points)
+}
+
+func (t Trip) Duration() time.Duration {
+	return Duration(t.Points)
+}
+
+func (t Trip) AverageSpeed() float64 {
+	return AverageSpeed(t.Points)
+}
+
+// Segment 识别停车点并把轨迹切分为行程，track 需要按时间排序。
+// 行程从上一次停车的最后一个点开始，到下一次停车的第一个点结束
+func Segment(track []gpslog.GPS, config StopConfig) ([]Trip, []Stop) {
+	var (
+		trips []Trip
+		stops []Stop
+	)
+	tripStart := 0
+	for i := 0; i < len(track); {
+		j := i + 1
+		for j < len(track) && Distance(track[i], track[j]) <= config.Radius {
+			j++
+		}
+		if track[j-1].Time().Sub(track[i].Time()) < config.MinDwell {
+			i++
+			continue
+		}
+		stops = append(stops, newStop(track[i:j]))
+		if i > tripStart {
+			trips = append(trips, Trip{Points: track[tripStart : i+1]})
+		}
+		tripStart = j - 1
+		i = j
+	}
+	if len(track)-1 > tripStart {
+		trips = append(trips, Trip{Points: track[tripStart:]})
+	}
+	return trips, stops
+}
+
+func newStop(points []gpslog.GPS) Stop {
+	lon, lat := 0.0, 0.0
+	for _, g := range points {
+		lon += g.Longitude
+		lat += g.Latitude
+	}
+	n := float64(len(points))
+	return Stop{
+		Start:  points[0].Time(),
+		End:    points[len(points)-1].Time(),
+		Center: coord.Point{Lon: lon / n, Lat: lat / n, Datum: coord.WGS84},
+		Points: len(points),
+	}
+}
+
+// DayReport 终端单日统计，Distance 单位米，MaxSpeed 单位米/秒
+type DayReport struct {
+	TerminalID string
+	Date       string
+	Points     int
+	Outliers   int
+	Distance   float64
+	MaxSpeed   float64
+	Trips      []Trip
+	Stops      []Stop
+}
+
+// Daily 按 loc 时区的自然日统计里程、行程和停车，漂移点不参与计算
+func Daily(terminalID string, track []gpslog.GPS, config StopConfig, maxSpeed float64, loc *time.Location) []DayReport {
+	Sort(track)
+	var (
+		res  []DayReport
+		days [][]gpslog.GPS
+	)
+	for i, g := range track {
+		if i == 0 || g.Time().In(loc).Format("2006-01-02") != track[i-1].Time().In(loc).Format("2006-01-02") {
+			days = append(days, nil)
+		}
+		days[len(days)-1] = append(days[len(days)-1], g)
+	}
+	for _, day := range days {
+		clean := RemoveOutliers(day, maxSpeed)
+		trips, stops := Segment(clean, config)
+		res = append(res, DayReport{
+			TerminalID: terminalID,
+			Date:       day[0].Time().In(loc).Format("2006-01-02"),
+			Points:     len(day),
+			Outliers:   len(day) - len(clean),
+			Distance:   Length(clean),
+			MaxSpeed:   MaxSpeed(clean),
+			Trips:      trips,
+			Stops:      stops,
+		})
+	}
+	return res
+}
@@ -0,0 +1,141 @@
+package track
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"go-web-study/coord"
+	"go-web-study/gpslog"
+)
+
+// EarthRadius 地球平均半径，单位米
+const EarthRadius = 6371008.8
+
+func radians(d float64) float64 {
+	return d * math.Pi / 180
+}
+
+// Haversine 两点间的大圆距离，单位米，不同坐标系的点先转换为 WGS84，坐标系不支持时返回 NaN
+func Haversine(a, b coord.Point) float64 {
+	a, errA := a.To(coord.WGS84)
+	b, errB := b.To(coord.WGS84)
+	if errA != nil || errB != nil {
+		return math.NaN()
+	}
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLat := lat2 - lat1
+	dLon := radians(b.Lon - a.Lon)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func wgs84(g gpslog.GPS) coord.Point {
+	return coord.Point{Lon: g.Longitude, Lat: g.Latitude, Datum: coord.WGS84}
+}
+
+// Distance 两个定位点间的距离，单位米
+func Distance(a, b gpslog.GPS) float64 {
+	return Haversine(wgs84(a), wgs84(b))
+}
+
+// Speed 两个定位点间的瞬时速度，单位米/秒，时间相同或倒序时返回 0
+func Speed(a, b gpslog.GPS) float64 {
+	dt := float64(b.GpsTime-a.GpsTime) / 1000
+	if dt <= 0 {
+		return 0
+	}
+	return Distance(a, b) / dt
+}
+
+// Sort 按定位时间排序
+func Sort(track []gpslog.GPS) {
+	sort.SliceStable(track, func(i, j int) bool {
+		return track[i].GpsTime < track[j].GpsTime
+	})
+}
+
+// Length 轨迹总长度，单位米
+func Length(track []gpslog.GPS) float64 {
+	total := 0.0
+	for i := 1; i < len(track); i++ {
+		total += Distance(track[i-1], track[i])
+	}
+	return total
+}
+
+// Duration 轨迹首尾时间差
+func Duration(track []gpslog.GPS) time.Duration {
+	if len(track) < 2 {
+		return 0
+	}
+	return track[len(track)-1].Time().Sub(track[0].Time())
+}
+
+// AverageSpeed 平均速度，单位米/秒
+func AverageSpeed(track []gpslog.GPS) float64 {
+	d := Duration(track)
+	if d <= 0 {
+		return 0
+	}
+	return Length(track) / d.Seconds()
+}
+
+// MaxSpeed 相邻定位点间的最大瞬时速度，单位米/秒
+func MaxSpeed(track []gpslog.GPS) float64 {
+	max := 0.0
+	for i := 1; i < len(track); i++ {
+		max = math.Max(max, Speed(track[i-1], track[i]))
+	}
+	return max
+}
+
+// Outliers 返回漂移点的下标：相对上一个正常点的速度超过 maxSpeed(米/秒) 即认为是 GPS 跳点，
+// 第一个正常点由 anchor 选出，避免开头的跳点被当作基准把后面的正常点都判为漂移
+func Outliers(track []gpslog.GPS, maxSpeed float64) []int {
+	var res []int
+	last := anchor(track, maxSpeed)
+	for i := range track {
+		if i < last {
+			res = append(res, i)
+			continue
+		}
+		if i > last && Speed(track[last], track[i]) > maxSpeed {
+			res = append(res, i)
+			continue
+		}
+		last = i
+	}
+	return res
+}
+
+// anchor 返回第一个与后面两个点中任意一个速度正常的点，单个跳点只会与前后两个点都不一致，
+// 找不到时返回 0
+func anchor(track []gpslog.GPS, maxSpeed float64) int {
+	for i := range track {
+		for j := i + 1; j < len(track) && j <= i+2; j++ {
+			if Speed(track[i], track[j]) <= maxSpeed {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+// RemoveOutliers 去掉漂移点后的轨迹
+func RemoveOutliers(track []gpslog.GPS, maxSpeed float64) []gpslog.GPS {
+	outliers := Outliers(track, maxSpeed)
+	if len(outliers) == 0 {
+		return track
+	}
+	res := make([]gpslog.GPS, 0, len(track)-len(outliers))
+	next := 0
+	for i, g := range track {
+		if next < len(outliers) && outliers[next] == i {
+			next++
+			continue
+		}
+		res = append(res, g)
+	}
+	return res
+}
@@ -0,0 +1,156 @@
+package track
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"go-web-study/coord"
+	"go-web-study/gpslog"
+)
+
+var base = time.Date(2021, 9, 7, 8, 0, 0, 0, time.UTC)
+
+// point 生成 base 之后 seconds 秒、沿纬度 41.8 向东 meters 米的定位点
+func point(seconds int, meters float64) gpslog.GPS {
+	lon := 123.4 + meters/(EarthRadius*math.Cos(41.8*math.Pi/180))*180/math.Pi
+	return gpslog.GPS{
+		TerminalID: "a",
+		Longitude:  lon,
+		Latitude:   41.8,
+		GpsTime:    base.Add(time.Duration(seconds)*time.Second).UnixNano() / int64(time.Millisecond),
+	}
+}
+
+func near(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+func TestHaversine(t *testing.T) {
+	// 纬度 1 度约 111.195 公里
+	a := coord.Point{Lon: 123.4, Lat: 41, Datum: coord.WGS84}
+	b := coord.Point{Lon: 123.4, Lat: 42, Datum: coord.WGS84}
+	if d := Haversine(a, b); !near(d, 111195, 1) {
+		t.Errorf("Haversine = %f, want 111195", d)
+	}
+	// 不同坐标系的同一点距离为 0
+	gcj, _ := a.To(coord.GCJ02)
+	if d := Haversine(a, gcj); d > 1 {
+		t.Errorf("Haversine(wgs84, gcj02) = %f, want about 0", d)
+	}
+	if d := Haversine(a, coord.Point{Datum: "UTM"}); !math.IsNaN(d) {
+		t.Errorf("Haversine with unknown datum = %f, want NaN", d)
+	}
+}
+
+func TestSpeed(t *testing.T) {
+	track := []gpslog.GPS{point(0, 0), point(10, 100), point(20, 300)}
+	if d := Length(track); !near(d, 300, 0.1) {
+		t.Errorf("Length = %f, want 300", d)
+	}
+	if d := Duration(track); d != 20*time.Second {
+		t.Errorf("Duration = %s, want 20s", d)
+	}
+	if v := AverageSpeed(track); !near(v, 15, 0.01) {
+		t.Errorf("AverageSpeed = %f, want 15", v)
+	}
+	if v := MaxSpeed(track); !near(v, 20, 0.01) {
+		t.Errorf("MaxSpeed = %f, want 20", v)
+	}
+	if v := Speed(track[1], track[0]); v != 0 {
+		t.Errorf("Speed backwards = %f, want 0", v)
+	}
+}
+
+func TestOutliers(t *testing.T) {
+	// 第 2 个点 1 秒跳出 5 公里
+	track := []gpslog.GPS{point(0, 0), point(1, 5000), point(2, 20), point(3, 40)}
+	outliers := Outliers(track, 50)
+	if len(outliers) != 1 || outliers[0] != 1 {
+		t.Fatalf("Outliers = %v, want [1]", outliers)
+	}
+	clean := RemoveOutliers(track, 50)
+	if len(clean) != 3 || clean[1].GpsTime != track[2].GpsTime {
+		t.Errorf("RemoveOutliers = %+v", clean)
+	}
+
+	cases := []struct {
+		track []gpslog.GPS
+		want  []int
+	}{
+		// 第 1 个点就是跳点
+		{[]gpslog.GPS{point(0, 5000), point(1, 0), point(2, 20), point(3, 40)}, []int{0}},
+		// 开头的跳点之后紧跟一个跳点
+		{[]gpslog.GPS{point(0, 5000), point(1, 0), point(2, 9000), point(3, 40)}, []int{0, 2}},
+		// 最后一个点是跳点
+		{[]gpslog.GPS{point(0, 0), point(1, 20), point(2, 40), point(3, 5000)}, []int{3}},
+		{[]gpslog.GPS{point(0, 0), point(1, 20)}, nil},
+		{[]gpslog.GPS{point(0, 0)}, nil},
+		{nil, nil},
+	}
+	for _, c := range cases {
+		if got := Outliers(c.track, 50); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Outliers(%d points) = %v, want %v", len(c.track), got, c.want)
+		}
+	}
+	// 去掉开头的跳点后保留后面的正常点
+	clean = RemoveOutliers(cases[0].track, 50)
+	if len(clean) != 3 || clean[0].GpsTime != cases[0].track[1].GpsTime {
+		t.Errorf("RemoveOutliers with leading jump = %+v", clean)
+	}
+}
+
+func TestSegment(t *testing.T) {
+	var track []gpslog.GPS
+	// 行驶 5 分钟，每分钟 600 米
+	for i := 0; i <= 5; i++ {
+		track = append(track, point(i*60, float64(i)*600))
+	}
+	// 原地停 10 分钟，定位在 20 米内抖动
+	for i := 1; i <= 10; i++ {
+		track = append(track, point(300+i*60, 3000+float64(i%2)*20))
+	}
+	// 继续行驶 3 分钟
+	for i := 1; i <= 3; i++ {
+		track = append(track, point(900+i*60, 3000+float64(i)*600))
+	}
+
+	trips, stops := Segment(track, StopConfig{Radius: 50, MinDwell: 5 * time.Minute})
+	if len(stops) != 1 {
+		t.Fatalf("stops = %+v, want 1", stops)
+	}
+	if stops[0].Dwell() != 10*time.Minute || stops[0].Points != 11 {
+		t.Errorf("stop = %+v, want 10m with 11 points", stops[0])
+	}
+	if len(trips) != 2 {
+		t.Fatalf("trips = %d, want 2", len(trips))
+	}
+	if d := trips[0].Distance(); !near(d, 3000, 1) {
+		t.Errorf("first trip distance = %f, want 3000", d)
+	}
+	if !trips[1].Start().Equal(stops[0].End) {
+		t.Errorf("second trip starts at %s, want stop end %s", trips[1].Start(), stops[0].End)
+	}
+
+	// 停留时间不够时不切分
+	trips, stops = Segment(track, StopConfig{Radius: 50, MinDwell: time.Hour})
+	if len(stops) != 0 || len(trips) != 1 || len(trips[0].Points) != len(track) {
+		t.Errorf("Segment with long dwell = %d trips, %d stops", len(trips), len(stops))
+	}
+}
+
+func TestDaily(t *testing.T) {
+	track := []gpslog.GPS{point(86400, 0), point(0, 0), point(60, 600), point(86460, 300), point(61, 50000)}
+	reports := Daily("a", track, DefaultStopConfig, 50, time.UTC)
+	if len(reports) != 2 {
+		t.Fatalf("reports = %+v, want 2 days", reports)
+	}
+	first := reports[0]
+	if first.Date != "2021-09-07" || first.Points != 3 || first.Outliers != 1 || !near(first.Distance, 600, 0.1) {
+		t.Errorf("first day = %+v", first)
+	}
+	if second := reports[1]; second.Date != "2021-09-08" || second.Points != 2 || !near(second.Distance, 300, 0.1) {
+		t.Errorf("second day = %+v", second)
+	}
+}